@@ -0,0 +1,229 @@
+// Package cancellation evaluates tiered cancellation policies. A policy is a list of
+// tiers; the first tier whose notice period the guest still meets decides the refund.
+// Reservations store a Snapshot of the policy taken when they were created, so editing
+// a policy later never changes the refund of an existing booking.
+package cancellation
+
+import (
+	"apartments-clone-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// DefaultKey is the preset used when a property has no (known) policy
+const DefaultKey = "flexible"
+
+// CustomKey marks policies written by a host rather than picked from the presets
+const CustomKey = "custom"
+
+// MaxTiers bounds how many tiers a policy may have
+const MaxTiers = 10
+
+// ErrInvalidTiers is returned for tier lists that can't be evaluated
+var ErrInvalidTiers = errors.New("invalid cancellation tiers")
+
+// Tier grants RefundPercent of the booking when the guest cancels at least
+// HoursBeforeCheckIn hours before check-in. Cleaning and service fees are
+// refunded at the same rate only when FeesRefundable is set.
+type Tier struct {
+	HoursBeforeCheckIn int     `json:"hoursBeforeCheckIn"`
+	RefundPercent      float64 `json:"refundPercent"`
+	FeesRefundable     bool    `json:"feesRefundable"`
+}
+
+// Snapshot is the policy as stored on a reservation
+type Snapshot struct {
+	PolicyID uint   `json:"policyID,omitempty"`
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Tiers    []Tier `json:"tiers"`
+}
+
+// Result is the outcome of cancelling at a given time
+type Result struct {
+	Refund    float64 `json:"refund"`
+	Percent   float64 `json:"percent"`
+	CanCancel bool    `json:"canCancel"`
+	Reason    string  `json:"reason"`
+}
+
+// Presets are the platform policies seeded on startup. They match the refunds the
+// app has always given, so existing listings keep their terms.
+var Presets = []Snapshot{
+	{Key: "flexible", Name: "Flexible", Tiers: []Tier{
+		{HoursBeforeCheckIn: 24, RefundPercent: 100, FeesRefundable: true},
+	}},
+	{Key: "moderate", Name: "Moderate", Tiers: []Tier{
+		{HoursBeforeCheckIn: 5 * 24, RefundPercent: 100, FeesRefundable: true},
+		{HoursBeforeCheckIn: 24, RefundPercent: 50, FeesRefundable: true},
+	}},
+	{Key: "strict", Name: "Strict", Tiers: []Tier{
+		{HoursBeforeCheckIn: 7 * 24, RefundPercent: 50, FeesRefundable: true},
+	}},
+}
+
+// NormalizeTiers validates tiers and orders them from the longest notice to the shortest
+func NormalizeTiers(tiers []Tier) ([]Tier, error) {
+	if len(tiers) == 0 || len(tiers) > MaxTiers {
+		return nil, fmt.Errorf("%w: between 1 and %d tiers required", ErrInvalidTiers, MaxTiers)
+	}
+	sorted := append([]Tier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].HoursBeforeCheckIn > sorted[j].HoursBeforeCheckIn })
+	for i, t := range sorted {
+		if t.HoursBeforeCheckIn < 0 || t.RefundPercent < 0 || t.RefundPercent > 100 {
+			return nil, fmt.Errorf("%w: hours must be >= 0 and percent between 0 and 100", ErrInvalidTiers)
+		}
+		if i > 0 && sorted[i-1].HoursBeforeCheckIn == t.HoursBeforeCheckIn {
+			return nil, fmt.Errorf("%w: duplicate tier at %d hours", ErrInvalidTiers, t.HoursBeforeCheckIn)
+		}
+	}
+	return sorted, nil
+}
+
+// EncodeTiers stores tiers on a CancellationPolicy
+func EncodeTiers(tiers []Tier) datatypes.JSON {
+	raw, _ := json.Marshal(tiers)
+	return datatypes.JSON(raw)
+}
+
+// FromPolicy builds the snapshot of a stored policy
+func FromPolicy(policy *models.CancellationPolicy) (*Snapshot, error) {
+	var tiers []Tier
+	if err := json.Unmarshal(policy.Tiers, &tiers); err != nil {
+		return nil, err
+	}
+	tiers, err := NormalizeTiers(tiers)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{PolicyID: policy.ID, Key: policy.Key, Name: policy.Name, Tiers: tiers}, nil
+}
+
+// JSON encodes the snapshot for storage on a reservation
+func (s *Snapshot) JSON() datatypes.JSON {
+	raw, _ := json.Marshal(s)
+	return datatypes.JSON(raw)
+}
+
+// Decode reads the snapshot stored on a reservation; reservations made before
+// policies were snapshotted have none and return an error
+func Decode(raw datatypes.JSON) (*Snapshot, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errors.New("no cancellation policy snapshot")
+	}
+	var s Snapshot
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Tiers) == 0 {
+		return nil, ErrInvalidTiers
+	}
+	return &s, nil
+}
+
+// Preset returns the built-in preset with the given key, falling back to DefaultKey
+func Preset(key string) Snapshot {
+	for _, p := range Presets {
+		if p.Key == key {
+			return p
+		}
+	}
+	return Presets[0]
+}
+
+// Resolve returns the policy currently in force for a property: the policy it points to,
+// otherwise the active preset named by its cancellationPolicy key, otherwise the default
+func Resolve(db *gorm.DB, property *models.Property) (*Snapshot, error) {
+	var policy models.CancellationPolicy
+	var err error
+	if property.CancellationPolicyID != nil {
+		err = db.Where("host_id IS NULL OR host_id = ?", property.HostID).First(&policy, *property.CancellationPolicyID).Error
+	} else {
+		key := property.CancellationPolicy
+		if key == "" {
+			key = DefaultKey
+		}
+		err = db.Where("host_id IS NULL AND key = ? AND is_active = ?", key, true).First(&policy).Error
+	}
+	if err == nil {
+		return FromPolicy(&policy)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	preset := Preset(property.CancellationPolicy)
+	return &preset, nil
+}
+
+// SeedPresets creates the built-in presets that don't exist yet; admin edits are kept
+func SeedPresets(db *gorm.DB) error {
+	for _, p := range Presets {
+		var count int64
+		if err := db.Unscoped().Model(&models.CancellationPolicy{}).Where("host_id IS NULL AND key = ?", p.Key).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := db.Create(&models.CancellationPolicy{Key: p.Key, Name: p.Name, Tiers: EncodeTiers(p.Tiers), IsActive: true}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate works out the refund for cancelling at now. total is what the guest paid,
+// fees the cleaning and service fees included in it. Cancelling is refused once no
+// tier applies; a tier at 0 hours and 0% allows late cancellation without refund.
+func (s *Snapshot) Evaluate(total, fees float64, checkIn, now time.Time) Result {
+	hours := checkIn.Sub(now).Hours()
+	for _, t := range s.Tiers {
+		if hours < float64(t.HoursBeforeCheckIn) {
+			continue
+		}
+		refundable := total
+		if !t.FeesRefundable {
+			refundable = math.Max(total-fees, 0)
+		}
+		refund := math.Round(refundable*t.RefundPercent) / 100
+		return Result{
+			Refund:    refund,
+			Percent:   t.RefundPercent,
+			CanCancel: true,
+			Reason:    fmt.Sprintf("%s - cancelled %s before check-in", refundLabel(t.RefundPercent), notice(t.HoursBeforeCheckIn)),
+		}
+	}
+
+	if len(s.Tiers) == 0 || s.Tiers[len(s.Tiers)-1].HoursBeforeCheckIn == 0 {
+		return Result{Reason: "No refund - check-in has passed"}
+	}
+	shortest := s.Tiers[len(s.Tiers)-1].HoursBeforeCheckIn
+	return Result{Reason: fmt.Sprintf("No refund - cancelled less than %s before check-in", strings.Replace(notice(shortest), "+", "", 1))}
+}
+
+func refundLabel(percent float64) string {
+	switch percent {
+	case 100:
+		return "Full refund"
+	case 0:
+		return "No refund"
+	}
+	return fmt.Sprintf("%g%% refund", percent)
+}
+
+// notice renders a notice period the way guests read it: "24 hours", "5 days"
+func notice(hours int) string {
+	if hours >= 48 && hours%24 == 0 {
+		return fmt.Sprintf("%d+ days", hours/24)
+	}
+	return fmt.Sprintf("%d+ hours", hours)
+}
@@ -0,0 +1,59 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresetsKeepLegacyRefunds(t *testing.T) {
+	checkIn := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	cases := []struct {
+		key       string
+		before    time.Duration
+		refund    float64
+		canCancel bool
+	}{
+		{"flexible", 25 * time.Hour, 200, true},
+		{"flexible", 23 * time.Hour, 0, false},
+		{"moderate", 6 * 24 * time.Hour, 200, true},
+		{"moderate", 3 * 24 * time.Hour, 100, true},
+		{"moderate", 12 * time.Hour, 0, false},
+		{"strict", 8 * 24 * time.Hour, 100, true},
+		{"strict", 6 * 24 * time.Hour, 0, false},
+	}
+	for _, c := range cases {
+		policy := Preset(c.key)
+		got := policy.Evaluate(200, 30, checkIn, checkIn.Add(-c.before))
+		if got.Refund != c.refund || got.CanCancel != c.canCancel {
+			t.Fatalf("%s %v before: expected %.2f/%v, got %.2f/%v (%s)", c.key, c.before, c.refund, c.canCancel, got.Refund, got.CanCancel, got.Reason)
+		}
+	}
+}
+
+func TestEvaluateCustomTiers(t *testing.T) {
+	tiers, err := NormalizeTiers([]Tier{
+		{HoursBeforeCheckIn: 0, RefundPercent: 0},
+		{HoursBeforeCheckIn: 14 * 24, RefundPercent: 100, FeesRefundable: true},
+		{HoursBeforeCheckIn: 48, RefundPercent: 50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := Snapshot{Key: CustomKey, Tiers: tiers}
+	checkIn := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	// 50% of the stay excluding the 30 in fees
+	got := policy.Evaluate(230, 30, checkIn, checkIn.Add(-72*time.Hour))
+	if got.Refund != 100 || got.Percent != 50 {
+		t.Fatalf("expected 100 at 50%%, got %.2f at %.0f%%", got.Refund, got.Percent)
+	}
+	// The 0-hour tier lets the guest cancel late without a refund
+	got = policy.Evaluate(230, 30, checkIn, checkIn.Add(-time.Hour))
+	if !got.CanCancel || got.Refund != 0 {
+		t.Fatalf("expected cancellable without refund, got %+v", got)
+	}
+
+	if _, err := NormalizeTiers([]Tier{{HoursBeforeCheckIn: 24, RefundPercent: 120}}); err == nil {
+		t.Fatal("expected percent above 100 to be rejected")
+	}
+}
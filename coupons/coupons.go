@@ -0,0 +1,238 @@
+// Package coupons validates promo codes and records their redemptions. A code is checked
+// when a price is quoted and again, with the coupon row locked, when the booking is made,
+// so a limited code can't be redeemed more often than allowed by concurrent checkouts.
+package coupons
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Coupon types
+const (
+	Percent = "percent" // Value percent off
+	Fixed   = "fixed"   // Value off, in the coupon's currency
+)
+
+// Who issued a coupon
+const (
+	IssuerPlatform = "platform"
+	IssuerHost     = "host"
+)
+
+// What a coupon applies to
+const (
+	AppliesAll         = "all"
+	AppliesStays       = "stays"
+	AppliesExperiences = "experiences"
+)
+
+// Coupon target types
+const (
+	TargetProperty     = "property"
+	TargetExperience   = "experience"
+	TargetOrganization = "organization"
+)
+
+var (
+	ErrNotFound      = errors.New("promo code not found")
+	ErrNotValidNow   = errors.New("promo code is not valid at this time")
+	ErrNotApplicable = errors.New("promo code does not apply to this booking")
+	ErrCurrency      = errors.New("promo code does not apply to bookings in this currency")
+	ErrMinSpend      = errors.New("booking is below the promo code's minimum spend")
+	ErrExhausted     = errors.New("promo code has been fully redeemed")
+	ErrUserLimit     = errors.New("promo code already used the maximum number of times")
+)
+
+// Target is the booking a coupon is used on
+type Target struct {
+	SubjectType string // payments.SubjectReservation or payments.SubjectExperienceBooking
+	ListingID   uint   // the property or experience
+	HostID      uint
+	UserID      uint    // the guest; 0 for anonymous quotes, which skip the per-user limit
+	Amount      float64 // what the coupon discounts: the booking before taxes and deposit
+	Currency    string
+}
+
+// Normalize is the stored form of a code
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Find loads an active or inactive coupon by code, with its targets
+func Find(db *gorm.DB, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := db.Preload("Targets").Where("code = ?", Normalize(code)).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// Check returns why coupon can't be used on target at now, or nil when it can
+func Check(db *gorm.DB, coupon *models.Coupon, target Target, now time.Time) error {
+	if err := checkRules(coupon, target, now); err != nil {
+		return err
+	}
+
+	// Organization targets cover the listings hosted by the organization's owner and agents
+	if ok := matchesTargets(coupon, target); !ok {
+		var organizations []uint
+		for _, t := range coupon.Targets {
+			if t.TargetType == TargetOrganization {
+				organizations = append(organizations, t.TargetID)
+			}
+		}
+		if len(organizations) == 0 {
+			return ErrNotApplicable
+		}
+		var count int64
+		if err := db.Raw(`SELECT COUNT(*) FROM organizations o
+			WHERE o.id IN ? AND o.deleted_at IS NULL AND (o.owner_id = ? OR EXISTS (
+				SELECT 1 FROM agents a WHERE a.organization_id = o.id AND a.user_id = ? AND a.deleted_at IS NULL))`,
+			organizations, target.HostID, target.HostID).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotApplicable
+		}
+	}
+
+	if coupon.MaxPerUser > 0 && target.UserID != 0 {
+		var used int64
+		if err := db.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ? AND released_at IS NULL", coupon.ID, target.UserID).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if int(used) >= coupon.MaxPerUser {
+			return ErrUserLimit
+		}
+	}
+	return nil
+}
+
+// Discount is what coupon takes off amount, never more than amount
+func Discount(coupon *models.Coupon, amount float64) float64 {
+	value := coupon.Value
+	if coupon.Type == Percent {
+		value = amount * coupon.Value / 100
+	}
+	if value > amount {
+		value = amount
+	}
+	if value < 0 {
+		value = 0
+	}
+	return math.Round(value*100) / 100
+}
+
+// Redeem records coupon couponID on a booking. The coupon row is locked until the surrounding
+// transaction ends and every rule is checked again, so the limits hold under concurrency.
+func Redeem(tx *gorm.DB, couponID uint, target Target, subjectID uint, discount float64) (*models.CouponRedemption, error) {
+	var coupon models.Coupon
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, couponID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("coupon_id = ?", coupon.ID).Find(&coupon.Targets).Error; err != nil {
+		return nil, err
+	}
+	if err := Check(tx, &coupon, target, time.Now()); err != nil {
+		return nil, err
+	}
+
+	redemption := models.CouponRedemption{
+		CouponID:    coupon.ID,
+		UserID:      target.UserID,
+		SubjectType: target.SubjectType,
+		SubjectID:   subjectID,
+		Amount:      discount,
+		Currency:    target.Currency,
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&coupon).UpdateColumn("redemptions", gorm.Expr("redemptions + 1")).Error; err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// UpdateDiscount records the discount of the coupon used on a booking whose price changed
+func UpdateDiscount(tx *gorm.DB, subjectType string, subjectID uint, discount float64) error {
+	return tx.Model(&models.CouponRedemption{}).
+		Where("subject_type = ? AND subject_id = ? AND released_at IS NULL", subjectType, subjectID).
+		Update("amount", discount).Error
+}
+
+// Release frees the coupon used on a booking that ended without a stay (rejected, expired or
+// cancelled), so it counts towards no limit any more. Bookings without a coupon are left alone.
+func Release(tx *gorm.DB, subjectType string, subjectID uint) error {
+	var redemptions []models.CouponRedemption
+	if err := tx.Where("subject_type = ? AND subject_id = ? AND released_at IS NULL", subjectType, subjectID).
+		Find(&redemptions).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, r := range redemptions {
+		result := tx.Model(&models.CouponRedemption{}).Where("id = ? AND released_at IS NULL", r.ID).Update("released_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := tx.Model(&models.Coupon{}).Where("id = ? AND redemptions > 0", r.CouponID).
+			UpdateColumn("redemptions", gorm.Expr("redemptions - 1")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRules checks everything that doesn't need the database
+func checkRules(coupon *models.Coupon, target Target, now time.Time) error {
+	switch {
+	case !coupon.IsActive:
+		return ErrNotFound
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt), coupon.EndsAt != nil && !now.Before(*coupon.EndsAt):
+		return ErrNotValidNow
+	case coupon.AppliesTo == AppliesStays && target.SubjectType != payments.SubjectReservation,
+		coupon.AppliesTo == AppliesExperiences && target.SubjectType != payments.SubjectExperienceBooking,
+		coupon.Issuer == IssuerHost && (coupon.IssuerID == nil || *coupon.IssuerID != target.HostID):
+		return ErrNotApplicable
+	case (coupon.Type == Fixed || coupon.MinSpend > 0) && coupon.Currency != target.Currency:
+		return ErrCurrency
+	case target.Amount < coupon.MinSpend:
+		return ErrMinSpend
+	case coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions:
+		return ErrExhausted
+	}
+	return nil
+}
+
+// matchesTargets reports whether a coupon without targets, or one of its property and
+// experience targets, covers the booking; organization targets need the database
+func matchesTargets(coupon *models.Coupon, target Target) bool {
+	if len(coupon.Targets) == 0 {
+		return true
+	}
+	for _, t := range coupon.Targets {
+		switch {
+		case t.TargetType == TargetProperty && target.SubjectType == payments.SubjectReservation && t.TargetID == target.ListingID,
+			t.TargetType == TargetExperience && target.SubjectType == payments.SubjectExperienceBooking && t.TargetID == target.ListingID:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package coupons
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckRules(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(24 * time.Hour)
+	host := uint(7)
+	stay := Target{SubjectType: payments.SubjectReservation, ListingID: 3, HostID: host, Amount: 200, Currency: "MRU"}
+
+	cases := []struct {
+		name   string
+		coupon models.Coupon
+		target Target
+		want   error
+	}{
+		{"valid", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll}, stay, nil},
+		{"inactive", models.Coupon{Type: Percent, Value: 10, AppliesTo: AppliesAll}, stay, ErrNotFound},
+		{"not started", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll, StartsAt: &later}, stay, ErrNotValidNow},
+		{"ended", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll, EndsAt: &now}, stay, ErrNotValidNow},
+		{"experiences only", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesExperiences}, stay, ErrNotApplicable},
+		{"other host", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll, Issuer: IssuerHost, IssuerID: new(uint)}, stay, ErrNotApplicable},
+		{"own host", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll, Issuer: IssuerHost, IssuerID: &host}, stay, nil},
+		{"fixed in other currency", models.Coupon{IsActive: true, Type: Fixed, Value: 10, Currency: "EUR", AppliesTo: AppliesAll}, stay, ErrCurrency},
+		{"percent ignores currency", models.Coupon{IsActive: true, Type: Percent, Value: 10, Currency: "EUR", AppliesTo: AppliesAll}, stay, nil},
+		{"below minimum spend", models.Coupon{IsActive: true, Type: Fixed, Value: 10, Currency: "MRU", MinSpend: 500, AppliesTo: AppliesAll}, stay, ErrMinSpend},
+		{"exhausted", models.Coupon{IsActive: true, Type: Percent, Value: 10, AppliesTo: AppliesAll, MaxRedemptions: 5, Redemptions: 5}, stay, ErrExhausted},
+	}
+	for _, c := range cases {
+		if got := checkRules(&c.coupon, c.target, now); !errors.Is(got, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMatchesTargets(t *testing.T) {
+	coupon := &models.Coupon{Targets: []models.CouponTarget{
+		{TargetType: TargetProperty, TargetID: 3},
+		{TargetType: TargetExperience, TargetID: 9},
+	}}
+	if !matchesTargets(coupon, Target{SubjectType: payments.SubjectReservation, ListingID: 3}) {
+		t.Fatal("property 3 is a target")
+	}
+	if !matchesTargets(coupon, Target{SubjectType: payments.SubjectExperienceBooking, ListingID: 9}) {
+		t.Fatal("experience 9 is a target")
+	}
+	// Same id, other kind of listing
+	if matchesTargets(coupon, Target{SubjectType: payments.SubjectReservation, ListingID: 9}) {
+		t.Fatal("property 9 is not a target")
+	}
+	if !matchesTargets(&models.Coupon{}, Target{SubjectType: payments.SubjectReservation, ListingID: 1}) {
+		t.Fatal("a coupon without targets applies everywhere")
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	if got := Discount(&models.Coupon{Type: Percent, Value: 15}, 333.33); got != 50 {
+		t.Fatalf("expected 50, got %.2f", got)
+	}
+	if got := Discount(&models.Coupon{Type: Fixed, Value: 80}, 50); got != 50 {
+		t.Fatalf("a fixed discount is capped at the amount, got %.2f", got)
+	}
+}
@@ -0,0 +1,210 @@
+// Package fx converts amounts between currencies for display. Rates are stored against
+// the base currency (MRU), so converting from one currency to another goes through it.
+// Nothing is ever charged in a converted amount: guests pay in the listing's currency
+// and records keep the rate they were shown.
+package fx
+
+import (
+	"apartments-clone-server/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Base is the currency rates are expressed in
+const Base = "MRU"
+
+// ErrUnknownCurrency is returned when a currency has no rate
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+var codePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// zeroDecimal currencies have no minor unit in practice
+var zeroDecimal = map[string]bool{"XOF": true, "XAF": true, "GNF": true, "JPY": true, "KRW": true}
+
+// Table holds the known rates by currency code
+type Table map[string]models.ExchangeRate
+
+// Normalize upper-cases and trims a currency code
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCode reports whether code looks like an ISO 4217 code
+func ValidCode(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// DefaultDecimals is the rounding precision used for a currency unless its rate sets one
+func DefaultDecimals(code string) int {
+	if zeroDecimal[Normalize(code)] {
+		return 0
+	}
+	return 2
+}
+
+// Load reads every rate; the base currency is always present
+func Load(db *gorm.DB) (Table, error) {
+	var rows []models.ExchangeRate
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	t := Table{Base: {Currency: Base, Rate: 1, Decimals: DefaultDecimals(Base)}}
+	for _, r := range rows {
+		if r.Currency == Base {
+			// Only the rounding of the base currency can be changed
+			r.Rate = 1
+		}
+		t[r.Currency] = r
+	}
+	return t, nil
+}
+
+// Has reports whether amounts can be converted to or from code
+func (t Table) Has(code string) bool {
+	r, ok := t[Normalize(code)]
+	return ok && r.Rate > 0
+}
+
+// Rate returns how many units of to one unit of from is worth. Records without a
+// currency are in the base currency.
+func (t Table) Rate(from, to string) (float64, error) {
+	from, to = Normalize(from), Normalize(to)
+	if from == "" {
+		from = Base
+	}
+	if to == "" {
+		to = Base
+	}
+	if from == to {
+		return 1, nil
+	}
+	f, ok := t[from]
+	if !ok || f.Rate <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, from)
+	}
+	r, ok := t[to]
+	if !ok || r.Rate <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, to)
+	}
+	return f.Rate / r.Rate, nil
+}
+
+// Round rounds an amount half away from zero to the precision of code
+func (t Table) Round(amount float64, code string) float64 {
+	decimals := DefaultDecimals(code)
+	if r, ok := t[Normalize(code)]; ok {
+		decimals = r.Decimals
+	}
+	p := math.Pow10(decimals)
+	return math.Round(amount*p) / p
+}
+
+// Convert converts amount and rounds it to the precision of to. The rate used is returned
+// so callers can store it next to the converted amount.
+func (t Table) Convert(amount float64, from, to string) (float64, float64, error) {
+	rate, err := t.Rate(from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t.Round(amount*rate, to), rate, nil
+}
+
+// Display converts a set of named amounts from one currency to another
+func (t Table) Display(from, to string, amounts map[string]float64) (*models.DisplayPrice, error) {
+	rate, err := t.Rate(from, to)
+	if err != nil {
+		return nil, err
+	}
+	d := &models.DisplayPrice{Currency: Normalize(to), Rate: rate, Amounts: make(map[string]float64, len(amounts))}
+	for name, amount := range amounts {
+		d.Amounts[name] = t.Round(amount*rate, to)
+	}
+	return d, nil
+}
+
+// ParseFile reads rates from a JSON object ({"USD": 39.8}) or, for .csv files, from
+// currency,rate[,decimals] lines
+func ParseFile(path string) ([]models.ExchangeRate, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []models.ExchangeRate
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		reader := csv.NewReader(strings.NewReader(string(raw)))
+		reader.FieldsPerRecord = -1 // decimals are optional
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			if len(rec) < 2 || (i == 0 && strings.EqualFold(strings.TrimSpace(rec[0]), "currency")) {
+				continue
+			}
+			rate, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			r := models.ExchangeRate{Currency: Normalize(rec[0]), Rate: rate, Decimals: DefaultDecimals(rec[0])}
+			if len(rec) > 2 && strings.TrimSpace(rec[2]) != "" {
+				if r.Decimals, err = strconv.Atoi(strings.TrimSpace(rec[2])); err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+			}
+			rates = append(rates, r)
+		}
+	} else {
+		var values map[string]float64
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, err
+		}
+		for code, rate := range values {
+			rates = append(rates, models.ExchangeRate{Currency: Normalize(code), Rate: rate, Decimals: DefaultDecimals(code)})
+		}
+	}
+
+	for _, r := range rates {
+		if !ValidCode(r.Currency) || r.Rate <= 0 || r.Decimals < 0 || r.Decimals > 4 {
+			return nil, fmt.Errorf("invalid rate %s=%v", r.Currency, r.Rate)
+		}
+	}
+	return rates, nil
+}
+
+// SeedFromFile loads a rates file and upserts every rate it lists. An empty path is a no-op.
+func SeedFromFile(db *gorm.DB, path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	rates, err := ParseFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for i := range rates {
+		rates[i].Source = "file"
+		if err := Save(db, &rates[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(rates), nil
+}
+
+// Save inserts a rate or updates the existing one for its currency
+func Save(db *gorm.DB, rate *models.ExchangeRate) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "decimals", "source", "updated_at", "deleted_at"}),
+	}).Create(rate).Error
+}
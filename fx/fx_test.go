@@ -0,0 +1,67 @@
+package fx
+
+import (
+	"apartments-clone-server/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testTable() Table {
+	return Table{
+		Base:  {Currency: Base, Rate: 1, Decimals: 2},
+		"USD": {Currency: "USD", Rate: 40, Decimals: 2},
+		"XOF": {Currency: "XOF", Rate: 0.0655, Decimals: 0},
+	}
+}
+
+func TestConvertGoesThroughBaseAndRounds(t *testing.T) {
+	table := testTable()
+
+	amount, rate, err := table.Convert(1000, "MRU", "USD")
+	if err != nil || amount != 25 || rate != 0.025 {
+		t.Fatalf("MRU->USD: got %v at %v (%v)", amount, rate, err)
+	}
+
+	// 10 USD = 400 MRU = 6106.87... XOF, rounded to whole francs
+	amount, _, err = table.Convert(10, "usd", "XOF")
+	if err != nil || amount != 6107 {
+		t.Fatalf("USD->XOF: got %v (%v)", amount, err)
+	}
+
+	// Records without a currency are in MRU
+	if amount, _, _ := table.Convert(80, "", "USD"); amount != 2 {
+		t.Fatalf("empty currency: got %v", amount)
+	}
+
+	if _, _, err := table.Convert(10, "USD", "EUR"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Fatalf("expected unknown currency, got %v", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rates.csv")
+	if err := os.WriteFile(path, []byte("currency,rate,decimals\nusd,39.8\nXOF,0.0655,0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := ParseFile(path)
+	if err != nil || len(rates) != 2 {
+		t.Fatalf("unexpected rates %+v (%v)", rates, err)
+	}
+	want := []models.ExchangeRate{{Currency: "USD", Rate: 39.8, Decimals: 2}, {Currency: "XOF", Rate: 0.0655, Decimals: 0}}
+	for i, r := range rates {
+		if r != want[i] {
+			t.Fatalf("rate %d: expected %+v, got %+v", i, want[i], r)
+		}
+	}
+
+	bad := filepath.Join(dir, "rates.json")
+	if err := os.WriteFile(bad, []byte(`{"usd": -1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(bad); err == nil {
+		t.Fatal("expected a negative rate to be rejected")
+	}
+}
@@ -0,0 +1,479 @@
+// Package invoices issues the receipts and credit notes of paid bookings and renders them
+// as PDF. Numbers are sequential per kind and year (INV-2026-000001, CN-2026-000001) and
+// are taken inside the transaction that issues the document, so they have no gaps.
+package invoices
+
+import (
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/pricing"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Invoice kinds and their number prefixes; supplements are receipts for an extra charge and
+// share the receipt series
+const (
+	KindReceipt    = "receipt"
+	KindSupplement = "supplement"
+	KindCreditNote = "credit_note"
+
+	receiptPrefix    = "INV"
+	creditNotePrefix = "CN"
+)
+
+// ErrNotPaid is returned when a receipt is asked for a booking the guest hasn't paid
+var ErrNotPaid = errors.New("booking has not been paid")
+
+// FormatNumber formats the n-th document of a series
+func FormatNumber(prefix string, year int, n int64) string {
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, n)
+}
+
+// nextNumber takes the next number of a series. The counter row stays locked until the
+// surrounding transaction ends, so concurrent issues are serialised.
+func nextNumber(tx *gorm.DB, prefix string, at time.Time) (string, error) {
+	var last int64
+	err := tx.Raw(`INSERT INTO invoice_counters (series, last) VALUES (?, 1)
+		ON CONFLICT (series) DO UPDATE SET last = invoice_counters.last + 1 RETURNING last`,
+		fmt.Sprintf("%s-%d", prefix, at.Year())).Scan(&last).Error
+	if err != nil {
+		return "", err
+	}
+	return FormatNumber(prefix, at.Year(), last), nil
+}
+
+// Receipt returns the receipt of a booking, or nil when none was issued yet
+func Receipt(tx *gorm.DB, subjectType string, subjectID uint) (*models.Invoice, error) {
+	var receipt models.Invoice
+	err := tx.Where("subject_type = ? AND subject_id = ? AND kind = ?", subjectType, subjectID, KindReceipt).First(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// lockedReceipt returns the receipt of a booking like Receipt. When there is none it first
+// locks the booking's row in table until tx ends and looks again, so concurrent requests
+// can't both find no receipt and issue one each.
+func lockedReceipt(tx *gorm.DB, table, subjectType string, subjectID uint) (*models.Invoice, error) {
+	if receipt, err := Receipt(tx, subjectType, subjectID); receipt != nil || err != nil {
+		return receipt, err
+	}
+	if err := tx.Exec("SELECT 1 FROM "+table+" WHERE id = ? FOR UPDATE", subjectID).Error; err != nil {
+		return nil, err
+	}
+	return Receipt(tx, subjectType, subjectID)
+}
+
+// ReservationReceipt returns the receipt of a reservation, issuing it if the stay has been paid
+func ReservationReceipt(tx *gorm.DB, reservationID uint) (*models.Invoice, error) {
+	if receipt, err := lockedReceipt(tx, "reservations", payments.SubjectReservation, reservationID); receipt != nil || err != nil {
+		return receipt, err
+	}
+
+	var reservation models.Reservation
+	if err := tx.Preload("Property").Preload("Property.Host").Preload("Guest").First(&reservation, reservationID).Error; err != nil {
+		return nil, err
+	}
+	paid, err := isPaid(tx, payments.SubjectReservation, reservation.ID, reservation.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !paid || reservation.Property == nil || reservation.Guest == nil {
+		return nil, ErrNotPaid
+	}
+
+	property := reservation.Property
+	receipt := models.Invoice{
+		Kind:        KindReceipt,
+		SubjectType: payments.SubjectReservation,
+		SubjectID:   reservation.ID,
+		GuestID:     reservation.GuestID,
+		HostID:      property.HostID,
+		Seller:      partyJSON(userParty(&property.Host, "")),
+		Buyer:       partyJSON(userParty(reservation.Guest, "")),
+		Description: fmt.Sprintf("Stay at %s, %s to %s", property.Title,
+			reservation.CheckIn.Format("Jan 2, 2006"), reservation.CheckOut.Format("Jan 2, 2006")),
+		Currency: reservation.Currency,
+	}
+	if address := propertyAddress(property); address != "" {
+		receipt.Description += " — " + address
+	}
+	if receipt.Currency == "" {
+		receipt.Currency = property.Currency
+	}
+
+	var lines []models.InvoiceLine
+	if breakdown, err := pricing.Decode(reservation.PriceBreakdown); err == nil && len(breakdown.LineItems) > 0 {
+		lines = ReservationLines(breakdown)
+	} else {
+		// Reservations made before price breakdowns were stored only have a total
+		nights := pricing.Nights(reservation.CheckIn, reservation.CheckOut)
+		lines = []models.InvoiceLine{{
+			Description: fmt.Sprintf("Accommodation (%d nights)", nights),
+			Quantity:    float64(nights),
+			UnitPrice:   round2(float64(reservation.TotalPrice) / float64(nights)),
+			Amount:      round2(float64(reservation.TotalPrice)),
+		}}
+	}
+	if err := issue(tx, &receipt, receiptPrefix, lines); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// ExperienceBookingReceipt returns the receipt of an experience booking, issuing it if needed
+func ExperienceBookingReceipt(tx *gorm.DB, bookingID uint) (*models.Invoice, error) {
+	if receipt, err := lockedReceipt(tx, "experience_bookings", payments.SubjectExperienceBooking, bookingID); receipt != nil || err != nil {
+		return receipt, err
+	}
+
+	var booking models.ExperienceBooking
+	if err := tx.Preload("Experience").Preload("Experience.Host").Preload("Guest").First(&booking, bookingID).Error; err != nil {
+		return nil, err
+	}
+	paid, err := isPaid(tx, payments.SubjectExperienceBooking, booking.ID, booking.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !paid {
+		return nil, ErrNotPaid
+	}
+
+	experience := booking.Experience
+	when := booking.SelectedDate.Format("Jan 2, 2006")
+	if booking.SelectedTime != "" {
+		when += " " + booking.SelectedTime
+	}
+	participants := booking.ParticipantCount
+	if participants < 1 {
+		participants = 1
+	}
+	receipt := models.Invoice{
+		Kind:        KindReceipt,
+		SubjectType: payments.SubjectExperienceBooking,
+		SubjectID:   booking.ID,
+		GuestID:     booking.GuestID,
+		HostID:      experience.HostID,
+		Seller:      partyJSON(userParty(&experience.Host, experience.City)),
+		Buyer:       partyJSON(userParty(&booking.Guest, "")),
+		Description: fmt.Sprintf("%s, %s", experience.Title, when),
+		Currency:    pricing.DefaultCurrency, // experiences are charged in the default currency
+	}
+	// TotalPrice is after the promo code, shown on its own line
+	price := booking.TotalPrice + booking.DiscountAmount
+	lines := []models.InvoiceLine{{
+		Description: experience.Title,
+		Quantity:    float64(participants),
+		UnitPrice:   round2(price / float64(participants)),
+		Amount:      round2(price),
+	}}
+	if booking.DiscountAmount > 0 {
+		lines = append(lines, models.InvoiceLine{Description: "Promo code " + booking.CouponCode, Quantity: 1, Amount: -round2(booking.DiscountAmount)})
+	}
+	if err := issue(tx, &receipt, receiptPrefix, lines); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// IssueCreditNote records a refund against the receipt of a booking, issuing the receipt
+// first if needed. Bookings that were never paid (a voided authorization) and security
+// deposits get nothing, and the credit never exceeds what is left of the receipt.
+// It returns nil when no credit note was issued.
+func IssueCreditNote(tx *gorm.DB, subjectType string, subjectID uint, refund float64, reason string) (*models.Invoice, error) {
+	refund = round2(refund)
+	if refund <= 0 {
+		return nil, nil
+	}
+
+	var receipt *models.Invoice
+	var err error
+	switch subjectType {
+	case payments.SubjectReservation:
+		receipt, err = ReservationReceipt(tx, subjectID)
+	case payments.SubjectExperienceBooking:
+		receipt, err = ExperienceBookingReceipt(tx, subjectID)
+	default:
+		return nil, nil
+	}
+	if errors.Is(err, ErrNotPaid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	billed, err := billedOn(tx, receipt)
+	if err != nil {
+		return nil, err
+	}
+	refund = math.Min(refund, round2(billed.Total-billed.Credited))
+	if refund <= 0 {
+		return nil, nil
+	}
+
+	note := models.Invoice{
+		Kind:        KindCreditNote,
+		SubjectType: receipt.SubjectType,
+		SubjectID:   receipt.SubjectID,
+		ReceiptID:   &receipt.ID,
+		GuestID:     receipt.GuestID,
+		HostID:      receipt.HostID,
+		Seller:      receipt.Seller,
+		Buyer:       receipt.Buyer,
+		Description: fmt.Sprintf("Refund on %s: %s", receipt.Number, receipt.Description),
+		Currency:    receipt.Currency,
+		Reason:      reason,
+	}
+	if err := issue(tx, &note, creditNotePrefix, CreditLines(billed.Total, billed.Tax, refund)); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// IssueSupplement records an extra charge on a paid booking, such as the price difference of a
+// longer stay, as a supplement to its receipt. tax is the booking's tax after the change; the
+// supplement bills the part of it not billed yet. Bookings without a receipt get nothing: theirs
+// is issued at the new price once they are paid. It returns nil when nothing was issued.
+func IssueSupplement(tx *gorm.DB, subjectType string, subjectID uint, amount, tax float64, reason string) (*models.Invoice, error) {
+	amount = round2(amount)
+	if amount <= 0 {
+		return nil, nil
+	}
+	receipt, err := Receipt(tx, subjectType, subjectID)
+	if receipt == nil || err != nil {
+		return nil, err
+	}
+	billed, err := billedOn(tx, receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	supplement := models.Invoice{
+		Kind:        KindSupplement,
+		SubjectType: receipt.SubjectType,
+		SubjectID:   receipt.SubjectID,
+		ReceiptID:   &receipt.ID,
+		GuestID:     receipt.GuestID,
+		HostID:      receipt.HostID,
+		Seller:      receipt.Seller,
+		Buyer:       receipt.Buyer,
+		Description: fmt.Sprintf("Supplement to %s: %s", receipt.Number, receipt.Description),
+		Currency:    receipt.Currency,
+		Reason:      reason,
+	}
+	if err := issue(tx, &supplement, receiptPrefix, SupplementLines(amount, tax-(billed.Tax-billed.CreditedTax))); err != nil {
+		return nil, err
+	}
+	return &supplement, nil
+}
+
+// SupplementLines splits an extra charge between the stay and the tax still owed on it
+func SupplementLines(amount, taxOwed float64) []models.InvoiceLine {
+	tax := round2(math.Min(math.Max(taxOwed, 0), amount))
+	lines := []models.InvoiceLine{{Description: "Price difference", Quantity: 1, UnitPrice: round2(amount - tax), Amount: round2(amount - tax)}}
+	if tax > 0 {
+		lines = append(lines, models.InvoiceLine{Description: "Tax on the difference", Quantity: 1, UnitPrice: tax, Amount: tax, Tax: true})
+	}
+	return lines
+}
+
+// billed is what was billed against a receipt: Total and Tax add its supplements to it,
+// Credited and CreditedTax are its credit notes
+type billed struct {
+	Total, Tax, Credited, CreditedTax float64
+}
+
+func billedOn(tx *gorm.DB, receipt *models.Invoice) (billed, error) {
+	var b billed
+	err := tx.Model(&models.Invoice{}).Where("receipt_id = ?", receipt.ID).
+		Select(`COALESCE(SUM(CASE WHEN kind = ? THEN total END), 0) AS total,
+			COALESCE(SUM(CASE WHEN kind = ? THEN tax_amount END), 0) AS tax,
+			COALESCE(SUM(CASE WHEN kind = ? THEN total END), 0) AS credited,
+			COALESCE(SUM(CASE WHEN kind = ? THEN tax_amount END), 0) AS credited_tax`,
+			KindSupplement, KindSupplement, KindCreditNote, KindCreditNote).
+		Scan(&b).Error
+	b.Total += receipt.Total
+	b.Tax += receipt.TaxAmount
+	return b, err
+}
+
+// ReservationLines turns a price breakdown into invoice lines: nights are grouped into one
+// accommodation line, other items with the same label are added up, the held security
+// deposit is left out and taxes become tax lines
+func ReservationLines(b *pricing.Breakdown) []models.InvoiceLine {
+	var lines []models.InvoiceLine
+	index := map[string]int{}
+	add := func(key string, line models.InvoiceLine) {
+		if i, ok := index[key]; ok {
+			lines[i].Quantity += line.Quantity
+			lines[i].Amount = round2(lines[i].Amount + line.Amount)
+			return
+		}
+		index[key] = len(lines)
+		lines = append(lines, line)
+	}
+
+	for _, item := range b.LineItems {
+		if item.Held {
+			continue
+		}
+		switch item.Type {
+		case pricing.LineNightly, pricing.LineWeekendUplift, pricing.LinePriceRule:
+			add("nights", models.InvoiceLine{Description: "Accommodation", Amount: item.Amount})
+		case pricing.LineTax:
+			add("tax:"+item.Label, models.InvoiceLine{Description: item.Label, Quantity: 1, Amount: item.Amount, Tax: true})
+		default:
+			add(item.Type+":"+item.Label, models.InvoiceLine{Description: item.Label, Quantity: 1, Amount: item.Amount})
+		}
+	}
+
+	if i, ok := index["nights"]; ok {
+		lines[i].Description = fmt.Sprintf("Accommodation (%d nights)", b.Nights)
+		lines[i].Quantity = float64(b.Nights)
+	}
+	for i := range lines {
+		if lines[i].Quantity > 0 {
+			lines[i].UnitPrice = round2(lines[i].Amount / lines[i].Quantity)
+		}
+	}
+	return lines
+}
+
+// CreditLines splits a refund between the stay and its taxes in proportion to the receipt
+func CreditLines(receiptTotal, receiptTax, refund float64) []models.InvoiceLine {
+	tax := 0.0
+	if receiptTotal > 0 {
+		tax = round2(refund * receiptTax / receiptTotal)
+	}
+	lines := []models.InvoiceLine{{Description: "Refund", Quantity: 1, UnitPrice: round2(refund - tax), Amount: round2(refund - tax)}}
+	if tax > 0 {
+		lines = append(lines, models.InvoiceLine{Description: "Tax refund", Quantity: 1, UnitPrice: tax, Amount: tax, Tax: true})
+	}
+	return lines
+}
+
+// Party reads a party stored on an invoice
+func Party(raw datatypes.JSON) models.InvoiceParty {
+	var party models.InvoiceParty
+	_ = json.Unmarshal(raw, &party)
+	return party
+}
+
+// Lines reads the lines stored on an invoice
+func Lines(raw datatypes.JSON) []models.InvoiceLine {
+	var lines []models.InvoiceLine
+	_ = json.Unmarshal(raw, &lines)
+	return lines
+}
+
+// issue numbers an invoice, totals its lines and saves it
+func issue(tx *gorm.DB, invoice *models.Invoice, prefix string, lines []models.InvoiceLine) error {
+	invoice.IssuedAt = time.Now()
+	number, err := nextNumber(tx, prefix, invoice.IssuedAt)
+	if err != nil {
+		return err
+	}
+	invoice.Number = number
+
+	invoice.Subtotal, invoice.TaxAmount = 0, 0
+	for _, line := range lines {
+		if line.Tax {
+			invoice.TaxAmount += line.Amount
+		} else {
+			invoice.Subtotal += line.Amount
+		}
+	}
+	invoice.Subtotal = round2(invoice.Subtotal)
+	invoice.TaxAmount = round2(invoice.TaxAmount)
+	invoice.Total = round2(invoice.Subtotal + invoice.TaxAmount)
+	raw, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	invoice.Lines = datatypes.JSON(raw)
+	return tx.Create(invoice).Error
+}
+
+// isPaid reports whether the guest was charged for a booking. Bookings from before
+// payments were recorded count as paid once confirmed.
+func isPaid(tx *gorm.DB, subjectType string, subjectID uint, status string) (bool, error) {
+	var intents, captured int64
+	if err := tx.Model(&models.PaymentIntent{}).Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Count(&intents).Error; err != nil {
+		return false, err
+	}
+	if intents == 0 {
+		return status == "confirmed" || status == "completed", nil
+	}
+	if err := tx.Model(&models.PaymentIntent{}).Where("subject_type = ? AND subject_id = ? AND captured_at IS NOT NULL", subjectType, subjectID).
+		Count(&captured).Error; err != nil {
+		return false, err
+	}
+	return captured > 0, nil
+}
+
+func userParty(user *models.User, address string) models.InvoiceParty {
+	if user == nil {
+		return models.InvoiceParty{}
+	}
+	return models.InvoiceParty{
+		Name:    strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Email:   user.Email,
+		Phone:   user.PhoneNumber,
+		Address: address,
+	}
+}
+
+func partyJSON(party models.InvoiceParty) datatypes.JSON {
+	raw, _ := json.Marshal(party)
+	return datatypes.JSON(raw)
+}
+
+func propertyAddress(p *models.Property) string {
+	var parts []string
+	for _, s := range []string{p.AddressLine1, p.AddressLine2, p.City, p.Country} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatAmount prints an amount with the currency's decimals and thousands separators
+func formatAmount(amount float64, currency string) string {
+	decimals := fx.DefaultDecimals(currency)
+	s := fmt.Sprintf("%.*f", decimals, math.Abs(amount))
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	var b strings.Builder
+	if amount < 0 && s != fmt.Sprintf("%.*f", decimals, 0.0) {
+		b.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + frac + " " + currency
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
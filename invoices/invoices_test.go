@@ -0,0 +1,125 @@
+package invoices
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/pricing"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+func TestReservationLinesGroupNightsAndTaxes(t *testing.T) {
+	b := &pricing.Breakdown{
+		Nights: 3,
+		LineItems: []pricing.LineItem{
+			{Type: pricing.LineNightly, Label: "Night", Amount: 100},
+			{Type: pricing.LineNightly, Label: "Night", Amount: 100},
+			{Type: pricing.LineWeekendUplift, Label: "Weekend", Amount: 20},
+			{Type: pricing.LineNightly, Label: "Night", Amount: 100},
+			{Type: pricing.LineCleaningFee, Label: "Cleaning fee", Amount: 30},
+			{Type: pricing.LineDiscount, Label: "Weekly", Amount: -16},
+			{Type: pricing.LineTax, Label: "City tax", Amount: 9},
+			{Type: pricing.LineSecurityDeposit, Label: "Security deposit", Amount: 200, Held: true},
+		},
+	}
+
+	lines := ReservationLines(b)
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %+v", lines)
+	}
+	if l := lines[0]; l.Description != "Accommodation (3 nights)" || l.Quantity != 3 || l.Amount != 320 || l.UnitPrice != 106.67 {
+		t.Fatalf("accommodation line: %+v", l)
+	}
+	if l := lines[2]; l.Amount != -16 || l.Tax {
+		t.Fatalf("discount line: %+v", l)
+	}
+	if l := lines[3]; l.Description != "City tax" || !l.Tax || l.Amount != 9 {
+		t.Fatalf("tax line: %+v", l)
+	}
+}
+
+func TestCreditLinesSplitTaxProRata(t *testing.T) {
+	lines := CreditLines(400, 40, 200)
+	if len(lines) != 2 || lines[0].Amount != 180 || lines[1].Amount != 20 || !lines[1].Tax {
+		t.Fatalf("unexpected credit lines: %+v", lines)
+	}
+	if lines := CreditLines(400, 0, 200); len(lines) != 1 || lines[0].Amount != 200 {
+		t.Fatalf("untaxed refund: %+v", lines)
+	}
+}
+
+func TestSupplementLinesBillOwedTax(t *testing.T) {
+	lines := SupplementLines(150, 12)
+	if len(lines) != 2 || lines[0].Amount != 138 || lines[1].Amount != 12 || !lines[1].Tax {
+		t.Fatalf("unexpected supplement lines: %+v", lines)
+	}
+	// Tax already billed in full, or more than the charge itself
+	if lines := SupplementLines(150, -5); len(lines) != 1 || lines[0].Amount != 150 {
+		t.Fatalf("untaxed supplement: %+v", lines)
+	}
+	if lines := SupplementLines(10, 40); lines[0].Amount != 0 || lines[1].Amount != 10 {
+		t.Fatalf("capped tax: %+v", lines)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	cases := map[string]string{
+		formatAmount(1234567.5, "MRU"): "1 234 567.50 MRU",
+		formatAmount(-16, "MRU"):       "-16.00 MRU",
+		formatAmount(6107, "XOF"):      "6 107 XOF",
+		formatAmount(-0.001, "MRU"):    "0.00 MRU",
+	}
+	for got, want := range cases {
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRenderProducesValidPDF(t *testing.T) {
+	lines, _ := json.Marshal([]models.InvoiceLine{
+		{Description: "Accommodation (2 nights)", Quantity: 2, UnitPrice: 150, Amount: 300},
+		{Description: "Taxe de séjour", Quantity: 1, UnitPrice: 10, Amount: 10, Tax: true},
+	})
+	party, _ := json.Marshal(models.InvoiceParty{Name: "Aïcha (host)", Email: "host@example.com"})
+	invoice := &models.Invoice{
+		Number:      "CN-2026-000001",
+		Kind:        KindCreditNote,
+		Seller:      datatypes.JSON(party),
+		Buyer:       datatypes.JSON(party),
+		Description: "Refund on INV-2026-000001",
+		Lines:       datatypes.JSON(lines),
+		Currency:    "MRU",
+		Subtotal:    300,
+		TaxAmount:   10,
+		Total:       310,
+		Reason:      "Cancelled 10 days before check-in",
+		IssuedAt:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	out := Render(invoice, "INV-2026-000001")
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF: %q...", out[:20])
+	}
+	if !bytes.Contains(out, []byte(`(CREDIT NOTE)`)) || !bytes.Contains(out, []byte("A\xefcha \\(host\\)")) {
+		t.Fatal("expected the title and the WinAnsi-encoded, escaped host name")
+	}
+
+	// Every xref entry must point at the start of its object
+	start, _ := strconv.Atoi(string(regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)[1]))
+	if !bytes.HasPrefix(out[start:], []byte("xref\n")) {
+		t.Fatal("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[start:], -1)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, out[offset:offset+10])
+		}
+	}
+}
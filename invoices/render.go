@@ -0,0 +1,138 @@
+package invoices
+
+import (
+	"apartments-clone-server/models"
+	"strconv"
+)
+
+const (
+	margin       = 50.0
+	bottomMargin = 80.0
+	lineHeight   = 16.0
+
+	// Right edges of the line item columns
+	colQuantity = 360.0
+	colUnit     = 460.0
+	colAmount   = PageWidth - margin
+)
+
+// Render lays out an invoice as a PDF. receiptNumber is the number of the receipt a supplement
+// or credit note refers to, empty for receipts.
+func Render(invoice *models.Invoice, receiptNumber string) []byte {
+	title := "RECEIPT"
+	switch invoice.Kind {
+	case KindSupplement:
+		title = "SUPPLEMENTARY RECEIPT"
+	case KindCreditNote:
+		title = "CREDIT NOTE"
+	}
+	doc := &Document{Title: title + " " + invoice.Number}
+	page := doc.AddPage()
+
+	y := PageHeight - margin - 20
+	page.Text(margin, y, 22, true, title)
+	page.TextRight(colAmount, y, 11, true, invoice.Number)
+	y -= lineHeight
+	page.TextRight(colAmount, y, 9, false, "Issued "+invoice.IssuedAt.Format("January 2, 2006"))
+	if receiptNumber != "" {
+		y -= lineHeight - 4
+		if invoice.Kind == KindSupplement {
+			page.TextRight(colAmount, y, 9, false, "Supplements receipt "+receiptNumber)
+		} else {
+			page.TextRight(colAmount, y, 9, false, "Corrects receipt "+receiptNumber)
+		}
+	}
+
+	// Host and guest side by side
+	y -= 2 * lineHeight
+	partyTop := y
+	bottom := drawParty(page, margin, partyTop, "FROM (HOST)", Party(invoice.Seller))
+	if b := drawParty(page, PageWidth/2, partyTop, "BILLED TO", Party(invoice.Buyer)); b < bottom {
+		bottom = b
+	}
+	y = bottom - lineHeight
+
+	page.Text(margin, y, 10, true, Truncate(invoice.Description, PageWidth-2*margin, 10, true))
+	y -= 1.5 * lineHeight
+
+	// Line items
+	header := func(p *Page, y float64) {
+		p.Box(margin, y-5, PageWidth-2*margin, lineHeight+2, 0.9)
+		p.Text(margin+5, y, 9, true, "Description")
+		p.TextRight(colQuantity, y, 9, true, "Qty")
+		p.TextRight(colUnit, y, 9, true, "Unit price")
+		p.TextRight(colAmount-5, y, 9, true, "Amount")
+	}
+	header(page, y)
+	y -= lineHeight + 4
+
+	lines := Lines(invoice.Lines)
+	var taxes []models.InvoiceLine
+	for _, line := range lines {
+		if line.Tax {
+			taxes = append(taxes, line)
+			continue
+		}
+		if y < bottomMargin {
+			page = doc.AddPage()
+			y = PageHeight - margin - 20
+			header(page, y)
+			y -= lineHeight + 4
+		}
+		page.Text(margin+5, y, 9, false, Truncate(line.Description, colQuantity-margin-60, 9, false))
+		page.TextRight(colQuantity, y, 9, false, formatQuantity(line.Quantity))
+		page.TextRight(colUnit, y, 9, false, formatAmount(line.UnitPrice, invoice.Currency))
+		page.TextRight(colAmount-5, y, 9, false, formatAmount(line.Amount, invoice.Currency))
+		y -= lineHeight
+	}
+
+	// Totals
+	if y < bottomMargin+float64(len(taxes)+3)*lineHeight {
+		page = doc.AddPage()
+		y = PageHeight - margin - 20
+	}
+	page.Line(colQuantity-60, y+lineHeight-6, colAmount, y+lineHeight-6, 0.5)
+	total := func(label, amount string, bold bool) {
+		page.TextRight(colUnit, y, 9, bold, label)
+		page.TextRight(colAmount-5, y, 9, bold, amount)
+		y -= lineHeight
+	}
+	total("Subtotal", formatAmount(invoice.Subtotal, invoice.Currency), false)
+	for _, tax := range taxes {
+		total(Truncate(tax.Description, colUnit-colQuantity+40, 9, false), formatAmount(tax.Amount, invoice.Currency), false)
+	}
+	label := "Total paid"
+	if invoice.Kind == KindCreditNote {
+		label = "Total refunded"
+	}
+	total(label, formatAmount(invoice.Total, invoice.Currency), true)
+
+	if invoice.Reason != "" {
+		y -= lineHeight
+		page.Text(margin, y, 9, false, Truncate("Reason: "+invoice.Reason, PageWidth-2*margin, 9, false))
+	}
+
+	page.Line(margin, bottomMargin-30, colAmount, bottomMargin-30, 0.5)
+	page.Text(margin, bottomMargin-45, 8, false, "All amounts in "+invoice.Currency+". Payment collected by the platform on behalf of the host.")
+	return doc.Bytes()
+}
+
+// drawParty writes a name and contact block and returns the baseline below it
+func drawParty(page *Page, x, y float64, heading string, party models.InvoiceParty) float64 {
+	width := PageWidth/2 - margin - 10
+	page.Text(x, y, 8, true, heading)
+	y -= lineHeight
+	page.Text(x, y, 10, true, Truncate(party.Name, width, 10, true))
+	for _, s := range []string{party.Address, party.Email, party.Phone} {
+		if s == "" {
+			continue
+		}
+		y -= lineHeight - 3
+		page.Text(x, y, 9, false, Truncate(s, width, 9, false))
+	}
+	return y
+}
+
+func formatQuantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SettleSecurityDeposits releases deposits nobody claimed before the deadline and settles
+// claims the guest neither accepted nor disputed within the dispute window
+func SettleSecurityDeposits(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	var deposits []models.SecurityDeposit
+	if err := storage.DB.WithContext(ctx).
+		Where("(status = ? AND claim_deadline < ?) OR (status = ? AND claimed_at < ?)",
+			services.DepositHeld, now, services.DepositClaimed, now.Add(-services.DepositClaimWindow())).
+		Find(&deposits).Error; err != nil {
+		return 0, err
+	}
+
+	var settled int64
+	for _, d := range deposits {
+		err := payments.Transaction(storage.DB.WithContext(ctx), func(tx *gorm.DB) error {
+			deposit, err := services.LockDeposit(tx, d.ID)
+			if err != nil {
+				return err
+			}
+			switch deposit.Status {
+			case services.DepositHeld:
+				return services.ReleaseSecurityDeposit(tx, deposit, "No claim before the deadline")
+			case services.DepositClaimed:
+				return services.SettleSecurityDeposit(tx, deposit, deposit.ClaimAmount, "Claim not disputed in time", nil)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ DEPOSIT: deposit %d not settled: %v", d.ID, err)
+			continue
+		}
+		settled++
+	}
+	return settled, nil
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"context"
+	"time"
+)
+
+// PurgeExpiredChatMessages deletes group chat messages past their ExpiresAt
+func PurgeExpiredChatMessages(ctx context.Context) (int64, error) {
+	result := storage.DB.WithContext(ctx).
+		Where("expires_at IS NOT NULL AND expires_at < ?", time.Now()).
+		Delete(&models.ChatMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeExpiredQuotes deletes price quotes that expired a day ago without being booked; the day
+// lets a late booking attempt still be answered with a fresh price
+func PurgeExpiredQuotes(ctx context.Context) (int64, error) {
+	result := storage.DB.WithContext(ctx).Unscoped().
+		Where("expires_at < ? AND consumed_at IS NULL AND reservation_id IS NULL", time.Now().Add(-24*time.Hour)).
+		Delete(&models.PriceQuote{})
+	return result.RowsAffected, result.Error
+}
+
+// ExpireExperienceInvites expires pending invites past their ExpiresAt
+func ExpireExperienceInvites(ctx context.Context) (int64, error) {
+	result := storage.DB.WithContext(ctx).Model(&models.ExperienceInvite{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", "pending", time.Now()).
+		Update("status", "expired")
+	return result.RowsAffected, result.Error
+}
+
+// ExpireExperienceGroups expires groups that were never booked or cancelled before their ExpiresAt
+func ExpireExperienceGroups(ctx context.Context) (int64, error) {
+	result := storage.DB.WithContext(ctx).Model(&models.ExperienceGroup{}).
+		Where("status IN ? AND expires_at IS NOT NULL AND expires_at < ?", []string{"pending", "ready"}, time.Now()).
+		Update("status", "expired")
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+// Default is the scheduler started from main with every recurring job registered
+var Default = NewScheduler()
+
+func init() {
+	Default.Register(Job{Name: "expire_pending_reservations", Interval: 5 * time.Minute, Run: ExpirePendingReservations})
+	Default.Register(Job{Name: "complete_finished_stays", Interval: 15 * time.Minute, Run: CompleteFinishedStays})
+	Default.Register(Job{Name: "settle_security_deposits", Interval: time.Hour, Run: SettleSecurityDeposits})
+	Default.Register(Job{Name: "pay_out_hosts", Interval: time.Hour, Run: PayOutHosts})
+	Default.Register(Job{Name: "check_in_reminders", Interval: 15 * time.Minute, Run: SendCheckInReminders})
+	Default.Register(Job{Name: "purge_expired_chat_messages", Interval: time.Hour, Run: PurgeExpiredChatMessages})
+	Default.Register(Job{Name: "purge_expired_quotes", Interval: time.Hour, Run: PurgeExpiredQuotes})
+	Default.Register(Job{Name: "expire_experience_invites", Interval: 15 * time.Minute, Run: ExpireExperienceInvites})
+	Default.Register(Job{Name: "expire_experience_groups", Interval: 15 * time.Minute, Run: ExpireExperienceGroups})
+	Default.Register(Job{Name: "expire_waitlist_claims", Interval: 15 * time.Minute, Run: ExpireWaitlistClaims})
+}
+
+// Start runs the default scheduler until ctx is cancelled
+func Start(ctx context.Context) {
+	Default.Start(ctx)
+}
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReminderLeadTime is how long before check-in guests get their reminder
+const ReminderLeadTime = 24 * time.Hour
+
+// ExpirePendingReservations expires reservation requests the host did not answer in time,
+// releases the guest's payment authorization and promo code and offers the nights to the waitlist
+func ExpirePendingReservations(ctx context.Context) (int64, error) {
+	var pending []models.Reservation
+	if err := storage.DB.WithContext(ctx).Select("id, status, property_id, check_in, check_out").
+		Where("status = ? AND expires_at < ?", services.ReservationPending, time.Now()).
+		Find(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	var expired int64
+	for i := range pending {
+		reservation := &pending[i]
+		err := payments.Transaction(storage.DB.WithContext(ctx), func(tx *gorm.DB) error {
+			if err := services.TransitionReservation(tx, reservation, services.ReservationExpired, services.SystemActor, "the host did not answer in time"); err != nil {
+				return err
+			}
+			if _, err := payments.Release(tx, payments.SubjectReservation, reservation.ID, 0, "reservation expired"); err != nil {
+				return err
+			}
+			return coupons.Release(tx, payments.SubjectReservation, reservation.ID)
+		})
+		if errors.Is(err, services.ErrStatusChanged) {
+			// The host answered in the meantime
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+		if _, err := services.NotifyWaitlist(storage.DB.WithContext(ctx), reservation.PropertyID, reservation.CheckIn, reservation.CheckOut); err != nil {
+			log.Printf("❌ WAITLIST: property %d not offered to the waitlist: %v", reservation.PropertyID, err)
+		}
+	}
+	return expired, nil
+}
+
+// CompleteFinishedStays marks confirmed reservations as completed once checkout has passed
+func CompleteFinishedStays(ctx context.Context) (int64, error) {
+	var finished []models.Reservation
+	if err := storage.DB.WithContext(ctx).Select("id, status").
+		Where("status = ? AND check_out < ?", services.ReservationConfirmed, time.Now()).
+		Find(&finished).Error; err != nil {
+		return 0, err
+	}
+
+	var completed int64
+	for i := range finished {
+		err := storage.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return services.TransitionReservation(tx, &finished[i], services.ReservationCompleted, services.SystemActor, "checkout passed")
+		})
+		if errors.Is(err, services.ErrStatusChanged) {
+			continue
+		}
+		if err != nil {
+			return completed, err
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// SendCheckInReminders notifies guests whose confirmed stay starts within ReminderLeadTime.
+// Each reservation is reminded once.
+func SendCheckInReminders(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	var reservations []models.Reservation
+	if err := storage.DB.WithContext(ctx).Preload("Property").
+		Where("status = ? AND reminder_sent_at IS NULL AND check_in > ? AND check_in <= ?", "confirmed", now, now.Add(ReminderLeadTime)).
+		Find(&reservations).Error; err != nil {
+		return 0, err
+	}
+
+	notificationService := services.NewNotificationService()
+	var sent int64
+	for _, reservation := range reservations {
+		// Mark first so a slow push provider can't cause a second reminder on the next tick
+		result := storage.DB.WithContext(ctx).Model(&models.Reservation{}).
+			Where("id = ? AND reminder_sent_at IS NULL", reservation.ID).
+			Update("reminder_sent_at", now)
+		if result.Error != nil {
+			return sent, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		title := ""
+		if reservation.Property != nil {
+			title = reservation.Property.Title
+		}
+		daysUntil := int(math.Ceil(reservation.CheckIn.Sub(now).Hours() / 24))
+		if err := notificationService.SendReminderNotificationToGuest(reservation.ID, reservation.PropertyID, reservation.GuestID, title, daysUntil); err != nil {
+			log.Printf("⚠️ REMINDER: push for reservation %d not delivered: %v", reservation.ID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// PayOutHosts pays hosts for captured payments once the stay is completed or cancelled with part
+// of the payment kept, the experience date has passed or a security deposit claim is settled.
+// PayOut sends the host's share of what is left after refunds, so a cancelled stay pays only
+// what the guest didn't get back.
+func PayOutHosts(ctx context.Context) (int64, error) {
+	var intents []models.PaymentIntent
+	if err := storage.DB.WithContext(ctx).
+		Where("paid_out_at IS NULL AND status IN ?", []string{payments.StatusCaptured, payments.StatusPartiallyRefunded}).
+		Where(`(subject_type = ? AND (subject_id IN (SELECT id FROM reservations WHERE status = 'completed')
+				OR (captured_amount > refunded_amount AND subject_id IN (SELECT id FROM reservations WHERE status = 'cancelled'))))
+			OR (subject_type = ? AND subject_id IN (SELECT id FROM experience_bookings WHERE status <> 'cancelled' AND selected_date < ?))
+			OR (subject_type = ? AND subject_id IN (SELECT id FROM security_deposits WHERE status = 'settled'))`,
+			payments.SubjectReservation, payments.SubjectExperienceBooking, time.Now().AddDate(0, 0, -1), payments.SubjectSecurityDeposit).
+		Find(&intents).Error; err != nil {
+		return 0, err
+	}
+
+	var paid int64
+	for i := range intents {
+		err := payments.Transaction(storage.DB.WithContext(ctx), func(tx *gorm.DB) error {
+			intent, err := payments.IntentFor(tx, intents[i].SubjectType, intents[i].SubjectID)
+			if err != nil {
+				return err
+			}
+			if intent.PaidOutAt != nil {
+				return nil
+			}
+			_, err = payments.PayOut(tx, intent)
+			return err
+		})
+		if err != nil {
+			log.Printf("❌ PAYOUT: intent %d failed: %v", intents[i].ID, err)
+			continue
+		}
+		paid++
+	}
+	return paid, nil
+}
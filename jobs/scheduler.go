@@ -0,0 +1,229 @@
+// Package jobs runs recurring background work (reservation lifecycle, housekeeping)
+// inside the API process. Every run takes a Redis lock, or a Postgres advisory lock
+// without Redis, so that only one server instance executes a given job at a time, and
+// is recorded as a models.JobRun.
+package jobs
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrLocked is returned by RunNow when another instance is already running the job
+var ErrLocked = errors.New("job is already running")
+
+// ErrUnknownJob is returned by RunNow for a name that was never registered
+var ErrUnknownJob = errors.New("unknown job")
+
+// Job is a unit of recurring work. Run returns how many rows it affected.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (int64, error)
+}
+
+// Scheduler runs registered jobs on their own interval
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     []Job
+	instance string
+}
+
+// NewScheduler creates an empty scheduler
+func NewScheduler() *Scheduler {
+	instance, _ := os.Hostname()
+	return &Scheduler{instance: fmt.Sprintf("%s-%d", instance, os.Getpid())}
+}
+
+// Register adds a job; it must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs returns the registered jobs
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Job(nil), s.jobs...)
+}
+
+// Start launches one goroutine per job. Each job runs once shortly after start and
+// then on every tick until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.Jobs() {
+		go s.loop(ctx, job)
+	}
+	log.Printf("⏰ Scheduler started with %d jobs", len(s.Jobs()))
+}
+
+// RunNow executes a registered job immediately, honouring the cross-instance lock
+func (s *Scheduler) RunNow(ctx context.Context, name string) (*models.JobRun, error) {
+	for _, job := range s.Jobs() {
+		if job.Name == name {
+			return s.execute(ctx, job)
+		}
+	}
+	return nil, ErrUnknownJob
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.execute(ctx, job); err != nil && !errors.Is(err, ErrLocked) {
+			log.Printf("❌ JOB %s failed: %v", job.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) execute(ctx context.Context, job Job) (*models.JobRun, error) {
+	if storage.DB == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	release, err := s.lock(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	run := models.JobRun{Name: job.Name, Instance: s.instance, Status: "running", StartedAt: time.Now()}
+	if err := storage.DB.Create(&run).Error; err != nil {
+		log.Printf("⚠️ JOB %s: could not record the run: %v", job.Name, err)
+	}
+
+	affected, runErr := safeRun(ctx, job)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Affected = affected
+	run.Status = "succeeded"
+	if runErr != nil {
+		run.Status = "failed"
+		run.Error = runErr.Error()
+	}
+	if err := storage.DB.Save(&run).Error; err != nil {
+		log.Printf("⚠️ JOB %s: could not record the run result (%s, %d affected): %v", job.Name, run.Status, affected, err)
+	}
+
+	return &run, runErr
+}
+
+// safeRun keeps a panicking job from taking the scheduler (and the server) down
+func safeRun(ctx context.Context, job Job) (affected int64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// releaseScript deletes the lock only if this instance still owns it
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// extendScript renews the lock's expiry only if this instance still owns it
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// lockTTL is how long a job lock outlives its last renewal; the running instance renews it
+// every third of that, so a long run keeps it and a crashed instance loses it within lockTTL
+const lockTTL = time.Minute
+
+// lock takes jobs:lock:<name> for lockTTL and renews it until released, so a run longer
+// than lockTTL or the job's interval doesn't overlap another instance's. Without Redis, or
+// when it can't be reached, it takes the Postgres advisory lock of the same name instead.
+func (s *Scheduler) lock(ctx context.Context, job Job) (func(), error) {
+	key := "jobs:lock:" + job.Name
+	if storage.Redis == nil {
+		return advisoryLock(ctx, key)
+	}
+
+	token := fmt.Sprintf("%s-%d", s.instance, time.Now().UnixNano())
+	ok, err := storage.Redis.SetNX(ctx, key, token, lockTTL).Result()
+	if err != nil {
+		log.Printf("⚠️ JOB %s: Redis unavailable, using the database lock: %v", job.Name, err)
+		return advisoryLock(ctx, key)
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := extendScript.Run(context.Background(), storage.Redis, []string{key}, token, lockTTL.Milliseconds()).Err(); err != nil {
+					log.Printf("⚠️ JOB %s: could not renew the lock: %v", job.Name, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		releaseScript.Run(context.Background(), storage.Redis, []string{key}, token)
+	}, nil
+}
+
+// advisoryLock takes the Postgres advisory lock of key on a connection of its own, which holds
+// it until released; if the instance dies the connection closes and the lock goes with it
+func advisoryLock(ctx context.Context, key string) (func(), error) {
+	db, err := storage.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, ErrLocked
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			log.Printf("⚠️ JOB lock %s: could not release: %v", key, err)
+		}
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"context"
+	"time"
+)
+
+// ExpireWaitlistClaims closes waitlist claims nobody booked in time and offers their nights to
+// the next guests in line. Entries whose check-in has passed expire too.
+func ExpireWaitlistClaims(ctx context.Context) (int64, error) {
+	now := time.Now()
+	db := storage.DB.WithContext(ctx)
+
+	var lapsed []models.WaitlistEntry
+	if err := db.Where("status = ? AND claim_expires_at < ?", services.WaitlistNotified, now).
+		Find(&lapsed).Error; err != nil {
+		return 0, err
+	}
+
+	var expired int64
+	for _, entry := range lapsed {
+		result := db.Model(&models.WaitlistEntry{}).
+			Where("id = ? AND status = ?", entry.ID, services.WaitlistNotified).
+			Update("status", services.WaitlistExpired)
+		if result.Error != nil {
+			return expired, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		expired += result.RowsAffected
+		if _, err := services.NotifyWaitlist(db, entry.PropertyID, entry.CheckIn, entry.CheckOut); err != nil {
+			return expired, err
+		}
+	}
+
+	result := db.Model(&models.WaitlistEntry{}).
+		Where("status = ? AND check_in < ?", services.WaitlistWaiting, services.DayStart(now)).
+		Update("status", services.WaitlistExpired)
+	return expired + result.RowsAffected, result.Error
+}
@@ -379,9 +379,13 @@
 package main
 
 import (
+	"apartments-clone-server/cancellation"
+	"apartments-clone-server/fx"
+	"apartments-clone-server/jobs"
 	"apartments-clone-server/routes"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -417,6 +421,12 @@ func main() {
 			}
 		}()
 		storage.InitializeDB()
+		if err := cancellation.SeedPresets(storage.DB); err != nil {
+			fmt.Printf("⚠️  Failed to seed cancellation presets: %v\n", err)
+		}
+		if _, err := fx.SeedFromFile(storage.DB, os.Getenv("EXCHANGE_RATES_FILE")); err != nil {
+			fmt.Printf("⚠️  Failed to load exchange rates: %v\n", err)
+		}
 		fmt.Println("✅ Database initialized successfully")
 	}()
 
@@ -444,6 +454,12 @@ func main() {
 		fmt.Println("✅ Redis initialized successfully")
 	}()
 
+	// Background jobs (reservation lifecycle, housekeeping); set DISABLE_JOBS to run without them
+	if os.Getenv("DISABLE_JOBS") == "" {
+		fmt.Println("🔧 Starting job scheduler...")
+		jobs.Start(context.Background())
+	}
+
 	fmt.Println("🔧 Creating Iris app...")
 	app := iris.New()
 	app.Validator = validator.New()
@@ -489,6 +505,16 @@ func main() {
 		return new(utils.AccessToken)
 	})
 
+	// optionalAccessToken verifies the access token when one is sent, for public endpoints
+	// that do more for signed-in users
+	optionalAccessToken := func(ctx iris.Context) {
+		if ctx.GetHeader("Authorization") == "" {
+			ctx.Next()
+			return
+		}
+		accessTokenVerifierMiddleware(ctx)
+	}
+
 	refreshTokenVerifier := jwt.NewVerifier(jwt.HS256, []byte(os.Getenv("REFRESH_TOKEN_SECRET")))
 	refreshTokenVerifier.WithDefaultBlocklist()
 	refreshTokenVerifierMiddleware := refreshTokenVerifier.Verify(func() interface{} {
@@ -589,6 +615,31 @@ func main() {
 		admin.Patch("/groups/{id:uint}", routes.AdminUpdateGroup)
 		admin.Post("/export", routes.AdminCreateExport)
 		admin.Get("/export/{id:string}", routes.AdminGetExport)
+		admin.Get("/jobs", routes.AdminListJobs)
+		admin.Get("/jobs/runs", routes.AdminListJobRuns)
+		admin.Post("/jobs/{name:string}/run", routes.AdminRunJob)
+		admin.Get("/payments", routes.AdminListPayments)
+		admin.Get("/payments/{id:uint}", routes.AdminGetPayment)
+		admin.Post("/payments/{id:uint}/refund", routes.AdminRefundPayment)
+		admin.Get("/cancellation-policies", routes.AdminListCancellationPolicies)
+		admin.Post("/cancellation-policies", routes.AdminCreateCancellationPolicy)
+		admin.Put("/cancellation-policies/{id:uint}", routes.AdminUpdateCancellationPolicy)
+		admin.Delete("/cancellation-policies/{id:uint}", routes.AdminDeleteCancellationPolicy)
+		admin.Get("/exchange-rates", routes.AdminListExchangeRates)
+		admin.Post("/exchange-rates/reload", routes.AdminReloadExchangeRates)
+		admin.Put("/exchange-rates/{currency:string}", routes.AdminSetExchangeRate)
+		admin.Delete("/exchange-rates/{currency:string}", routes.AdminDeleteExchangeRate)
+		admin.Get("/tax-rules", routes.AdminListTaxRules)
+		admin.Post("/tax-rules", routes.AdminCreateTaxRule)
+		admin.Put("/tax-rules/{id:uint}", routes.AdminUpdateTaxRule)
+		admin.Delete("/tax-rules/{id:uint}", routes.AdminDeleteTaxRule)
+		admin.Get("/tax-reports", routes.AdminTaxReport)
+		admin.Get("/deposits", routes.AdminListDeposits)
+		admin.Post("/deposits/{id:uint}/resolve", routes.AdminResolveDeposit)
+		admin.Get("/coupons", routes.AdminListCoupons)
+		admin.Post("/coupons", routes.AdminCreateCoupon)
+		admin.Put("/coupons/{id:uint}", routes.AdminUpdateCoupon)
+		admin.Get("/coupons/{id:uint}/redemptions", routes.AdminListCouponRedemptions)
 	}
 
 	availability := app.Party("/api/availability")
@@ -600,9 +651,23 @@ func main() {
 		availability.Post("/pricing", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.SetPropertyPricing)
 		availability.Get("/discounts/{propertyID}", routes.GetPropertyDiscounts)
 		availability.Post("/discounts", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.CreatePropertyDiscount)
+		availability.Get("/price-rules/{propertyID}", routes.GetPropertyPriceRules)
+		availability.Post("/price-rules", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.CreatePriceRule)
+		availability.Put("/price-rules/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.UpdatePriceRule)
+		availability.Delete("/price-rules/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.DeletePriceRule)
+		availability.Get("/price-calendar/{propertyID}", routes.GetPropertyPriceCalendar)
 		availability.Post("/block", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.BlockPropertyDates)
 		availability.Get("/blocks/{propertyID}", routes.GetPropertyBlocks)
-		availability.Post("/calculate-price", routes.CalculateBookingPrice)
+		availability.Delete("/block/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.DeletePropertyBlock)
+		availability.Post("/calculate-price", optionalAccessToken, routes.CalculateBookingPrice)
+		availability.Get("/rules/{propertyID}", routes.GetPropertyBookingRules)
+		availability.Post("/rules", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.SetPropertyBookingRules)
+		availability.Get("/booking-mode/{propertyID}", routes.GetPropertyBookingMode)
+		availability.Post("/booking-mode", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.SetPropertyBookingMode)
+		availability.Get("/ical/{propertyID}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.GetPropertyCalendarFeed)
+		availability.Post("/ical/{propertyID}/rotate", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.RotatePropertyCalendarFeed)
+		availability.Post("/ical/{propertyID}/import", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.ImportPropertyCalendar)
+		availability.Get("/ical/feed/{token}", routes.ExportPropertyCalendar)
 	}
 
 	categories := app.Party("/api/categories")
@@ -632,7 +697,6 @@ func main() {
 		apartment.Get("/property/{id}", routes.GetReservationsByPropertyID)
 		apartment.Post("/property/{id}", accessTokenVerifierMiddleware, routes.CreateReservation)
 		apartment.Patch("/{id}/status", accessTokenVerifierMiddleware, routes.UpdateReservationStatus)
-		apartment.Post("/expire-pending", routes.ExpirePendingReservations)
 		apartment.Delete("/{id}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.CancelReservation)
 		apartment.Post("/property/{id}/validate", routes.ValidateReservationAvailability)
 		apartment.Get("/host/reservations", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.GetHostReservations)
@@ -641,6 +705,55 @@ func main() {
 	reservations := app.Party("/api/reservations")
 	{
 		reservations.Get("/user/{id}", accessTokenVerifierMiddleware, utils.UserIDMiddleware, routes.GetUserReservations)
+		reservations.Get("/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.GetReservation)
+		reservations.Post("/{id:uint}/changes", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.RequestReservationChange)
+		reservations.Get("/{id:uint}/changes", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.GetReservationChanges)
+		reservations.Post("/changes/{id:uint}/accept", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.AcceptReservationChange)
+		reservations.Post("/changes/{id:uint}/decline", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.DeclineReservationChange)
+		reservations.Post("/changes/{id:uint}/withdraw", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.WithdrawReservationChange)
+	}
+
+	waitlist := app.Party("/api/waitlist", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware)
+	{
+		waitlist.Get("/", routes.GetUserWaitlist)
+		waitlist.Post("/property/{id:uint}", routes.JoinWaitlist)
+		waitlist.Delete("/{id:uint}", routes.LeaveWaitlist)
+	}
+
+	invoices := app.Party("/api/invoices", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware)
+	{
+		invoices.Get("/", routes.GetUserInvoices)
+		invoices.Get("/{id:uint}/pdf", routes.DownloadInvoice)
+		invoices.Get("/reservation/{id:uint}", routes.GetReservationInvoices)
+		invoices.Get("/experience-booking/{id:uint}", routes.GetExperienceBookingInvoices)
+	}
+
+	cancellationPolicies := app.Party("/api/cancellation-policies")
+	{
+		cancellationPolicies.Get("/", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.GetCancellationPolicies)
+		cancellationPolicies.Post("/", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.CreateCancellationPolicy)
+		cancellationPolicies.Put("/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.UpdateCancellationPolicy)
+		cancellationPolicies.Delete("/{id:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.DeleteCancellationPolicy)
+		cancellationPolicies.Get("/property/{propertyID}", routes.GetPropertyCancellationPolicy)
+		cancellationPolicies.Put("/property/{propertyID}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.SetPropertyCancellationPolicy)
+	}
+
+	deposits := app.Party("/api/deposits", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware)
+	{
+		deposits.Get("/guest", routes.GetGuestDeposits)
+		deposits.Get("/host", routes.GetHostDeposits)
+		deposits.Get("/reservation/{id:uint}", routes.GetReservationDeposit)
+		deposits.Post("/{id:uint}/claim", routes.ClaimDeposit)
+		deposits.Post("/{id:uint}/accept", routes.AcceptDepositClaim)
+		deposits.Post("/{id:uint}/dispute", routes.DisputeDeposit)
+	}
+
+	coupons := app.Party("/api/coupons", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware)
+	{
+		coupons.Get("/", routes.GetHostCoupons)
+		coupons.Post("/", routes.CreateHostCoupon)
+		coupons.Put("/{id:uint}", routes.UpdateHostCoupon)
+		coupons.Delete("/{id:uint}", routes.DeleteHostCoupon)
 	}
 
 	review := app.Party("/api/review")
@@ -792,8 +905,11 @@ func main() {
 	properties := app.Party("/api/properties")
 	{
 		properties.Get("/search", routes.SearchProperties)
+		properties.Get("/search/facets", routes.SearchPropertyFacets)
 	}
 
+	app.Get("/api/search", routes.Search)
+
 	reviews := app.Party("/api/reviews")
 	{
 		reviews.Get("/property/{propertyId:uint}", accessTokenVerifierMiddleware, utils.UserIDFromTokenMiddleware, routes.ListPropertyReviews)
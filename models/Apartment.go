@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -10,17 +11,37 @@ import (
 // It replaces the previous apartment/unit concept.
 type Reservation struct {
 	gorm.Model
-	PropertyID uint      `json:"propertyID"`
+	PropertyID uint      `json:"propertyID" gorm:"index:idx_reservations_property_stay,priority:1"` // with CheckIn, for availability checks and search
 	GuestID    uint      `json:"guestID"`
-	CheckIn    time.Time `json:"checkIn"`
+	CheckIn    time.Time `json:"checkIn" gorm:"index:idx_reservations_property_stay,priority:2"`
 	CheckOut   time.Time `json:"checkOut"`
 	NumGuests  int       `json:"numGuests"`
 	TotalPrice float32   `json:"totalPrice"`
 	Status     string    `json:"status"` // pending, confirmed, rejected, cancelled, completed, expired
 	Note       string    `json:"note"`
 	ExpiresAt  time.Time `json:"expiresAt"` // 24h window for pending requests
+	// NumGuests counts adults and children; infants come on top and stay free
+	NumChildren int `json:"numChildren"`
+	NumInfants  int `json:"numInfants"`
+	// BookingMode is how the reservation was made: instant (confirmed on creation) or request
+	BookingMode string `json:"bookingMode" gorm:"size:16;default:'request'"`
+
+	ReminderSentAt *time.Time `json:"reminderSentAt,omitempty"` // check-in reminder sent by the scheduler
+
+	// Pricing snapshot taken when the reservation was created (see package pricing)
+	Currency       string         `json:"currency" gorm:"size:3"`
+	PriceBreakdown datatypes.JSON `json:"priceBreakdown" gorm:"type:jsonb"`
+	QuoteID        *uint          `json:"quoteID,omitempty"`
+	// Currency the guest was shown and its rate against Currency; the guest pays in Currency
+	DisplayCurrency string  `json:"displayCurrency" gorm:"size:3"`
+	ExchangeRate    float64 `json:"exchangeRate" gorm:"default:1"`
+
+	// Cancellation policy in force when the reservation was created (cancellation.Snapshot)
+	CancellationPolicy datatypes.JSON `json:"cancellationPolicy" gorm:"type:jsonb"`
 
 	// Relationships
 	Property *Property `json:"property,omitempty" gorm:"foreignKey:PropertyID"`
 	Guest    *User     `json:"guest,omitempty" gorm:"foreignKey:GuestID"`
+	// Status history, oldest first; only loaded by the reservation detail endpoints
+	Transitions []ReservationTransition `json:"transitions,omitempty" gorm:"foreignKey:ReservationID"`
 }
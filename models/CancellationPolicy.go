@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CancellationPolicy is a tiered refund schedule. Platform presets (flexible, moderate,
+// strict, ...) have no HostID and are managed by admins; hosts may add their own.
+type CancellationPolicy struct {
+	gorm.Model
+	HostID      *uint          `json:"hostID" gorm:"index"` // nil for platform presets
+	Key         string         `json:"key" gorm:"size:64;index"`
+	Name        string         `json:"name" gorm:"size:128;not null"`
+	Description string         `json:"description" gorm:"type:text"`
+	Tiers       datatypes.JSON `json:"tiers" gorm:"type:jsonb"` // []cancellation.Tier
+	IsActive    bool           `json:"isActive" gorm:"default:true"`
+}
@@ -75,6 +75,7 @@ func (an *AmenityNames) Scan(value interface{}) error {
 // Amenity represents a property amenity
 type Amenity struct {
 	ID          int          `json:"id" db:"id"`
+	Key         string       `json:"key" db:"key"` // what amenities= filters on, e.g. "wifi"
 	Name        AmenityNames `json:"name" db:"name"`
 	Icon        string       `json:"icon" db:"icon"` // Phosphor icon name
 	Category    string       `json:"category" db:"category"`
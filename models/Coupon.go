@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Coupon is a promo code a guest enters at checkout. Platform coupons are issued by admins,
+// host coupons by a host and only valid on that host's listings.
+type Coupon struct {
+	gorm.Model
+	Code     string `json:"code" gorm:"size:32;uniqueIndex;not null"` // stored upper-case
+	Issuer   string `json:"issuer" gorm:"size:16;not null"`           // "platform" or "host"
+	IssuerID *uint  `json:"issuerID" gorm:"index"`                    // the host, nil for platform coupons
+	// Type is "percent" or "fixed"; fixed values and the minimum spend are in Currency and the
+	// coupon only applies to bookings priced in that currency
+	Type     string  `json:"type" gorm:"size:16;not null"`
+	Value    float64 `json:"value" gorm:"not null"`
+	Currency string  `json:"currency" gorm:"size:3"`
+	MinSpend float64 `json:"minSpend"`
+	// Validity window, nil bounds are open
+	StartsAt *time.Time `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt"`
+	// Redemption limits, 0 for unlimited; Redemptions counts the active ones
+	MaxRedemptions int  `json:"maxRedemptions"`
+	MaxPerUser     int  `json:"maxPerUser"`
+	Redemptions    int  `json:"redemptions" gorm:"not null;default:0"`
+	IsActive       bool `json:"isActive" gorm:"not null"`
+	// AppliesTo is "all", "stays" or "experiences"; Targets narrow it to listings or organizations
+	AppliesTo string         `json:"appliesTo" gorm:"size:16;not null"`
+	Targets   []CouponTarget `json:"targets" gorm:"foreignKey:CouponID"`
+}
+
+// CouponTarget restricts a coupon to a property, an experience, or the listings hosted by an
+// organization's owner and agents. A coupon without targets applies everywhere it's allowed.
+type CouponTarget struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	CouponID   uint   `json:"couponID" gorm:"not null;index"`
+	TargetType string `json:"targetType" gorm:"size:16;not null"` // "property", "experience", "organization"
+	TargetID   uint   `json:"targetID" gorm:"not null"`
+}
+
+// CouponRedemption records a coupon used on a booking. Redemptions of bookings that end
+// without a stay are released and no longer count towards the limits.
+type CouponRedemption struct {
+	gorm.Model
+	CouponID    uint       `json:"couponID" gorm:"not null;index"`
+	UserID      uint       `json:"userID" gorm:"not null;index"`
+	SubjectType string     `json:"subjectType" gorm:"size:32;not null;index:idx_coupon_redemption_subject,priority:1"`
+	SubjectID   uint       `json:"subjectID" gorm:"not null;index:idx_coupon_redemption_subject,priority:2"`
+	Amount      float64    `json:"amount"`
+	Currency    string     `json:"currency" gorm:"size:3"`
+	ReleasedAt  *time.Time `json:"releasedAt"`
+	Coupon      *Coupon    `json:"coupon,omitempty" gorm:"foreignKey:CouponID"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "gorm.io/gorm"
+
+// ExchangeRate is the value of one unit of Currency in the base currency (MRU).
+// Rows are maintained by admins or loaded from EXCHANGE_RATES_FILE; amounts are
+// only converted for display, payments stay in the listing's currency.
+type ExchangeRate struct {
+	gorm.Model
+	Currency string  `json:"currency" gorm:"size:3;uniqueIndex;not null"`
+	Rate     float64 `json:"rate" gorm:"not null"`
+	// Decimals is the precision converted amounts are rounded to (0 for XOF, 2 for USD)
+	Decimals int    `json:"decimals" gorm:"default:2"`
+	Source   string `json:"source" gorm:"size:16"` // admin or file
+}
+
+// DisplayPrice carries a record's amounts converted to the currency the client asked for.
+// Amounts is keyed by the JSON name of the converted field.
+type DisplayPrice struct {
+	Currency string             `json:"currency"`
+	Rate     float64            `json:"rate"`
+	Amounts  map[string]float64 `json:"amounts"`
+}
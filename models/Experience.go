@@ -70,6 +70,10 @@ type Experience struct {
 
 	// Relationships
 	Bookings []ExperienceBooking `json:"bookings" gorm:"foreignKey:ExperienceID"`
+
+	// Relevance and highlighted excerpt for a full-text search (?q=); selected by the search, never stored
+	SearchRank    float64 `json:"searchRank,omitempty" gorm:"->;-:migration"`
+	SearchSnippet string  `json:"searchSnippet,omitempty" gorm:"->;-:migration"`
 }
 
 type ExperienceBooking struct {
@@ -82,6 +86,8 @@ type ExperienceBooking struct {
 	Notes            string         `json:"notes"`
 	Status           string         `json:"status" gorm:"default:'confirmed'"` // confirmed, cancelled, completed
 	TotalPrice       float64        `json:"total_price" gorm:"not null"`
+	CouponCode       string         `json:"coupon_code" gorm:"size:32"` // promo code taken off TotalPrice
+	DiscountAmount   float64        `json:"discount_amount"`
 	UserID           uint           `json:"user_id" gorm:"not null"`
 	GuestID          uint           `json:"guest_id" gorm:"not null"`     // Required field for database
 	IsRead           bool           `json:"is_read" gorm:"default:false"` // For host dashboard
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Invoice is a receipt or credit note issued for a paid reservation or experience booking.
+// Everything printed on the PDF is copied here when it is issued, so downloading it again
+// later always gives the same document.
+// kind: receipt, supplement (an extra charge on a receipt), credit_note
+type Invoice struct {
+	gorm.Model
+	Number      string `json:"number" gorm:"size:32;uniqueIndex;not null"`
+	Kind        string `json:"kind" gorm:"size:16;index"`
+	SubjectType string `json:"subjectType" gorm:"size:32;not null;index:idx_invoice_subject"` // reservation, experience_booking
+	SubjectID   uint   `json:"subjectID" gorm:"not null;index:idx_invoice_subject"`
+	ReceiptID   *uint  `json:"receiptID,omitempty" gorm:"index"` // supplements and credit notes: the receipt they add to or correct
+	GuestID     uint   `json:"guestID" gorm:"not null;index"`
+	HostID      uint   `json:"hostID" gorm:"not null;index"`
+
+	Seller      datatypes.JSON `json:"seller" gorm:"type:jsonb"` // InvoiceParty
+	Buyer       datatypes.JSON `json:"buyer" gorm:"type:jsonb"`  // InvoiceParty
+	Description string         `json:"description"`
+	Lines       datatypes.JSON `json:"lines" gorm:"type:jsonb"` // []InvoiceLine
+	Currency    string         `json:"currency" gorm:"size:3"`
+	Subtotal    float64        `json:"subtotal"`
+	TaxAmount   float64        `json:"taxAmount"`
+	Total       float64        `json:"total"`
+	Reason      string         `json:"reason,omitempty"` // credit notes
+	IssuedAt    time.Time      `json:"issuedAt"`
+}
+
+// InvoiceParty is the host or guest named on an invoice
+type InvoiceParty struct {
+	Name    string `json:"name"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// InvoiceLine is one line of an invoice; tax lines are listed under the subtotal
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+	Amount      float64 `json:"amount"`
+	Tax         bool    `json:"tax,omitempty"`
+}
+
+// InvoiceCounter holds the last number used in an invoice series (e.g. "INV-2026")
+type InvoiceCounter struct {
+	Series string `gorm:"primaryKey;size:16"`
+	Last   int64  `gorm:"not null"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// JobRun records one execution of a background job (see package jobs)
+type JobRun struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"size:64;index;not null"`
+	Instance   string     `json:"instance" gorm:"size:128"`
+	Status     string     `json:"status" gorm:"size:16;index"` // running, succeeded, failed
+	Affected   int64      `json:"affected"`
+	Error      string     `json:"error" gorm:"type:text"`
+	StartedAt  time.Time  `json:"startedAt" gorm:"index"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
@@ -148,6 +148,12 @@ type PropertySale struct {
 	// Relationships
 	TourBookings []PropertyTour    `json:"tour_bookings" gorm:"foreignKey:PropertySaleID"`
 	Inquiries    []PropertyInquiry `json:"inquiries" gorm:"foreignKey:PropertySaleID"`
+
+	// Prices converted to the ?currency= a client asked for; never stored
+	Display *DisplayPrice `json:"display,omitempty" gorm:"-"`
+	// Relevance and highlighted excerpt for a full-text search (?q=); selected by the search, never stored
+	SearchRank    float64 `json:"search_rank,omitempty" gorm:"->;-:migration"`
+	SearchSnippet string  `json:"search_snippet,omitempty" gorm:"->;-:migration"`
 }
 
 // FloorPlan describes a single floor layout and details
@@ -241,6 +247,13 @@ type PropertyOffer struct {
 	Message    string       `json:"message"`
 	Status     string       `json:"status" gorm:"default:'pending'"` // pending, accepted, rejected, withdrawn
 	CreatedAt  time.Time    `json:"created_at"`
+
+	// Amount is in Currency; ListingAmount is the same offer in the listing's currency,
+	// converted at ExchangeRate when the offer was made
+	Currency        string  `json:"currency" gorm:"size:3"`
+	ListingCurrency string  `json:"listing_currency" gorm:"size:3"`
+	ListingAmount   float64 `json:"listing_amount"`
+	ExchangeRate    float64 `json:"exchange_rate" gorm:"default:1"`
 }
 
 // Landmark represents a custom land plot with full property information
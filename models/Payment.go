@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentIntent is the money a guest owes for one reservation or experience booking.
+// status: authorized, captured, voided, refunded, partially_refunded
+type PaymentIntent struct {
+	gorm.Model
+	SubjectType string  `json:"subjectType" gorm:"size:32;not null;index:idx_payment_subject"` // reservation, experience_booking, security_deposit
+	SubjectID   uint    `json:"subjectID" gorm:"not null;index:idx_payment_subject"`
+	PayerID     uint    `json:"payerID" gorm:"not null;index"`
+	PayeeID     uint    `json:"payeeID" gorm:"not null;index"` // host receiving the payout
+	Amount      float64 `json:"amount" gorm:"not null"`
+	PlatformFee float64 `json:"platformFee"`
+	TaxAmount   float64 `json:"taxAmount"` // collected for the tax authorities, not paid out
+	Currency    string  `json:"currency" gorm:"size:3"`
+	Status      string  `json:"status" gorm:"size:24;index"`
+	Provider    string  `json:"provider" gorm:"size:32"`
+	ProviderRef string  `json:"providerRef" gorm:"size:128;index"`
+
+	CapturedAmount float64    `json:"capturedAmount"`
+	RefundedAmount float64    `json:"refundedAmount"`
+	CapturedAt     *time.Time `json:"capturedAt"`
+	PaidOutAt      *time.Time `json:"paidOutAt"`
+
+	Refunds []PaymentRefund `json:"refunds,omitempty" gorm:"foreignKey:IntentID"`
+}
+
+// PaymentRefund is a full or partial refund of a captured intent
+type PaymentRefund struct {
+	gorm.Model
+	IntentID    uint    `json:"intentID" gorm:"not null;index"`
+	Amount      float64 `json:"amount" gorm:"not null"`
+	Reason      string  `json:"reason"`
+	ProviderRef string  `json:"providerRef" gorm:"size:128"`
+}
+
+// Payout is money sent to a host for a captured intent
+type Payout struct {
+	gorm.Model
+	IntentID    uint    `json:"intentID" gorm:"not null;index"`
+	HostID      uint    `json:"hostID" gorm:"not null;index"`
+	Amount      float64 `json:"amount" gorm:"not null"`
+	Currency    string  `json:"currency" gorm:"size:3"`
+	ProviderRef string  `json:"providerRef" gorm:"size:128"`
+}
+
+// LedgerEntry is one side of a double-entry posting. Entries sharing a TransactionID
+// always balance: the sum of debits equals the sum of credits.
+type LedgerEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TransactionID string    `json:"transactionID" gorm:"size:64;not null;index"`
+	Account       string    `json:"account" gorm:"size:64;not null;index"` // provider_clearing, platform_revenue, host_payable:<id>
+	Direction     string    `json:"direction" gorm:"size:6;not null"`      // debit, credit
+	Amount        float64   `json:"amount" gorm:"not null"`
+	Currency      string    `json:"currency" gorm:"size:3"`
+	IntentID      *uint     `json:"intentID" gorm:"index"`
+	Memo          string    `json:"memo"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
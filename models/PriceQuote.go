@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// PriceQuote is a price issued by /api/availability/calculate-price that a reservation
+// can reference. It is honoured as long as it has not expired or been used.
+type PriceQuote struct {
+	gorm.Model
+	Token         string         `json:"quoteId" gorm:"size:64;uniqueIndex;not null"`
+	PropertyID    uint           `json:"propertyID" gorm:"not null;index"`
+	CheckIn       time.Time      `json:"checkIn" gorm:"not null"`
+	CheckOut      time.Time      `json:"checkOut" gorm:"not null"`
+	Guests        int            `json:"guests" gorm:"not null"`
+	Children      int            `json:"children"`
+	Infants       int            `json:"infants"`
+	CouponCode    string         `json:"couponCode" gorm:"size:32"`
+	Currency      string         `json:"currency" gorm:"size:3"`
+	Total         float64        `json:"total"`
+	Breakdown     datatypes.JSON `json:"breakdown" gorm:"type:jsonb"`
+	ExpiresAt     time.Time      `json:"expiresAt" gorm:"not null;index"`
+	ConsumedAt    *time.Time     `json:"consumedAt"`
+	ReservationID *uint          `json:"reservationID"`
+}
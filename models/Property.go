@@ -31,8 +31,8 @@ type Property struct {
 	Currency           string        `json:"currency"`  // MRU for Mauritania
 	Amenities          string        `json:"amenities"` // JSON string
 	HouseRules         string        `json:"houseRules"`
-	CancellationPolicy string        `json:"cancellationPolicy"`
-	Images             string        `json:"images"` // JSON array of URLs
+	CancellationPolicy string        `json:"cancellationPolicy"` // preset key, or "custom"
+	Images             string        `json:"images"`             // JSON array of URLs
 	IsActive           *bool         `json:"isActive"`
 	Rating             float32       `json:"rating"`
 	Reviews            []Review      `json:"reviews"`
@@ -53,11 +53,50 @@ type Property struct {
 	UserSafetyPolicyAccepted         bool   `json:"userSafetyPolicyAccepted" gorm:"default:false"`
 	PropertyPolicyAccepted           bool   `json:"propertyPolicyAccepted" gorm:"default:false"`
 
+	// Hybrid mode: guests meeting all of these book instantly, everyone else sends a request
+	InstantBookRequireVerified   bool `json:"instantBookRequireVerified" gorm:"default:false"`
+	InstantBookMinCompletedStays int  `json:"instantBookMinCompletedStays" gorm:"default:0"`
+	InstantBookMaxNights         int  `json:"instantBookMaxNights" gorm:"default:0"`
+
+	// Booking rules (see services.BookingRules); zero means no limit
+	MinStay            int    `json:"minStay" gorm:"default:1"`
+	MaxStay            int    `json:"maxStay" gorm:"default:0"`
+	CheckInDays        string `json:"checkInDays" gorm:"size:32"` // comma-separated weekdays, e.g. "fri,sat"; empty allows any day
+	AdvanceNoticeHours int    `json:"advanceNoticeHours" gorm:"default:0"`
+	BookingWindowDays  int    `json:"bookingWindowDays" gorm:"default:0"`
+
 	// Admin moderation fields
 	Status      string `json:"status" gorm:"type:varchar(20);default:'pending';index"` // pending, approved, rejected
 	ReviewNotes string `json:"reviewNotes" gorm:"type:text"`
 	IsFlagged   bool   `json:"isFlagged" gorm:"default:false;index"`
 	FlagReason  string `json:"flagReason" gorm:"type:text"`
+
+	// Policy picked or written by the host; nil falls back to the preset named by CancellationPolicy
+	CancellationPolicyID *uint `json:"cancellationPolicyID"`
+
+	// Secret token for the public iCal feed; pointer so properties without a feed don't collide on the unique index
+	CalendarToken *string `json:"-" gorm:"size:64;uniqueIndex"`
+
+	// Prices converted to the ?currency= a client asked for; never stored
+	Display *DisplayPrice `json:"display,omitempty" gorm:"-"`
+	// Price of the stay a search asked for with checkIn, checkOut and guests; never stored
+	StayPrice *StayPrice `json:"stayPrice,omitempty" gorm:"-"`
+	// Relevance and highlighted excerpt for a full-text search (?q=); selected by the search, never stored
+	SearchRank    float64 `json:"searchRank,omitempty" gorm:"->;-:migration"`
+	SearchSnippet string  `json:"searchSnippet,omitempty" gorm:"->;-:migration"`
+	// Catalog entries of the property_amenities links, with their names in each language; never stored
+	AmenityDetails []Amenity `json:"amenityDetails,omitempty" gorm:"-"`
+}
+
+// StayPrice is what the searched stay costs at a property, fees and taxes included
+type StayPrice struct {
+	Nights   int     `json:"nights"`
+	Guests   int     `json:"guests"`
+	Total    float64 `json:"total"`
+	PerNight float64 `json:"perNight"` // Total spread over the nights
+	Currency string  `json:"currency"`
+	// Converted to the ?currency= a client asked for
+	Display *DisplayPrice `json:"display,omitempty"`
 }
 
 // Custom JSON marshaling to convert Images and Amenities strings to arrays
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PropertyAmenity links a property to an amenity of the catalog. Property.Amenities, the list
+// hosts send, is kept for older clients; the links are what searches filter and count on.
+type PropertyAmenity struct {
+	PropertyID uint      `json:"propertyID" gorm:"primaryKey;autoIncrement:false"`
+	AmenityID  int       `json:"amenityID" gorm:"primaryKey;autoIncrement:false;type:integer;index"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AmenityKey turns an amenity name into its key: lower case words joined by underscores, so
+// "Air Conditioning" becomes "air_conditioning"
+func AmenityKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
+}
+
+// MatchAmenity finds the catalog amenity a listing's amenity value stands for: its id, its key
+// or its name in any language
+func MatchAmenity(catalog []Amenity, value string) (Amenity, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Amenity{}, false
+	}
+	id, err := strconv.Atoi(value)
+	key := AmenityKey(value)
+	for _, amenity := range catalog {
+		switch {
+		case err == nil && amenity.ID == id,
+			amenity.Key != "" && amenity.Key == key,
+			strings.EqualFold(amenity.Name.En, value),
+			strings.EqualFold(amenity.Name.Fr, value),
+			amenity.Name.Ar == value:
+			return amenity, true
+		}
+	}
+	return Amenity{}, false
+}
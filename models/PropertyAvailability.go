@@ -6,16 +6,21 @@ import (
 	"gorm.io/gorm"
 )
 
-type PropertyAvailability struct {
+// AvailabilityRule sets the availability, price and stay rules of a run of nights
+// [StartDate, EndDate). Rules of a property never overlap: setting a range trims or
+// splits the rules it covers. Reservations and blocks are not stored here, they are
+// overlaid when the calendar is resolved (see services.ResolveCalendar).
+type AvailabilityRule struct {
 	gorm.Model
-	PropertyID   uint      `json:"propertyID" gorm:"not null;index"`
-	Date         time.Time `json:"date" gorm:"not null;index"`
-	IsAvailable  bool      `json:"isAvailable" gorm:"default:true"`
-	Price        float64   `json:"price" gorm:"not null"`
-	MinStay      int       `json:"minStay" gorm:"default:1"`
-	MaxStay      int       `json:"maxStay" gorm:"default:0"`
-	CheckInTime  string    `json:"checkInTime" gorm:"default:'15:00'"`
-	CheckOutTime string    `json:"checkOutTime" gorm:"default:'11:00'"`
+	PropertyID   uint      `json:"propertyID" gorm:"not null;index:idx_availability_rules_range,priority:1"`
+	StartDate    time.Time `json:"startDate" gorm:"type:date;not null;index:idx_availability_rules_range,priority:2"`
+	EndDate      time.Time `json:"endDate" gorm:"type:date;not null"` // exclusive
+	IsAvailable  bool      `json:"isAvailable" gorm:"not null"`
+	Price        float64   `json:"price" gorm:"not null"` // 0 keeps the property's standard rate
+	MinStay      int       `json:"minStay"`               // 0 keeps the property's own rule
+	MaxStay      int       `json:"maxStay"`
+	CheckInTime  string    `json:"checkInTime"`
+	CheckOutTime string    `json:"checkOutTime"`
 	Notes        string    `json:"notes"`
 	Property     Property  `json:"property" gorm:"foreignKey:PropertyID"`
 }
@@ -32,6 +37,17 @@ type PropertyPricing struct {
 	SecurityDeposit float64  `json:"securityDeposit"`
 	Currency        string   `json:"currency" gorm:"default:'MRU'"`
 	Property        Property `json:"property" gorm:"foreignKey:PropertyID"`
+
+	// Occupancy pricing: the nightly price covers BaseOccupancy guests (0 = everyone),
+	// each guest above it adds ExtraGuestFee per night
+	BaseOccupancy int     `json:"baseOccupancy"`
+	ExtraGuestFee float64 `json:"extraGuestFee"`
+	// Children are part of the guest count; ChildFee replaces ExtraGuestFee for them when set.
+	// Infants are free and don't count towards occupancy or capacity.
+	// A nil limit means no limit of its own, 0 means not accepted.
+	ChildFee    *float64 `json:"childFee"`
+	MaxChildren *int     `json:"maxChildren"`
+	MaxInfants  *int     `json:"maxInfants"`
 }
 
 type PropertyDiscount struct {
@@ -48,6 +64,22 @@ type PropertyDiscount struct {
 	Property   Property  `json:"property" gorm:"foreignKey:PropertyID"`
 }
 
+// PriceRule adjusts the nightly rate of a property between StartDate and EndDate (both
+// included), e.g. a summer season or a holiday week. When several rules match a night the
+// highest Priority wins, the newest on a tie; a price set on an availability range beats them all.
+type PriceRule struct {
+	gorm.Model
+	PropertyID uint      `json:"propertyID" gorm:"not null;index"`
+	Name       string    `json:"name" gorm:"not null"`
+	StartDate  time.Time `json:"startDate" gorm:"type:date;not null"`
+	EndDate    time.Time `json:"endDate" gorm:"type:date;not null"`
+	Adjustment string    `json:"adjustment" gorm:"size:16;not null"` // "absolute", "percent", "delta"
+	Value      float64   `json:"value"`
+	Priority   int       `json:"priority"`
+	DaysOfWeek string    `json:"daysOfWeek" gorm:"size:32"` // e.g. "fri,sat"; empty matches every night
+	Property   Property  `json:"property" gorm:"foreignKey:PropertyID"`
+}
+
 type PropertyBlock struct {
 	gorm.Model
 	PropertyID    uint      `json:"propertyID" gorm:"not null;index"`
@@ -55,5 +87,7 @@ type PropertyBlock struct {
 	EndDate       time.Time `json:"endDate" gorm:"not null"`
 	Reason        string    `json:"reason"`
 	IsMaintenance bool      `json:"isMaintenance" gorm:"default:false"`
+	Source        string    `json:"source" gorm:"size:64;index"` // empty for host blocks, calendar name for iCal imports
+	ExternalUID   string    `json:"externalUID" gorm:"size:255"`
 	Property      Property  `json:"property" gorm:"foreignKey:PropertyID"`
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ReservationChangeRequest is a guest's proposal to move a reservation's dates or guest
+// count. Rows are never deleted so the reservation keeps its change history.
+// status: pending, accepted, declined, withdrawn
+type ReservationChangeRequest struct {
+	gorm.Model
+	ReservationID uint `json:"reservationID" gorm:"not null;index"`
+	RequestedBy   uint `json:"requestedBy" gorm:"not null"`
+
+	OldCheckIn     time.Time `json:"oldCheckIn"`
+	OldCheckOut    time.Time `json:"oldCheckOut"`
+	OldNumGuests   int       `json:"oldNumGuests"`
+	OldNumChildren int       `json:"oldNumChildren"`
+	OldNumInfants  int       `json:"oldNumInfants"`
+	OldTotal       float64   `json:"oldTotal"`
+
+	NewCheckIn     time.Time      `json:"newCheckIn" gorm:"not null"`
+	NewCheckOut    time.Time      `json:"newCheckOut" gorm:"not null"`
+	NewNumGuests   int            `json:"newNumGuests" gorm:"not null"`
+	NewNumChildren int            `json:"newNumChildren"`
+	NewNumInfants  int            `json:"newNumInfants"`
+	NewTotal       float64        `json:"newTotal"`
+	PriceBreakdown datatypes.JSON `json:"priceBreakdown" gorm:"type:jsonb"`
+	// PriceDifference is NewTotal - OldTotal; Settled is what was actually charged (+) or refunded (-)
+	PriceDifference float64 `json:"priceDifference"`
+	Settled         float64 `json:"settled"`
+	Currency        string  `json:"currency" gorm:"size:3"`
+
+	Status       string     `json:"status" gorm:"size:16;index"`
+	Message      string     `json:"message" gorm:"type:text"`
+	ResponseNote string     `json:"responseNote" gorm:"type:text"`
+	RespondedAt  *time.Time `json:"respondedAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ReservationTransition records one status change of a reservation. FromStatus is empty
+// for the reservation's creation. actor: guest, host, admin, system (ActorID is nil for system).
+type ReservationTransition struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ReservationID uint      `json:"reservationID" gorm:"not null;index"`
+	FromStatus    string    `json:"fromStatus" gorm:"size:16"`
+	ToStatus      string    `json:"toStatus" gorm:"size:16;not null"`
+	Actor         string    `json:"actor" gorm:"size:16;not null"`
+	ActorID       *uint     `json:"actorID"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"index"`
+}
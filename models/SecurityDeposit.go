@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SecurityDeposit is the deposit held for a confirmed reservation.
+// status: held, claimed, disputed, settled, released
+type SecurityDeposit struct {
+	gorm.Model
+	ReservationID uint    `json:"reservationID" gorm:"not null;uniqueIndex"`
+	PropertyID    uint    `json:"propertyID" gorm:"not null;index"`
+	GuestID       uint    `json:"guestID" gorm:"not null;index"`
+	HostID        uint    `json:"hostID" gorm:"not null;index"`
+	Amount        float64 `json:"amount" gorm:"not null"`
+	Currency      string  `json:"currency" gorm:"size:3"`
+	Status        string  `json:"status" gorm:"size:16;index"`
+
+	// The host can claim until ClaimDeadline (N days after checkout)
+	ClaimDeadline time.Time      `json:"claimDeadline" gorm:"index"`
+	ClaimAmount   float64        `json:"claimAmount"`
+	ClaimReason   string         `json:"claimReason" gorm:"type:text"`
+	ClaimPhotos   datatypes.JSON `json:"claimPhotos" gorm:"type:jsonb"`
+	ClaimedAt     *time.Time     `json:"claimedAt"`
+
+	DisputeReason string     `json:"disputeReason" gorm:"type:text"`
+	DisputedAt    *time.Time `json:"disputedAt"`
+
+	// Outcome: the amount paid to the host, and who decided it for disputed claims
+	AwardedAmount  float64    `json:"awardedAmount"`
+	ResolutionNote string     `json:"resolutionNote" gorm:"type:text"`
+	ResolvedBy     *uint      `json:"resolvedBy"`
+	SettledAt      *time.Time `json:"settledAt"`
+	ReleasedAt     *time.Time `json:"releasedAt"`
+
+	Reservation *Reservation `json:"reservation,omitempty" gorm:"foreignKey:ReservationID"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaxRule is an occupancy or tourist tax collected on stays. It applies to the properties
+// of its LocationCriteria area, or else to every property in Country (and City, when set).
+// type: percentage (Rate % of the rent), per_night, per_guest_night (Rate in Currency)
+type TaxRule struct {
+	gorm.Model
+	Name               string `json:"name" gorm:"size:128;not null"`
+	Country            string `json:"country" gorm:"size:64;index"`
+	City               string `json:"city" gorm:"size:128;index"` // empty for the whole country
+	LocationCriteriaID *uint  `json:"locationCriteriaID" gorm:"index"`
+
+	Type     string  `json:"type" gorm:"size:16;not null"`
+	Rate     float64 `json:"rate" gorm:"not null"`
+	Currency string  `json:"currency" gorm:"size:3;default:'MRU'"` // of flat rates and the cap
+	// Optional caps: at most MaxAmount per stay, only the first MaxNights nights taxed; 0 = none
+	MaxAmount float64 `json:"maxAmount"`
+	MaxNights int     `json:"maxNights"`
+	// Per-guest taxes count adults only unless children are taxed too; infants never are
+	IncludeChildren bool `json:"includeChildren" gorm:"default:false"`
+
+	ValidFrom  *time.Time `json:"validFrom"`
+	ValidUntil *time.Time `json:"validUntil"`
+	IsActive   bool       `json:"isActive" gorm:"default:true"`
+}
+
+// ReservationTax is the tax a reservation collects under one rule, kept for the tax report.
+// Jurisdiction is the area name or "country/city" the rule was written for.
+type ReservationTax struct {
+	gorm.Model
+	ReservationID uint      `json:"reservationID" gorm:"not null;index"`
+	TaxRuleID     uint      `json:"taxRuleID" gorm:"not null;index"`
+	Name          string    `json:"name" gorm:"size:128"`
+	Jurisdiction  string    `json:"jurisdiction" gorm:"size:255;index"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency" gorm:"size:3"`
+	CheckIn       time.Time `json:"checkIn" gorm:"index"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WaitlistEntry is a guest waiting for [CheckIn, CheckOut) to free up on a property.
+// status: waiting, notified (the guest has until ClaimExpiresAt to book), claimed, expired, cancelled
+type WaitlistEntry struct {
+	gorm.Model
+	PropertyID uint      `json:"propertyID" gorm:"not null;index"`
+	UserID     uint      `json:"userID" gorm:"not null;index"`
+	CheckIn    time.Time `json:"checkIn" gorm:"not null"`
+	CheckOut   time.Time `json:"checkOut" gorm:"not null"`
+	NumGuests  int       `json:"numGuests" gorm:"default:1"`
+	Status     string    `json:"status" gorm:"size:16;index"`
+
+	NotifiedAt     *time.Time `json:"notifiedAt"`
+	ClaimExpiresAt *time.Time `json:"claimExpiresAt" gorm:"index"`
+	ClaimedAt      *time.Time `json:"claimedAt"`
+	ReservationID  *uint      `json:"reservationID"`
+
+	Property *Property `json:"property,omitempty" gorm:"foreignKey:PropertyID"`
+}
@@ -0,0 +1,158 @@
+package payments
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Provider calls can't take part in a database transaction. Transaction and Compensated
+// keep a journal of the calls made through this package while fn runs, and undo them
+// when it fails: authorizations are voided and captures refunded. Voids, refunds and
+// payouts can't be taken back; they are logged so they can be reconciled.
+
+type journalKey struct{}
+
+// step is one provider reference touched inside a transaction
+type step struct {
+	ref      string
+	captured float64 // captured and not refunded yet; 0 while only authorized
+	undone   bool    // already voided or fully refunded within the transaction
+	note     string  // a call that can't be undone, logged for reconciliation
+}
+
+type journal struct {
+	mu    sync.Mutex
+	steps []*step
+}
+
+// Transaction runs fn in a database transaction on db and undoes the provider calls it
+// made when the transaction rolls back
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return Compensated(db, func(db *gorm.DB) error {
+		return db.Transaction(fn)
+	})
+}
+
+// Compensated runs fn, which opens its own transaction on the db it's given (e.g.
+// services.ReserveStay), and undoes the provider calls it made when it returns an error.
+// Inside an outer Compensated call the outer journal is used.
+func Compensated(db *gorm.DB, fn func(db *gorm.DB) error) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Value(journalKey{}) != nil {
+		return fn(db)
+	}
+
+	j := &journal{}
+	err := fn(db.WithContext(context.WithValue(ctx, journalKey{}, j)))
+	if err != nil {
+		j.rollback()
+	}
+	return err
+}
+
+// journalOf returns the journal of the transaction, or nil outside Compensated
+func journalOf(tx *gorm.DB) *journal {
+	if tx == nil || tx.Statement == nil || tx.Statement.Context == nil {
+		return nil
+	}
+	j, _ := tx.Statement.Context.Value(journalKey{}).(*journal)
+	return j
+}
+
+func (j *journal) find(ref string) *step {
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		if s := j.steps[i]; s.ref == ref && s.note == "" {
+			return s
+		}
+	}
+	return nil
+}
+
+func (j *journal) authorized(ref string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.steps = append(j.steps, &step{ref: ref})
+}
+
+func (j *journal) capturedAmount(ref string, amount float64) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.find(ref); s != nil {
+		s.captured = amount
+		return
+	}
+	j.steps = append(j.steps, &step{ref: ref, captured: amount})
+}
+
+func (j *journal) voided(ref string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.find(ref); s != nil && s.captured == 0 {
+		s.undone = true
+		return
+	}
+	j.steps = append(j.steps, &step{ref: ref, note: "void"})
+}
+
+func (j *journal) refunded(ref string, amount float64) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.find(ref); s != nil && s.captured > 0 {
+		s.captured = round2(s.captured - amount)
+		s.undone = s.captured <= 0
+		return
+	}
+	j.steps = append(j.steps, &step{ref: ref, note: "refund"})
+}
+
+func (j *journal) paidOut(ref string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.steps = append(j.steps, &step{ref: ref, note: "payout"})
+}
+
+// rollback undoes the journal's steps, newest first
+func (j *journal) rollback() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	p := CurrentProvider()
+	ctx := context.Background()
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		s := j.steps[i]
+		switch {
+		case s.undone:
+		case s.note != "":
+			log.Printf("❌ PAYMENTS: %s %s went through but its transaction rolled back, reconcile with %s", s.note, s.ref, p.Name())
+		case s.captured > 0:
+			if _, err := p.Refund(ctx, s.ref, s.captured); err != nil {
+				log.Printf("❌ PAYMENTS: capture %s of %.2f not refunded after rollback, reconcile with %s: %v", s.ref, s.captured, p.Name(), err)
+			}
+		default:
+			if err := p.Void(ctx, s.ref); err != nil {
+				log.Printf("❌ PAYMENTS: authorization %s not voided after rollback, reconcile with %s: %v", s.ref, p.Name(), err)
+			}
+		}
+	}
+}
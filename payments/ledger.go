@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/utils"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// Ledger accounts
+const (
+	// AccountProviderClearing is the money held at the payment provider
+	AccountProviderClearing = "provider_clearing"
+	// AccountPlatformRevenue is the platform's fee income
+	AccountPlatformRevenue = "platform_revenue"
+	// AccountTaxPayable is occupancy and tourist tax collected for the authorities
+	AccountTaxPayable = "tax_payable"
+)
+
+// HostPayableAccount is what the platform owes a host
+func HostPayableAccount(hostID uint) string {
+	return fmt.Sprintf("host_payable:%d", hostID)
+}
+
+// Posting is one line of a ledger transaction; positive amounts only
+type Posting struct {
+	Account string
+	Debit   float64
+	Credit  float64
+}
+
+// post writes a balanced set of ledger entries under a new transaction ID
+func post(tx *gorm.DB, intent *models.PaymentIntent, memo string, postings ...Posting) error {
+	var debits, credits float64
+	for _, p := range postings {
+		debits += p.Debit
+		credits += p.Credit
+	}
+	if round2(debits) != round2(credits) {
+		return fmt.Errorf("ledger: unbalanced transaction %q (debits %.2f, credits %.2f)", memo, debits, credits)
+	}
+
+	txnID := utils.GenerateShortToken(12)
+	entries := make([]models.LedgerEntry, 0, len(postings))
+	for _, p := range postings {
+		entry := models.LedgerEntry{
+			TransactionID: txnID,
+			Account:       p.Account,
+			Currency:      intent.Currency,
+			IntentID:      &intent.ID,
+			Memo:          memo,
+		}
+		switch {
+		case p.Debit > 0:
+			entry.Direction, entry.Amount = "debit", round2(p.Debit)
+		case p.Credit > 0:
+			entry.Direction, entry.Amount = "credit", round2(p.Credit)
+		default:
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.Create(&entries).Error
+}
+
+// AccountBalance returns credits minus debits for an account, optionally limited to one intent
+func AccountBalance(db *gorm.DB, account string, intentID uint) (float64, error) {
+	var balance float64
+	q := db.Model(&models.LedgerEntry{}).
+		Select("COALESCE(SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END), 0)").
+		Where("account = ?", account)
+	if intentID != 0 {
+		q = q.Where("intent_id = ?", intentID)
+	}
+	if err := q.Scan(&balance).Error; err != nil {
+		return 0, err
+	}
+	return round2(balance), nil
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
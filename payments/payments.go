@@ -0,0 +1,367 @@
+// Package payments records money movement for reservations and experience bookings:
+// authorizations, captures, (partial) refunds and host payouts. Every movement is
+// mirrored in a double-entry ledger (models.LedgerEntry). The actual network calls go
+// through a Provider; a FakeProvider is used until a real one is configured. Run the
+// transactions that call this package through Transaction or Compensated so provider
+// calls are undone when the transaction rolls back.
+package payments
+
+import (
+	"apartments-clone-server/models"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subjects a payment can belong to
+const (
+	SubjectReservation       = "reservation"
+	SubjectExperienceBooking = "experience_booking"
+	SubjectSecurityDeposit   = "security_deposit"
+)
+
+// Intent statuses
+const (
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusVoided            = "voided"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+var (
+	// ErrNoPayment is returned when a booking has no payment intent (e.g. it predates payments)
+	ErrNoPayment = errors.New("no payment for this booking")
+	// ErrInvalidState is returned for operations the intent's status doesn't allow
+	ErrInvalidState = errors.New("payment is not in a state that allows this operation")
+)
+
+// Charge describes what a guest pays and who receives it
+type Charge struct {
+	SubjectType string
+	SubjectID   uint
+	PayerID     uint
+	PayeeID     uint
+	Amount      float64
+	PlatformFee float64
+	Tax         float64
+	Currency    string
+	Description string
+}
+
+// Authorize holds the charge amount on the guest's payment method
+func Authorize(tx *gorm.DB, c Charge) (*models.PaymentIntent, error) {
+	p := CurrentProvider()
+	ref, err := p.Authorize(context.Background(), AuthorizeRequest{
+		PayerID:     c.PayerID,
+		Amount:      round2(c.Amount),
+		Currency:    c.Currency,
+		Description: c.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	journalOf(tx).authorized(ref)
+
+	fee := c.PlatformFee
+	if fee > c.Amount {
+		fee = c.Amount
+	}
+	tax := math.Min(c.Tax, c.Amount-fee)
+	intent := models.PaymentIntent{
+		SubjectType: c.SubjectType,
+		SubjectID:   c.SubjectID,
+		PayerID:     c.PayerID,
+		PayeeID:     c.PayeeID,
+		Amount:      round2(c.Amount),
+		PlatformFee: round2(fee),
+		TaxAmount:   round2(tax),
+		Currency:    c.Currency,
+		Status:      StatusAuthorized,
+		Provider:    p.Name(),
+		ProviderRef: ref,
+	}
+	if err := tx.Create(&intent).Error; err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// Capture takes the authorized amount: the provider now holds the money, owed to the
+// host minus the platform fee
+func Capture(tx *gorm.DB, intent *models.PaymentIntent) error {
+	return CaptureAmount(tx, intent, intent.Amount)
+}
+
+// CaptureAmount captures part of an authorization (e.g. a security deposit claim);
+// the remainder is released to the guest
+func CaptureAmount(tx *gorm.DB, intent *models.PaymentIntent, amount float64) error {
+	amount = round2(amount)
+	if intent.Status != StatusAuthorized {
+		return ErrInvalidState
+	}
+	if amount <= 0 || amount > intent.Amount {
+		return fmt.Errorf("capture of %.2f outside authorized %.2f", amount, intent.Amount)
+	}
+	if err := CurrentProvider().Capture(context.Background(), intent.ProviderRef, amount); err != nil {
+		return err
+	}
+	journalOf(tx).capturedAmount(intent.ProviderRef, amount)
+
+	now := time.Now()
+	if intent.PlatformFee > amount {
+		intent.PlatformFee = amount
+	}
+	if intent.TaxAmount > amount-intent.PlatformFee {
+		intent.TaxAmount = round2(amount - intent.PlatformFee)
+	}
+	intent.Status = StatusCaptured
+	intent.CapturedAmount = amount
+	intent.CapturedAt = &now
+	if err := tx.Save(intent).Error; err != nil {
+		return err
+	}
+
+	return post(tx, intent, fmt.Sprintf("capture %s #%d", intent.SubjectType, intent.SubjectID),
+		Posting{Account: AccountProviderClearing, Debit: amount},
+		Posting{Account: HostPayableAccount(intent.PayeeID), Credit: amount - intent.PlatformFee - intent.TaxAmount},
+		Posting{Account: AccountPlatformRevenue, Credit: intent.PlatformFee},
+		Posting{Account: AccountTaxPayable, Credit: intent.TaxAmount},
+	)
+}
+
+// ChargeNow authorizes and captures in one step, for bookings confirmed immediately
+func ChargeNow(tx *gorm.DB, c Charge) (*models.PaymentIntent, error) {
+	intent, err := Authorize(tx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := Capture(tx, intent); err != nil {
+		return nil, err
+	}
+	return intent, nil
+}
+
+// Void releases an authorization that was never captured; nothing reaches the ledger
+func Void(tx *gorm.DB, intent *models.PaymentIntent) error {
+	if intent.Status != StatusAuthorized {
+		return ErrInvalidState
+	}
+	if err := CurrentProvider().Void(context.Background(), intent.ProviderRef); err != nil {
+		return err
+	}
+	journalOf(tx).voided(intent.ProviderRef)
+	intent.Status = StatusVoided
+	return tx.Save(intent).Error
+}
+
+// Refund returns part or all of a captured payment. The platform fee and taxes are
+// refunded pro rata, the rest is taken back from the host.
+func Refund(tx *gorm.DB, intent *models.PaymentIntent, amount float64, reason string) (*models.PaymentRefund, error) {
+	if intent.Status != StatusCaptured && intent.Status != StatusPartiallyRefunded {
+		return nil, ErrInvalidState
+	}
+	amount = round2(amount)
+	refundable := round2(intent.CapturedAmount - intent.RefundedAmount)
+	if amount <= 0 || amount > refundable {
+		return nil, fmt.Errorf("refund of %.2f exceeds refundable %.2f", amount, refundable)
+	}
+
+	ref, err := CurrentProvider().Refund(context.Background(), intent.ProviderRef, amount)
+	if err != nil {
+		return nil, err
+	}
+	journalOf(tx).refunded(intent.ProviderRef, amount)
+
+	refund := models.PaymentRefund{IntentID: intent.ID, Amount: amount, Reason: reason, ProviderRef: ref}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+
+	intent.RefundedAmount = round2(intent.RefundedAmount + amount)
+	intent.Status = StatusPartiallyRefunded
+	if intent.RefundedAmount >= intent.CapturedAmount {
+		intent.Status = StatusRefunded
+	}
+	if err := tx.Save(intent).Error; err != nil {
+		return nil, err
+	}
+
+	feeShare, taxShare := 0.0, 0.0
+	if intent.CapturedAmount > 0 {
+		feeShare = round2(intent.PlatformFee * amount / intent.CapturedAmount)
+		taxShare = round2(intent.TaxAmount * amount / intent.CapturedAmount)
+	}
+	if err := post(tx, intent, fmt.Sprintf("refund %s #%d", intent.SubjectType, intent.SubjectID),
+		Posting{Account: HostPayableAccount(intent.PayeeID), Debit: amount - feeShare - taxShare},
+		Posting{Account: AccountPlatformRevenue, Debit: feeShare},
+		Posting{Account: AccountTaxPayable, Debit: taxShare},
+		Posting{Account: AccountProviderClearing, Credit: amount},
+	); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// PayOut sends the host whatever this intent still owes them
+func PayOut(tx *gorm.DB, intent *models.PaymentIntent) (*models.Payout, error) {
+	if intent.PaidOutAt != nil || (intent.Status != StatusCaptured && intent.Status != StatusPartiallyRefunded) {
+		return nil, ErrInvalidState
+	}
+
+	account := HostPayableAccount(intent.PayeeID)
+	owed, err := AccountBalance(tx, account, intent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	intent.PaidOutAt = &now
+	if owed <= 0 {
+		// Fully refunded: nothing to send, but the intent is settled
+		return nil, tx.Save(intent).Error
+	}
+
+	ref, err := CurrentProvider().Payout(context.Background(), PayoutRequest{HostID: intent.PayeeID, Amount: owed, Currency: intent.Currency})
+	if err != nil {
+		return nil, err
+	}
+	journalOf(tx).paidOut(ref)
+
+	payout := models.Payout{IntentID: intent.ID, HostID: intent.PayeeID, Amount: owed, Currency: intent.Currency, ProviderRef: ref}
+	if err := tx.Create(&payout).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Save(intent).Error; err != nil {
+		return nil, err
+	}
+	if err := post(tx, intent, fmt.Sprintf("payout %s #%d", intent.SubjectType, intent.SubjectID),
+		Posting{Account: account, Debit: owed},
+		Posting{Account: AccountProviderClearing, Credit: owed},
+	); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// IntentFor loads (and locks) the latest payment intent of a booking
+func IntentFor(tx *gorm.DB, subjectType string, subjectID uint) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("id DESC").First(&intent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoPayment
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// subjectIntents loads (and locks) every intent of a booking, newest first. A booking has
+// more than one when a change to a captured booking was charged separately (see Reprice).
+func subjectIntents(tx *gorm.DB, subjectType string, subjectID uint) ([]models.PaymentIntent, error) {
+	var intents []models.PaymentIntent
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("id DESC").Find(&intents).Error
+	return intents, err
+}
+
+// Release settles the payment of a booking that is not going ahead. Uncaptured
+// authorizations are voided (the guest keeps everything); captured payments are refunded,
+// newest first, up to refundAmount. It returns the amount the guest gets back.
+func Release(tx *gorm.DB, subjectType string, subjectID uint, refundAmount float64, reason string) (float64, error) {
+	intents, err := subjectIntents(tx, subjectType, subjectID)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0.0
+	for i := range intents {
+		intent := &intents[i]
+		switch intent.Status {
+		case StatusAuthorized:
+			if err := Void(tx, intent); err != nil {
+				return 0, err
+			}
+			released += intent.Amount
+		case StatusCaptured, StatusPartiallyRefunded:
+			amount := math.Min(round2(refundAmount), round2(intent.CapturedAmount-intent.RefundedAmount))
+			if amount <= 0 {
+				continue
+			}
+			refund, err := Refund(tx, intent, amount, reason)
+			if err != nil {
+				return 0, err
+			}
+			refundAmount -= refund.Amount
+			released += refund.Amount
+		}
+	}
+	return round2(released), nil
+}
+
+// Reprice moves the payment of a booking to a new total after its dates or guests changed.
+// An authorization that isn't captured yet is replaced by one for the new total. Once
+// captured, an increase is charged as a supplementary payment and a decrease is refunded.
+// It returns the difference: positive when charged, negative when refunded.
+func Reprice(tx *gorm.DB, c Charge, reason string) (float64, error) {
+	intents, err := subjectIntents(tx, c.SubjectType, c.SubjectID)
+	if err != nil {
+		return 0, err
+	}
+	if len(intents) == 0 {
+		return 0, ErrNoPayment
+	}
+
+	if latest := &intents[0]; latest.Status == StatusAuthorized {
+		diff := round2(c.Amount - latest.Amount)
+		if diff == 0 {
+			return 0, nil
+		}
+		if err := Void(tx, latest); err != nil {
+			return 0, err
+		}
+		_, err := Authorize(tx, c)
+		return diff, err
+	}
+
+	// What the guest has paid so far, and the fee and tax shares kept of it
+	paid, fee, tax := 0.0, 0.0, 0.0
+	for _, intent := range intents {
+		if intent.Status != StatusCaptured && intent.Status != StatusPartiallyRefunded {
+			continue
+		}
+		kept := intent.CapturedAmount - intent.RefundedAmount
+		paid += kept
+		if intent.CapturedAmount > 0 {
+			fee += intent.PlatformFee * kept / intent.CapturedAmount
+			tax += intent.TaxAmount * kept / intent.CapturedAmount
+		}
+	}
+
+	diff := round2(c.Amount - paid)
+	switch {
+	case diff > 0:
+		extra := c
+		extra.Amount = diff
+		extra.PlatformFee = math.Min(math.Max(round2(c.PlatformFee-fee), 0), diff)
+		extra.Tax = math.Min(math.Max(round2(c.Tax-tax), 0), diff-extra.PlatformFee)
+		extra.Description = reason
+		if _, err := ChargeNow(tx, extra); err != nil {
+			return 0, err
+		}
+		return diff, nil
+	case diff < 0:
+		refunded, err := Release(tx, c.SubjectType, c.SubjectID, -diff, reason)
+		return -refunded, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,155 @@
+package payments
+
+import (
+	"apartments-clone-server/utils"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDeclined is returned by a provider that refuses to authorize a payment
+var ErrDeclined = errors.New("payment declined")
+
+// AuthorizeRequest asks the provider to hold Amount on the payer's payment method
+type AuthorizeRequest struct {
+	PayerID     uint
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// PayoutRequest asks the provider to send Amount to a host
+type PayoutRequest struct {
+	HostID   uint
+	Amount   float64
+	Currency string
+}
+
+// Provider moves money. Implementations only talk to the payment network;
+// bookkeeping (intents, refunds, ledger) is done by this package.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (ref string, err error)
+	Capture(ctx context.Context, ref string, amount float64) error
+	Void(ctx context.Context, ref string) error
+	Refund(ctx context.Context, ref string, amount float64) (refundRef string, err error)
+	Payout(ctx context.Context, req PayoutRequest) (ref string, err error)
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = NewFakeProvider()
+)
+
+// SetProvider replaces the provider used by the package (the fake one by default)
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// CurrentProvider returns the provider in use
+func CurrentProvider() Provider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+// FakeProvider keeps payments in memory. It is used in development and tests and
+// enforces the same state rules a real provider would (no double capture, no over-refund).
+type FakeProvider struct {
+	mu      sync.Mutex
+	seq     int
+	charges map[string]*fakeCharge
+	// DeclineAbove makes Authorize fail for amounts above it; zero disables declines
+	DeclineAbove float64
+}
+
+type fakeCharge struct {
+	authorized float64
+	captured   float64
+	refunded   float64
+	voided     bool
+	// adopted charges were authorized before a restart; their amounts are unknown
+	adopted bool
+}
+
+// charge returns the in-memory state for ref, adopting refs this process never saw
+// so that restarting the server doesn't strand authorized bookings in development
+func (f *FakeProvider) charge(ref string) *fakeCharge {
+	c, ok := f.charges[ref]
+	if !ok {
+		c = &fakeCharge{adopted: true}
+		f.charges[ref] = c
+	}
+	return c
+}
+
+// NewFakeProvider creates an empty in-memory provider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{charges: map[string]*fakeCharge{}}
+}
+
+func (f *FakeProvider) Name() string { return "fake" }
+
+func (f *FakeProvider) nextRef(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake_%d_%s", prefix, f.seq, utils.GenerateShortToken(4))
+}
+
+func (f *FakeProvider) Authorize(_ context.Context, req AuthorizeRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.Amount < 0 || (f.DeclineAbove > 0 && req.Amount > f.DeclineAbove) {
+		return "", ErrDeclined
+	}
+	ref := f.nextRef("pi")
+	f.charges[ref] = &fakeCharge{authorized: req.Amount}
+	return ref, nil
+}
+
+func (f *FakeProvider) Capture(_ context.Context, ref string, amount float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.charge(ref)
+	switch {
+	case c.voided || c.captured > 0:
+		return fmt.Errorf("fake provider: payment %s cannot be captured", ref)
+	case !c.adopted && amount > c.authorized:
+		return fmt.Errorf("fake provider: capture exceeds authorization")
+	}
+	c.captured = amount
+	return nil
+}
+
+func (f *FakeProvider) Void(_ context.Context, ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.charge(ref)
+	if c.captured > 0 {
+		return fmt.Errorf("fake provider: payment %s cannot be voided", ref)
+	}
+	c.voided = true
+	return nil
+}
+
+func (f *FakeProvider) Refund(_ context.Context, ref string, amount float64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.charge(ref)
+	if amount <= 0 || (!c.adopted && c.refunded+amount > c.captured+0.005) {
+		return "", fmt.Errorf("fake provider: invalid refund for %s", ref)
+	}
+	c.refunded += amount
+	return f.nextRef("re"), nil
+}
+
+func (f *FakeProvider) Payout(_ context.Context, req PayoutRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.Amount <= 0 {
+		return "", fmt.Errorf("fake provider: invalid payout amount")
+	}
+	return f.nextRef("po"), nil
+}
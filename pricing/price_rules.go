@@ -0,0 +1,122 @@
+package pricing
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/services"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Price rule adjustments
+const (
+	AdjustAbsolute = "absolute" // the night costs Value
+	AdjustPercent  = "percent"  // Value percent on top of the night's rate, negative lowers it
+	AdjustDelta    = "delta"    // Value added to the night's rate, negative lowers it
+)
+
+// Where the rate of a night comes from
+const (
+	SourceBase      = "base"       // the property's base price
+	SourceWeekend   = "weekend"    // its weekend price
+	SourceCalendar  = "calendar"   // a price set on an availability range
+	SourcePriceRule = "price_rule" // a price rule adjusted the base or weekend price
+)
+
+// LoadPriceRules returns the price rules of a property touching the nights [from, to)
+func LoadPriceRules(db *gorm.DB, propertyID uint, from, to time.Time) ([]models.PriceRule, error) {
+	var rules []models.PriceRule
+	err := db.Where("property_id = ? AND start_date < ? AND end_date >= ?",
+		propertyID, services.CalendarDate(to).Format(dateLayout), services.CalendarDate(from).Format(dateLayout)).
+		Order("priority DESC, id DESC").Find(&rules).Error
+	return rules, err
+}
+
+// MatchPriceRule returns the rule that prices night: the highest priority among those whose
+// dates and days of the week include it, the newest on a tie
+func MatchPriceRule(rules []models.PriceRule, night time.Time) *models.PriceRule {
+	day := services.CalendarDate(night)
+	var match *models.PriceRule
+	for i := range rules {
+		r := &rules[i]
+		if day.Before(services.CalendarDate(r.StartDate)) || day.After(services.CalendarDate(r.EndDate)) {
+			continue
+		}
+		if r.DaysOfWeek != "" {
+			days, _ := services.ParseCheckInDays(r.DaysOfWeek)
+			if !hasWeekday(days, day.Weekday()) {
+				continue
+			}
+		}
+		if match == nil || r.Priority > match.Priority || (r.Priority == match.Priority && r.ID > match.ID) {
+			match = r
+		}
+	}
+	return match
+}
+
+// NightlyCalendar returns the effective rate of each night of [from, to), as a quote would
+// charge it before length-of-stay rates, extra guests and discounts
+func NightlyCalendar(in *Inputs, from, to time.Time) []NightlyRate {
+	base, weekend := standardRates(in)
+	var rates []NightlyRate
+	for day := dayStart(from); day.Before(dayStart(to)); day = day.AddDate(0, 0, 1) {
+		rates = append(rates, nightlyRate(in, day, base, weekend))
+	}
+	return rates
+}
+
+// standardRates are the base and weekend nightly prices of the property (weekend 0 when unset)
+func standardRates(in *Inputs) (float64, float64) {
+	if p := in.Pricing; p != nil {
+		return p.BasePrice, p.WeekendPrice
+	}
+	return float64(in.Property.NightlyPrice), 0
+}
+
+// nightlyRate prices one night: a price set on an availability range wins, otherwise the
+// base or weekend price, adjusted by the matching price rule
+func nightlyRate(in *Inputs, day time.Time, base, weekend float64) NightlyRate {
+	rate := NightlyRate{Date: day.Format(dateLayout), Base: base, Source: SourceBase}
+	if rule := services.RuleFor(in.Availability, day); rule != nil && rule.Price > 0 {
+		rate.Base = rule.Price
+		rate.Source = SourceCalendar
+		rate.Amount = round2(rate.Base)
+		return rate
+	}
+	if isWeekend(day) && weekend > 0 {
+		rate.WeekendUplift = weekend - base
+		rate.Source = SourceWeekend
+	}
+
+	standard := rate.Base + rate.WeekendUplift
+	if rule := MatchPriceRule(in.PriceRules, day); rule != nil {
+		switch rule.Adjustment {
+		case AdjustAbsolute:
+			rate.Adjustment = rule.Value - standard
+		case AdjustPercent:
+			rate.Adjustment = standard * rule.Value / 100
+		case AdjustDelta:
+			rate.Adjustment = rule.Value
+		}
+		// A rule can make a night free but not negative
+		if standard+rate.Adjustment < 0 {
+			rate.Adjustment = -standard
+		}
+		rate.Adjustment = round2(rate.Adjustment)
+		rate.Source = SourcePriceRule
+		rate.PriceRuleID = rule.ID
+		rate.PriceRule = rule.Name
+	}
+	rate.Amount = round2(standard + rate.Adjustment)
+	return rate
+}
+
+func hasWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, day := range days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,492 @@
+// Package pricing is the single place where the price of a stay is computed.
+// Both the public quote endpoint and reservation creation call Quote, so the
+// line items a guest sees are exactly the ones stored on the reservation.
+package pricing
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/services"
+	"encoding/json"
+	"math"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const dateLayout = "2006-01-02"
+
+// Line item types
+const (
+	LineNightly         = "nightly"
+	LineWeekendUplift   = "weekend_uplift"
+	LinePriceRule       = "price_rule"
+	LineLengthOfStay    = "length_of_stay"
+	LineExtraGuests     = "extra_guests"
+	LineDiscount        = "discount"
+	LineCleaningFee     = "cleaning_fee"
+	LineServiceFee      = "service_fee"
+	LineTax             = "tax"
+	LineCoupon          = "coupon"
+	LineSecurityDeposit = "security_deposit"
+)
+
+// DefaultCurrency is used when neither the pricing row nor the property sets one
+const DefaultCurrency = "MRU"
+
+// Request describes the stay being priced
+type Request struct {
+	PropertyID uint
+	CheckIn    time.Time
+	CheckOut   time.Time
+	Guests     int // adults and children
+	Children   int // how many of Guests are children
+	Infants    int // on top of Guests, never charged
+	// Now is the reference time for early-bird / last-minute discounts; zero means time.Now()
+	Now time.Time
+	// CouponCode is a promo code to apply; UserID is the guest, 0 for anonymous quotes
+	CouponCode string
+	UserID     uint
+}
+
+// Inputs holds everything needed to price a stay. Load fills it from the database;
+// Calculate never touches the database.
+type Inputs struct {
+	Property     models.Property
+	Pricing      *models.PropertyPricing
+	Discounts    []models.PropertyDiscount
+	Availability []models.AvailabilityRule
+	PriceRules   []models.PriceRule
+	Taxes        []Tax
+}
+
+// LineItem is a single priced component of a stay. Discounts carry negative amounts.
+type LineItem struct {
+	Type   string  `json:"type"`
+	Label  string  `json:"label"`
+	Date   string  `json:"date,omitempty"`
+	Amount float64 `json:"amount"`
+	// Held items (the security deposit) are shown to the guest but not part of Total
+	Held bool `json:"held,omitempty"`
+}
+
+// NightlyRate is the effective price of one night
+type NightlyRate struct {
+	Date          string  `json:"date"`
+	Base          float64 `json:"base"`
+	WeekendUplift float64 `json:"weekendUplift"`
+	Adjustment    float64 `json:"adjustment"` // from the price rule, part of Amount
+	Amount        float64 `json:"amount"`
+	Source        string  `json:"source"` // one of the Source constants
+	PriceRuleID   uint    `json:"priceRuleID,omitempty"`
+	PriceRule     string  `json:"priceRule,omitempty"`
+}
+
+// AppliedDiscount describes a host discount that reduced the price
+type AppliedDiscount struct {
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	Value          float64 `json:"value"`
+	DiscountAmount float64 `json:"discountAmount"`
+}
+
+// AppliedTax is a tax collected on the stay
+type AppliedTax struct {
+	RuleID       uint    `json:"ruleID"`
+	Name         string  `json:"name"`
+	Type         string  `json:"type"`
+	Rate         float64 `json:"rate"`
+	Jurisdiction string  `json:"jurisdiction"`
+	Amount       float64 `json:"amount"`
+}
+
+// Breakdown is the full, stored result of pricing a stay
+type Breakdown struct {
+	PropertyID uint      `json:"propertyID"`
+	CheckIn    time.Time `json:"checkIn"`
+	CheckOut   time.Time `json:"checkOut"`
+	Nights     int       `json:"nights"`
+	Guests     int       `json:"guests"`
+	Children   int       `json:"children"`
+	Infants    int       `json:"infants"`
+	Currency   string    `json:"currency"`
+
+	NightlyRates     []NightlyRate     `json:"nightlyRates"`
+	LineItems        []LineItem        `json:"lineItems"`
+	AppliedDiscounts []AppliedDiscount `json:"appliedDiscounts"`
+	Taxes            []AppliedTax      `json:"taxes"`
+
+	BasePrice       float64 `json:"basePrice"`    // sum of nightly rates before weekend uplift
+	WeekendPrice    float64 `json:"weekendPrice"` // sum of weekend uplifts
+	LengthOfStay    float64 `json:"lengthOfStay"` // weekly/monthly reduction, positive
+	DiscountAmount  float64 `json:"discountAmount"`
+	CleaningFee     float64 `json:"cleaningFee"`
+	ServiceFee      float64 `json:"serviceFee"`
+	SecurityDeposit float64 `json:"securityDeposit"`
+	Total           float64 `json:"total"`
+
+	// Guests above the base occupancy and what they add over the whole stay (part of Total)
+	ExtraGuests   int     `json:"extraGuests"`
+	ExtraGuestFee float64 `json:"extraGuestFee"`
+	// Occupancy and tourist taxes (part of Total), detailed in Taxes
+	TaxAmount float64 `json:"taxAmount"`
+	// Price rule adjustments over the whole stay (part of Total), negative when rules lowered the rate
+	PriceRuleAdjustment float64 `json:"priceRuleAdjustment"`
+	// Promo code taken off the stay before taxes (part of Total)
+	CouponID       uint    `json:"couponID,omitempty"`
+	CouponCode     string  `json:"couponCode,omitempty"`
+	CouponDiscount float64 `json:"couponDiscount"`
+}
+
+// JSON encodes the breakdown for storage on a reservation
+func (b *Breakdown) JSON() datatypes.JSON {
+	raw, _ := json.Marshal(b)
+	return datatypes.JSON(raw)
+}
+
+// Decode reads a breakdown stored on a reservation or quote
+func Decode(raw datatypes.JSON) (*Breakdown, error) {
+	var b Breakdown
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Nights returns the number of nights between two dates, at least one
+func Nights(checkIn, checkOut time.Time) int {
+	nights := int(math.Round(dayStart(checkOut).Sub(dayStart(checkIn)).Hours() / 24))
+	if nights < 1 {
+		nights = 1
+	}
+	return nights
+}
+
+// Load reads the property, its pricing, active discounts and the availability and price rules of the stay
+func Load(db *gorm.DB, req Request) (*Inputs, error) {
+	var in Inputs
+	if err := db.First(&in.Property, req.PropertyID).Error; err != nil {
+		return nil, err
+	}
+
+	var pricing models.PropertyPricing
+	if err := db.Where("property_id = ?", req.PropertyID).First(&pricing).Error; err == nil {
+		in.Pricing = &pricing
+	}
+
+	if err := db.Where("property_id = ? AND is_active = ?", req.PropertyID, true).
+		Order("id ASC").Find(&in.Discounts).Error; err != nil {
+		return nil, err
+	}
+
+	availability, err := services.LoadAvailabilityRules(db, req.PropertyID, req.CheckIn, req.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+	in.Availability = availability
+
+	if in.PriceRules, err = LoadPriceRules(db, req.PropertyID, req.CheckIn, req.CheckOut); err != nil {
+		return nil, err
+	}
+
+	taxes, err := LoadTaxes(db, &in.Property, req.CheckIn, stayCurrency(&in))
+	if err != nil {
+		return nil, err
+	}
+	in.Taxes = taxes
+
+	return &in, nil
+}
+
+// Quote loads the inputs for a stay and prices it, with the promo code of the request if any
+func Quote(db *gorm.DB, req Request) (*Breakdown, error) {
+	in, err := Load(db, req)
+	if err != nil {
+		return nil, err
+	}
+	b := Calculate(req, in)
+	if req.CouponCode == "" {
+		return b, nil
+	}
+
+	coupon, err := coupons.Find(db, req.CouponCode)
+	if err != nil {
+		return nil, err
+	}
+	target := CouponTarget(b, &in.Property, req.UserID)
+	if err := coupons.Check(db, coupon, target, time.Now()); err != nil {
+		return nil, err
+	}
+	b.ApplyCoupon(coupon, coupons.Discount(coupon, target.Amount))
+	return b, nil
+}
+
+// Requote prices a change to a reservation that was priced with booked. The promo code used at
+// booking stays applied without being checked again, its redemption being already recorded;
+// only its discount is computed again, on the new price.
+func Requote(db *gorm.DB, req Request, booked *Breakdown) (*Breakdown, error) {
+	in, err := Load(db, req)
+	if err != nil {
+		return nil, err
+	}
+	var coupon *models.Coupon
+	if booked != nil && booked.CouponID != 0 {
+		coupon = &models.Coupon{}
+		if err := db.Unscoped().First(coupon, booked.CouponID).Error; err != nil {
+			return nil, err
+		}
+	}
+	return requote(req, in, coupon), nil
+}
+
+func requote(req Request, in *Inputs, coupon *models.Coupon) *Breakdown {
+	b := Calculate(req, in)
+	if coupon != nil {
+		b.ApplyCoupon(coupon, coupons.Discount(coupon, CouponTarget(b, &in.Property, req.UserID).Amount))
+	}
+	return b
+}
+
+// CouponTarget describes a priced stay for coupon checks; coupons apply before taxes
+func CouponTarget(b *Breakdown, property *models.Property, userID uint) coupons.Target {
+	return coupons.Target{
+		SubjectType: payments.SubjectReservation,
+		ListingID:   property.ID,
+		HostID:      property.HostID,
+		UserID:      userID,
+		Amount:      round2(b.Total - b.TaxAmount + b.CouponDiscount),
+		Currency:    b.Currency,
+	}
+}
+
+// ApplyCoupon takes discount off the total as a promo code line item
+func (b *Breakdown) ApplyCoupon(coupon *models.Coupon, discount float64) {
+	b.CouponID = coupon.ID
+	b.CouponCode = coupon.Code
+	b.CouponDiscount = discount
+	if discount > 0 {
+		b.LineItems = append(b.LineItems, LineItem{Type: LineCoupon, Label: "Promo code " + coupon.Code, Amount: -discount})
+		b.Total = round2(b.Total - discount)
+	}
+}
+
+// Calculate prices a stay from already loaded inputs
+func Calculate(req Request, in *Inputs) *Breakdown {
+	now := req.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	base, weekend := standardRates(in)
+	weekly, monthly := 0.0, 0.0
+	cleaning := float64(in.Property.CleaningFee)
+	service := float64(in.Property.ServiceFee)
+	deposit := 0.0
+	currency := stayCurrency(in)
+	if p := in.Pricing; p != nil {
+		weekly = p.WeeklyPrice
+		monthly = p.MonthlyPrice
+		cleaning = p.CleaningFee
+		service = p.ServiceFee
+		deposit = p.SecurityDeposit
+	}
+
+	nights := Nights(req.CheckIn, req.CheckOut)
+	b := &Breakdown{
+		PropertyID:       in.Property.ID,
+		CheckIn:          req.CheckIn,
+		CheckOut:         req.CheckOut,
+		Nights:           nights,
+		Guests:           req.Guests,
+		Children:         req.Children,
+		Infants:          req.Infants,
+		Currency:         currency,
+		NightlyRates:     make([]NightlyRate, 0, nights),
+		LineItems:        []LineItem{},
+		AppliedDiscounts: []AppliedDiscount{},
+		Taxes:            []AppliedTax{},
+	}
+
+	// Nightly rates: a price set by the host on an availability range wins over base and
+	// weekend pricing, which price rules then adjust (see nightlyRate)
+	day := dayStart(req.CheckIn)
+	for i := 0; i < nights; i++ {
+		rate := nightlyRate(in, day, base, weekend)
+		b.NightlyRates = append(b.NightlyRates, rate)
+
+		b.BasePrice += rate.Base
+		b.WeekendPrice += rate.WeekendUplift
+		b.PriceRuleAdjustment += rate.Adjustment
+		b.LineItems = append(b.LineItems, LineItem{Type: LineNightly, Label: "Nightly rate", Date: rate.Date, Amount: round2(rate.Base)})
+		if rate.WeekendUplift != 0 {
+			b.LineItems = append(b.LineItems, LineItem{Type: LineWeekendUplift, Label: "Weekend rate", Date: rate.Date, Amount: round2(rate.WeekendUplift)})
+		}
+		if rate.Adjustment != 0 {
+			b.LineItems = append(b.LineItems, LineItem{Type: LinePriceRule, Label: rate.PriceRule, Date: rate.Date, Amount: rate.Adjustment})
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	// Length-of-stay rate: full months (or weeks) are charged at the monthly (weekly) nightly rate
+	if nights >= 30 && monthly > 0 && monthly < base {
+		covered := (nights / 30) * 30
+		b.LengthOfStay = (base - monthly) * float64(covered)
+		b.LineItems = append(b.LineItems, LineItem{Type: LineLengthOfStay, Label: "Monthly rate", Amount: -round2(b.LengthOfStay)})
+	} else if nights >= 7 && weekly > 0 && weekly < base {
+		covered := (nights / 7) * 7
+		b.LengthOfStay = (base - weekly) * float64(covered)
+		b.LineItems = append(b.LineItems, LineItem{Type: LineLengthOfStay, Label: "Weekly rate", Amount: -round2(b.LengthOfStay)})
+	}
+
+	// Occupancy: each guest above the base occupancy pays a nightly fee. Adults take the
+	// included places first, so extra children are charged the child fee when there is one.
+	if p := in.Pricing; p != nil && p.BaseOccupancy > 0 {
+		adults := req.Guests - req.Children
+		extraAdults := maxInt(adults-p.BaseOccupancy, 0)
+		extraChildren := maxInt(req.Guests-p.BaseOccupancy, 0) - extraAdults
+		childFee := p.ExtraGuestFee
+		if p.ChildFee != nil {
+			childFee = *p.ChildFee
+		}
+		if amount := float64(extraAdults*nights) * p.ExtraGuestFee; amount > 0 {
+			b.ExtraGuestFee += amount
+			b.LineItems = append(b.LineItems, LineItem{Type: LineExtraGuests, Label: "Extra guest fee", Amount: round2(amount)})
+		}
+		if amount := float64(extraChildren*nights) * childFee; amount > 0 {
+			b.ExtraGuestFee += amount
+			b.LineItems = append(b.LineItems, LineItem{Type: LineExtraGuests, Label: "Extra child fee", Amount: round2(amount)})
+		}
+		b.ExtraGuests = extraAdults + extraChildren
+	}
+
+	// Extra guest fees are part of the accommodation, so percentage discounts apply to them
+	accommodation := b.BasePrice + b.WeekendPrice + b.PriceRuleAdjustment - b.LengthOfStay + b.ExtraGuestFee
+	daysUntilCheckIn := int(req.CheckIn.Sub(now).Hours() / 24)
+	for _, d := range in.Discounts {
+		if !discountApplies(d, req.CheckIn, req.CheckOut, nights) {
+			continue
+		}
+		var value float64
+		switch d.Type {
+		case "percentage":
+			value = accommodation * (d.Value / 100)
+		case "fixed":
+			value = d.Value
+		case "early_bird":
+			if daysUntilCheckIn >= 30 {
+				value = accommodation * (d.Value / 100)
+			}
+		case "last_minute":
+			if daysUntilCheckIn <= 7 {
+				value = accommodation * (d.Value / 100)
+			}
+		}
+		// Discounts never push accommodation below zero
+		if remaining := accommodation - b.DiscountAmount; value > remaining {
+			value = remaining
+		}
+		if value <= 0 {
+			continue
+		}
+		value = round2(value)
+		b.DiscountAmount += value
+		b.AppliedDiscounts = append(b.AppliedDiscounts, AppliedDiscount{Name: d.Name, Type: d.Type, Value: d.Value, DiscountAmount: value})
+		b.LineItems = append(b.LineItems, LineItem{Type: LineDiscount, Label: d.Name, Amount: -value})
+	}
+
+	b.CleaningFee = cleaning
+	b.ServiceFee = service
+	b.SecurityDeposit = deposit
+	if cleaning > 0 {
+		b.LineItems = append(b.LineItems, LineItem{Type: LineCleaningFee, Label: "Cleaning fee", Amount: round2(cleaning)})
+	}
+	if service > 0 {
+		b.LineItems = append(b.LineItems, LineItem{Type: LineServiceFee, Label: "Service fee", Amount: round2(service)})
+	}
+
+	// Taxes: percentages apply to the rent after discounts, not to cleaning and service fees
+	for _, t := range in.Taxes {
+		amount := t.Amount(accommodation-b.DiscountAmount, nights, req.Guests, req.Children)
+		if amount <= 0 {
+			continue
+		}
+		b.TaxAmount += amount
+		b.Taxes = append(b.Taxes, AppliedTax{RuleID: t.Rule.ID, Name: t.Rule.Name, Type: t.Rule.Type, Rate: t.Rule.Rate, Jurisdiction: t.Jurisdiction, Amount: amount})
+		b.LineItems = append(b.LineItems, LineItem{Type: LineTax, Label: t.Rule.Name, Amount: amount})
+	}
+	if deposit > 0 {
+		b.LineItems = append(b.LineItems, LineItem{Type: LineSecurityDeposit, Label: "Security deposit", Amount: round2(deposit), Held: true})
+	}
+
+	b.BasePrice = round2(b.BasePrice)
+	b.WeekendPrice = round2(b.WeekendPrice)
+	b.PriceRuleAdjustment = round2(b.PriceRuleAdjustment)
+	b.LengthOfStay = round2(b.LengthOfStay)
+	b.ExtraGuestFee = round2(b.ExtraGuestFee)
+	b.TaxAmount = round2(b.TaxAmount)
+	b.DiscountAmount = round2(b.DiscountAmount)
+	b.Total = 0
+	for _, item := range b.LineItems {
+		if !item.Held {
+			b.Total += item.Amount
+		}
+	}
+	b.Total = round2(b.Total)
+
+	return b
+}
+
+// Currency is the currency the property's stays are priced in
+func (in *Inputs) Currency() string {
+	return stayCurrency(in)
+}
+
+// stayCurrency is the currency a stay is priced in: the pricing row's, else the property's
+func stayCurrency(in *Inputs) string {
+	currency := in.Property.Currency
+	if in.Pricing != nil && in.Pricing.Currency != "" {
+		currency = in.Pricing.Currency
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return currency
+}
+
+// discountApplies checks a discount's stay length and date window; zero dates are open-ended
+func discountApplies(d models.PropertyDiscount, checkIn, checkOut time.Time, nights int) bool {
+	if d.MinStay > 0 && nights < d.MinStay {
+		return false
+	}
+	if d.MaxStay > 0 && nights > d.MaxStay {
+		return false
+	}
+	if !d.StartDate.IsZero() && d.StartDate.After(checkIn) {
+		return false
+	}
+	if !d.EndDate.IsZero() && d.EndDate.Before(checkOut) {
+		return false
+	}
+	return true
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
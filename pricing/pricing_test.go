@@ -0,0 +1,227 @@
+package pricing
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
+
+func TestCalculateUsesRangePriceAndWeekendRate(t *testing.T) {
+	in := &Inputs{
+		Property: models.Property{NightlyPrice: 50},
+		Pricing: &models.PropertyPricing{
+			BasePrice:    100,
+			WeekendPrice: 150,
+			CleaningFee:  20,
+			ServiceFee:   10,
+			Currency:     "MRU",
+		},
+		Availability: []models.AvailabilityRule{
+			{StartDate: date("2025-01-06"), EndDate: date("2025-01-07"), Price: 80, IsAvailable: true},
+			{StartDate: date("2025-01-07"), EndDate: date("2025-01-09"), Price: 0, IsAvailable: true},
+		},
+	}
+	// Fri 3rd -> Tue 7th: Fri base, Sat/Sun weekend, Mon range price
+	b := Calculate(Request{CheckIn: date("2025-01-03"), CheckOut: date("2025-01-07"), Guests: 2}, in)
+
+	if b.Nights != 4 {
+		t.Fatalf("expected 4 nights, got %d", b.Nights)
+	}
+	want := []float64{100, 150, 150, 80}
+	for i, rate := range b.NightlyRates {
+		if rate.Amount != want[i] {
+			t.Fatalf("night %s: expected %.2f, got %.2f", rate.Date, want[i], rate.Amount)
+		}
+	}
+	if b.Total != 100+150+150+80+20+10 {
+		t.Fatalf("unexpected total %.2f", b.Total)
+	}
+}
+
+func TestCalculateWeeklyRateAndDiscounts(t *testing.T) {
+	in := &Inputs{
+		Pricing: &models.PropertyPricing{
+			BasePrice:       100,
+			WeeklyPrice:     80,
+			SecurityDeposit: 500,
+		},
+		Discounts: []models.PropertyDiscount{
+			{Name: "Ten off", Type: "percentage", Value: 10},
+			{Name: "Short stays only", Type: "fixed", Value: 50, MaxStay: 3},
+		},
+	}
+	b := Calculate(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-11")}, in)
+
+	// 8 nights at 100, 7 of them at the weekly rate, then 10% off
+	accommodation := 800.0 - 140.0
+	if b.LengthOfStay != 140 {
+		t.Fatalf("expected length-of-stay reduction 140, got %.2f", b.LengthOfStay)
+	}
+	if b.DiscountAmount != 66 {
+		t.Fatalf("expected discount 66, got %.2f", b.DiscountAmount)
+	}
+	if b.Total != accommodation-66 {
+		t.Fatalf("deposit must not be charged: total %.2f", b.Total)
+	}
+	if b.SecurityDeposit != 500 || b.Currency != DefaultCurrency {
+		t.Fatalf("unexpected deposit/currency %.2f %s", b.SecurityDeposit, b.Currency)
+	}
+}
+
+func TestCalculateExtraGuests(t *testing.T) {
+	childFee := 10.0
+	in := &Inputs{
+		Pricing: &models.PropertyPricing{
+			BasePrice:     100,
+			BaseOccupancy: 2,
+			ExtraGuestFee: 25,
+			ChildFee:      &childFee,
+		},
+	}
+	// 8 guests (3 of them children) and a baby for 2 nights: 3 extra adults and 3 extra children
+	b := Calculate(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-05"), Guests: 8, Children: 3, Infants: 1}, in)
+
+	if b.ExtraGuests != 6 {
+		t.Fatalf("expected 6 extra guests, got %d", b.ExtraGuests)
+	}
+	if b.ExtraGuestFee != 3*25*2+3*10*2 {
+		t.Fatalf("unexpected extra guest fee %.2f", b.ExtraGuestFee)
+	}
+	if b.Total != 200+b.ExtraGuestFee {
+		t.Fatalf("unexpected total %.2f", b.Total)
+	}
+
+	// Within the base occupancy the nightly price covers everyone
+	b = Calculate(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-05"), Guests: 2, Infants: 2}, in)
+	if b.ExtraGuestFee != 0 || b.Total != 200 {
+		t.Fatalf("expected no extra guest fee, got %.2f (total %.2f)", b.ExtraGuestFee, b.Total)
+	}
+}
+
+func TestCalculateTaxes(t *testing.T) {
+	in := &Inputs{
+		Pricing: &models.PropertyPricing{BasePrice: 100, CleaningFee: 50},
+		Discounts: []models.PropertyDiscount{
+			{Name: "Ten off", Type: "percentage", Value: 10},
+		},
+		Taxes: []Tax{
+			{Rule: models.TaxRule{Name: "Occupancy tax", Type: TaxPercentage, Rate: 5, MaxAmount: 30}, Jurisdiction: "MR/Nouakchott"},
+			{Rule: models.TaxRule{Name: "Tourist tax", Type: TaxPerGuestNight, Rate: 2, MaxNights: 3}, Jurisdiction: "Tevragh Zeina"},
+		},
+	}
+	// 4 nights for 3 guests, one of them a child: rent 400 - 40 discount
+	b := Calculate(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-07"), Guests: 3, Children: 1}, in)
+
+	if len(b.Taxes) != 2 {
+		t.Fatalf("expected 2 taxes, got %+v", b.Taxes)
+	}
+	// 5% of 360 = 18 (under the cap); 2 adults x 3 taxed nights x 2 = 12
+	if b.Taxes[0].Amount != 18 || b.Taxes[1].Amount != 12 || b.TaxAmount != 30 {
+		t.Fatalf("unexpected taxes %+v", b.Taxes)
+	}
+	if b.Total != 360+50+30 {
+		t.Fatalf("unexpected total %.2f", b.Total)
+	}
+
+	// The cap limits the percentage tax on a long stay
+	b = Calculate(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-13"), Guests: 1}, in)
+	if b.Taxes[0].Amount != 30 {
+		t.Fatalf("expected capped tax 30, got %.2f", b.Taxes[0].Amount)
+	}
+}
+
+func TestCheckQuote(t *testing.T) {
+	now := date("2025-03-01")
+	quote := &models.PriceQuote{
+		PropertyID: 7,
+		CheckIn:    date("2025-03-03"),
+		CheckOut:   date("2025-03-05"),
+		Guests:     2,
+		ExpiresAt:  now.Add(DefaultQuoteTTL),
+	}
+	req := Request{PropertyID: 7, CheckIn: date("2025-03-03"), CheckOut: date("2025-03-05"), Guests: 2}
+
+	if err := CheckQuote(quote, req, now); err != nil {
+		t.Fatalf("expected valid quote, got %v", err)
+	}
+	tampered := req
+	tampered.Guests = 3
+	if err := CheckQuote(quote, tampered, now); err != ErrQuoteMismatch {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if err := CheckQuote(quote, req, quote.ExpiresAt); err != ErrQuoteExpired {
+		t.Fatalf("expected expired, got %v", err)
+	}
+}
+
+func TestCalculateAppliesPriceRules(t *testing.T) {
+	in := &Inputs{
+		Pricing: &models.PropertyPricing{BasePrice: 100, WeekendPrice: 120},
+		Availability: []models.AvailabilityRule{
+			{StartDate: date("2025-07-10"), EndDate: date("2025-07-11"), Price: 90, IsAvailable: true},
+		},
+		PriceRules: []models.PriceRule{
+			{Model: gorm.Model{ID: 1}, Name: "Summer", StartDate: date("2025-07-01"), EndDate: date("2025-08-31"), Adjustment: AdjustPercent, Value: 30},
+			{Model: gorm.Model{ID: 2}, Name: "Tabaski", StartDate: date("2025-07-06"), EndDate: date("2025-07-12"), Adjustment: AdjustAbsolute, Value: 150, Priority: 1},
+			{Model: gorm.Model{ID: 3}, Name: "Friday", StartDate: date("2025-07-01"), EndDate: date("2025-08-31"), Adjustment: AdjustDelta, Value: -500, Priority: 2, DaysOfWeek: "fri"},
+		},
+	}
+	// Sat 5th (summer on the weekend rate), Sun 6th..Wed 9th (Tabaski), Thu 10th (calendar price), Fri 11th (free)
+	b := Calculate(Request{CheckIn: date("2025-07-05"), CheckOut: date("2025-07-12"), Guests: 1}, in)
+
+	want := []struct {
+		amount float64
+		source string
+		rule   string
+	}{
+		{156, SourcePriceRule, "Summer"},
+		{150, SourcePriceRule, "Tabaski"},
+		{150, SourcePriceRule, "Tabaski"},
+		{150, SourcePriceRule, "Tabaski"},
+		{150, SourcePriceRule, "Tabaski"},
+		{90, SourceCalendar, ""},
+		{0, SourcePriceRule, "Friday"},
+	}
+	for i, rate := range b.NightlyRates {
+		if rate.Amount != want[i].amount || rate.Source != want[i].source || rate.PriceRule != want[i].rule {
+			t.Fatalf("night %s: got %.2f from %s %q, want %+v", rate.Date, rate.Amount, rate.Source, rate.PriceRule, want[i])
+		}
+	}
+	// 36 + 30 + 50*3 - 100 on top of the standard rates
+	if b.PriceRuleAdjustment != 36+30+150-100 || b.Total != 156+150*4+90 {
+		t.Fatalf("unexpected adjustment %.2f, total %.2f", b.PriceRuleAdjustment, b.Total)
+	}
+}
+
+func TestRequoteKeepsCoupon(t *testing.T) {
+	in := &Inputs{
+		Property: models.Property{Model: gorm.Model{ID: 3}, HostID: 9},
+		Pricing:  &models.PropertyPricing{BasePrice: 100, CleaningFee: 20, Currency: "MRU"},
+	}
+	coupon := &models.Coupon{Code: "SUMMER10", Type: coupons.Percent, Value: 10}
+
+	// Booked for two nights with 10% off, then moved to a four-night stay
+	booked := requote(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-05"), UserID: 5}, in, coupon)
+	if booked.CouponDiscount != 22 || booked.Total != 198 {
+		t.Fatalf("unexpected booked price: discount %.2f, total %.2f", booked.CouponDiscount, booked.Total)
+	}
+	changed := requote(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-07"), UserID: 5}, in, coupon)
+	if changed.CouponCode != "SUMMER10" || changed.CouponDiscount != 42 || changed.Total != 378 {
+		t.Fatalf("expected the coupon on the new price: discount %.2f, total %.2f", changed.CouponDiscount, changed.Total)
+	}
+	if difference := changed.Total - booked.Total; difference != 180 {
+		t.Fatalf("expected the guest to pay 180 more, got %.2f", difference)
+	}
+
+	if plain := requote(Request{CheckIn: date("2025-03-03"), CheckOut: date("2025-03-07")}, in, nil); plain.CouponDiscount != 0 || plain.Total != 420 {
+		t.Fatalf("unexpected price without a coupon %.2f", plain.Total)
+	}
+}
@@ -0,0 +1,115 @@
+package pricing
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/models"
+	"apartments-clone-server/utils"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultQuoteTTL is how long an issued quote is honoured unless QUOTE_TTL_MINUTES overrides it
+const DefaultQuoteTTL = 30 * time.Minute
+
+var (
+	ErrQuoteNotFound = errors.New("quote not found")
+	ErrQuoteExpired  = errors.New("quote has expired")
+	ErrQuoteUsed     = errors.New("quote has already been used")
+	// ErrQuoteMismatch means the booking does not match what was quoted (other property, dates, guests or promo code)
+	ErrQuoteMismatch = errors.New("quote does not match the requested stay")
+)
+
+// QuoteTTL returns the configured lifetime of a quote
+func QuoteTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("QUOTE_TTL_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return DefaultQuoteTTL
+}
+
+// IssueQuote prices a stay and persists the result so a reservation can reference it
+func IssueQuote(db *gorm.DB, req Request) (*models.PriceQuote, *Breakdown, error) {
+	breakdown, err := Quote(db, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quote := models.PriceQuote{
+		Token:      utils.GenerateShortToken(16),
+		PropertyID: req.PropertyID,
+		CheckIn:    req.CheckIn,
+		CheckOut:   req.CheckOut,
+		Guests:     req.Guests,
+		Children:   req.Children,
+		Infants:    req.Infants,
+		CouponCode: breakdown.CouponCode,
+		Currency:   breakdown.Currency,
+		Total:      breakdown.Total,
+		Breakdown:  breakdown.JSON(),
+		ExpiresAt:  time.Now().Add(QuoteTTL()),
+	}
+	if err := db.Create(&quote).Error; err != nil {
+		return nil, nil, err
+	}
+	return &quote, breakdown, nil
+}
+
+// FindQuote loads a quote by its public token
+func FindQuote(db *gorm.DB, token string) (*models.PriceQuote, error) {
+	var quote models.PriceQuote
+	err := db.Where("token = ?", token).First(&quote).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrQuoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// CheckQuote verifies that a quote can be honoured for req at now
+func CheckQuote(quote *models.PriceQuote, req Request, now time.Time) error {
+	if quote.PropertyID != req.PropertyID ||
+		!sameInstant(quote.CheckIn, req.CheckIn) ||
+		!sameInstant(quote.CheckOut, req.CheckOut) ||
+		quote.Guests != req.Guests ||
+		quote.Children != req.Children ||
+		quote.Infants != req.Infants ||
+		quote.CouponCode != coupons.Normalize(req.CouponCode) {
+		return ErrQuoteMismatch
+	}
+	if quote.ConsumedAt != nil {
+		return ErrQuoteUsed
+	}
+	if !now.Before(quote.ExpiresAt) {
+		return ErrQuoteExpired
+	}
+	return nil
+}
+
+// ConsumeQuote marks a quote as used by a reservation. It only succeeds once, so two
+// requests racing with the same quote cannot both book at the quoted price.
+func ConsumeQuote(tx *gorm.DB, quote *models.PriceQuote, reservationID uint) error {
+	now := time.Now()
+	result := tx.Model(&models.PriceQuote{}).
+		Where("id = ? AND consumed_at IS NULL AND expires_at > ?", quote.ID, now).
+		Updates(map[string]interface{}{"consumed_at": now, "reservation_id": reservationID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrQuoteUsed
+	}
+	quote.ConsumedAt = &now
+	quote.ReservationID = &reservationID
+	return nil
+}
+
+// sameInstant compares at second precision; the database keeps microseconds, clients send less
+func sameInstant(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
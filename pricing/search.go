@@ -0,0 +1,85 @@
+package pricing
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/services"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QuoteStays prices the stay of req (its PropertyID is ignored) at each of properties, for
+// search results. Everything Load reads is read once for all the properties, so the number
+// of queries doesn't grow with the results. Properties whose booking rules refuse the stay
+// (minimum stay, check-in days, party size, ...) are missing from the result.
+func QuoteStays(db *gorm.DB, properties []models.Property, req Request) (map[uint]*Breakdown, error) {
+	quotes := map[uint]*Breakdown{}
+	if len(properties) == 0 {
+		return quotes, nil
+	}
+
+	ids := make([]uint, 0, len(properties))
+	inputs := make(map[uint]*Inputs, len(properties))
+	list := make([]*Inputs, 0, len(properties))
+	for i := range properties {
+		in := &Inputs{Property: properties[i]}
+		ids = append(ids, properties[i].ID)
+		inputs[properties[i].ID] = in
+		list = append(list, in)
+	}
+
+	var pricings []models.PropertyPricing
+	if err := db.Where("property_id IN ?", ids).Order("id ASC").Find(&pricings).Error; err != nil {
+		return nil, err
+	}
+	for i := range pricings {
+		if in := inputs[pricings[i].PropertyID]; in != nil && in.Pricing == nil {
+			in.Pricing = &pricings[i]
+		}
+	}
+
+	var discounts []models.PropertyDiscount
+	if err := db.Where("property_id IN ? AND is_active = ?", ids, true).Order("id ASC").Find(&discounts).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range discounts {
+		inputs[d.PropertyID].Discounts = append(inputs[d.PropertyID].Discounts, d)
+	}
+
+	var availability []models.AvailabilityRule
+	if err := db.Where("property_id IN ? AND start_date < ? AND end_date > ?",
+		ids, services.CalendarDate(req.CheckOut).Format(dateLayout), services.CalendarDate(req.CheckIn).Format(dateLayout)).
+		Order("start_date ASC").Find(&availability).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range availability {
+		inputs[a.PropertyID].Availability = append(inputs[a.PropertyID].Availability, a)
+	}
+
+	var rules []models.PriceRule
+	if err := db.Where("property_id IN ? AND start_date < ? AND end_date >= ?",
+		ids, services.CalendarDate(req.CheckOut).Format(dateLayout), services.CalendarDate(req.CheckIn).Format(dateLayout)).
+		Order("priority DESC, id DESC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		inputs[r.PropertyID].PriceRules = append(inputs[r.PropertyID].PriceRules, r)
+	}
+
+	if err := loadTaxesInto(db, list, req.CheckIn); err != nil {
+		return nil, err
+	}
+
+	party := services.Party{Guests: req.Guests, Children: req.Children, Infants: req.Infants}
+	now := time.Now()
+	for _, in := range list {
+		bookingRules := services.StayBookingRules(&in.Property, in.Pricing, in.Availability, req.CheckIn)
+		if len(bookingRules.Check(req.CheckIn, req.CheckOut, party, now)) > 0 {
+			continue
+		}
+		stay := req
+		stay.PropertyID = in.Property.ID
+		quotes[in.Property.ID] = Calculate(stay, in)
+	}
+	return quotes, nil
+}
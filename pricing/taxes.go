@@ -0,0 +1,250 @@
+package pricing
+
+import (
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tax rule types
+const (
+	TaxPercentage    = "percentage"
+	TaxPerNight      = "per_night"
+	TaxPerGuestNight = "per_guest_night"
+)
+
+// Tax is a tax rule that applies to a stay. Flat rates and the cap are already
+// converted to the stay's currency.
+type Tax struct {
+	Rule         models.TaxRule
+	Jurisdiction string
+}
+
+// Amount is the tax due on a stay: rent is the accommodation after discounts, guests
+// counts adults and children
+func (t Tax) Amount(rent float64, nights, guests, children int) float64 {
+	taxed := nights
+	if t.Rule.MaxNights > 0 && taxed > t.Rule.MaxNights {
+		taxed = t.Rule.MaxNights
+	}
+
+	var amount float64
+	switch t.Rule.Type {
+	case TaxPercentage:
+		if nights > 0 {
+			amount = rent * (t.Rule.Rate / 100) * float64(taxed) / float64(nights)
+		}
+	case TaxPerNight:
+		amount = t.Rule.Rate * float64(taxed)
+	case TaxPerGuestNight:
+		people := guests - children
+		if t.Rule.IncludeChildren {
+			people = guests
+		}
+		amount = t.Rule.Rate * float64(people*taxed)
+	}
+
+	if t.Rule.MaxAmount > 0 && amount > t.Rule.MaxAmount {
+		amount = t.Rule.MaxAmount
+	}
+	return round2(math.Max(amount, 0))
+}
+
+// TaxJurisdiction names where a rule applies, for receipts and the tax report
+func TaxJurisdiction(rule models.TaxRule, areaName string) string {
+	if rule.LocationCriteriaID != nil {
+		return areaName
+	}
+	if rule.City != "" {
+		return rule.Country + "/" + rule.City
+	}
+	return rule.Country
+}
+
+// LoadTaxes returns the active tax rules for a property on the check-in date: those of the
+// location areas the property is assigned to, and those of its country and city
+func LoadTaxes(db *gorm.DB, property *models.Property, checkIn time.Time, currency string) ([]Tax, error) {
+	var areaIDs []uint
+	if err := db.Model(&models.LocationCriteriaProperty{}).
+		Where("property_id = ? AND is_active = ?", property.ID, true).
+		Pluck("location_criteria_id", &areaIDs).Error; err != nil {
+		return nil, err
+	}
+
+	q := db.Where("is_active = ?", true).
+		Where("(valid_from IS NULL OR valid_from <= ?) AND (valid_until IS NULL OR valid_until > ?)", checkIn, checkIn)
+	place := db.Where("location_criteria_id IS NULL AND LOWER(country) = LOWER(?) AND (city = '' OR LOWER(city) = LOWER(?))",
+		strings.TrimSpace(property.Country), strings.TrimSpace(property.City))
+	if len(areaIDs) > 0 {
+		place = place.Or("location_criteria_id IN ?", areaIDs)
+	}
+
+	var rules []models.TaxRule
+	if err := q.Where(place).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	areaNames := map[uint]string{}
+	if len(areaIDs) > 0 {
+		var areas []models.LocationCriteria
+		if err := db.Select("id, name").Where("id IN ?", areaIDs).Find(&areas).Error; err != nil {
+			return nil, err
+		}
+		for _, a := range areas {
+			areaNames[a.ID] = a.Name
+		}
+	}
+
+	var rates fx.Table
+	return taxesIn(db, rules, areaNames, currency, &rates)
+}
+
+// loadTaxesInto is LoadTaxes for many stays with the same check-in, as search prices them:
+// the rules of every property are read at once and matched in memory
+func loadTaxesInto(db *gorm.DB, inputs []*Inputs, checkIn time.Time) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(inputs))
+	countries := map[string]bool{}
+	for _, in := range inputs {
+		ids = append(ids, in.Property.ID)
+		countries[strings.ToLower(strings.TrimSpace(in.Property.Country))] = true
+	}
+
+	var links []models.LocationCriteriaProperty
+	if err := db.Select("property_id, location_criteria_id").
+		Where("property_id IN ? AND is_active = ?", ids, true).Find(&links).Error; err != nil {
+		return err
+	}
+	areas := map[uint]map[uint]bool{} // property -> its areas
+	var areaIDs []uint
+	for _, l := range links {
+		if areas[l.PropertyID] == nil {
+			areas[l.PropertyID] = map[uint]bool{}
+		}
+		areas[l.PropertyID][l.LocationCriteriaID] = true
+		areaIDs = append(areaIDs, l.LocationCriteriaID)
+	}
+
+	countryList := make([]string, 0, len(countries))
+	for c := range countries {
+		countryList = append(countryList, c)
+	}
+	place := db.Where("location_criteria_id IS NULL AND LOWER(country) IN ?", countryList)
+	if len(areaIDs) > 0 {
+		place = place.Or("location_criteria_id IN ?", areaIDs)
+	}
+	var rules []models.TaxRule
+	if err := db.Where("is_active = ?", true).
+		Where("(valid_from IS NULL OR valid_from <= ?) AND (valid_until IS NULL OR valid_until > ?)", checkIn, checkIn).
+		Where(place).Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	areaNames := map[uint]string{}
+	if len(areaIDs) > 0 {
+		var named []models.LocationCriteria
+		if err := db.Select("id, name").Where("id IN ?", areaIDs).Find(&named).Error; err != nil {
+			return err
+		}
+		for _, a := range named {
+			areaNames[a.ID] = a.Name
+		}
+	}
+
+	var rates fx.Table
+	for _, in := range inputs {
+		var matching []models.TaxRule
+		for _, rule := range rules {
+			if taxRuleCovers(rule, &in.Property, areas[in.Property.ID]) {
+				matching = append(matching, rule)
+			}
+		}
+		taxes, err := taxesIn(db, matching, areaNames, stayCurrency(in), &rates)
+		if err != nil {
+			return err
+		}
+		in.Taxes = taxes
+	}
+	return nil
+}
+
+// taxRuleCovers is the place condition of LoadTaxes: one of the property's areas, or its country and city
+func taxRuleCovers(rule models.TaxRule, property *models.Property, areas map[uint]bool) bool {
+	if rule.LocationCriteriaID != nil {
+		return areas[*rule.LocationCriteriaID]
+	}
+	return strings.EqualFold(rule.Country, strings.TrimSpace(property.Country)) &&
+		(rule.City == "" || strings.EqualFold(rule.City, strings.TrimSpace(property.City)))
+}
+
+// taxesIn converts the flat amounts and caps of rules to currency, loading the exchange
+// rates into *rates the first time a rule needs them
+func taxesIn(db *gorm.DB, rules []models.TaxRule, areaNames map[uint]string, currency string, rates *fx.Table) ([]Tax, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	taxes := make([]Tax, 0, len(rules))
+	for _, rule := range rules {
+		// Flat amounts are written in the rule's currency
+		if fx.Normalize(rule.Currency) != fx.Normalize(currency) && (rule.Type != TaxPercentage || rule.MaxAmount > 0) {
+			if *rates == nil {
+				var err error
+				if *rates, err = fx.Load(db); err != nil {
+					return nil, err
+				}
+			}
+			rate, err := rates.Rate(rule.Currency, currency)
+			if err != nil {
+				return nil, err
+			}
+			if rule.Type != TaxPercentage {
+				rule.Rate *= rate
+			}
+			rule.MaxAmount *= rate
+		}
+
+		var areaName string
+		if rule.LocationCriteriaID != nil {
+			areaName = areaNames[*rule.LocationCriteriaID]
+		}
+		taxes = append(taxes, Tax{Rule: rule, Jurisdiction: TaxJurisdiction(rule, areaName)})
+	}
+	return taxes, nil
+}
+
+// RecordReservationTaxes replaces the tax rows of a reservation with the taxes of its
+// price breakdown, so the tax report follows changes to the stay
+func RecordReservationTaxes(tx *gorm.DB, reservation *models.Reservation) error {
+	if err := tx.Unscoped().Where("reservation_id = ?", reservation.ID).Delete(&models.ReservationTax{}).Error; err != nil {
+		return err
+	}
+	breakdown, err := Decode(reservation.PriceBreakdown)
+	if err != nil || len(breakdown.Taxes) == 0 {
+		return nil
+	}
+	rows := make([]models.ReservationTax, 0, len(breakdown.Taxes))
+	for _, t := range breakdown.Taxes {
+		rows = append(rows, models.ReservationTax{
+			ReservationID: reservation.ID,
+			TaxRuleID:     t.RuleID,
+			Name:          t.Name,
+			Jurisdiction:  t.Jurisdiction,
+			Amount:        t.Amount,
+			Currency:      breakdown.Currency,
+			CheckIn:       reservation.CheckIn,
+		})
+	}
+	return tx.Create(&rows).Error
+}
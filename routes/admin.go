@@ -10,13 +10,13 @@ import (
 	"github.com/kataras/iris/v12"
 )
 
-// ListUsers - GET /admin/users?role=&q=&page=&per_page=
+// ListUsers - GET /admin/users?role=&q=&page=&per_page=&cursor=
 func AdminListUsers(ctx iris.Context) {
-	// Basic pagination
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	// Paged by cursor, or by page number for older clients
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "created_at", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	var users []models.User
@@ -34,18 +34,14 @@ func AdminListUsers(ctx iris.Context) {
 
 	var total int64
 	query.Count(&total)
-	query = query.Offset((page - 1) * perPage).Limit(perPage)
-	if err := query.Find(&users).Error; err != nil {
+	if err := keyset.Apply(query).Find(&users).Error; err != nil {
 		ctx.StatusCode(http.StatusInternalServerError)
 		ctx.JSON(iris.Map{"error": "server_error", "message": err.Error()})
 		return
 	}
 
-	ctx.JSON(iris.Map{
-		"data":  users,
-		"meta":  iris.Map{"page": page, "per_page": perPage, "total": total},
-		"links": iris.Map{},
-	})
+	n, next := keyset.Next(len(users), func(last int) string { return keyset.TimeCursor(users[last].CreatedAt, users[last].ID) })
+	utils.JSONPageMeta(ctx, users[:n], keyset.Meta(total, next))
 }
 
 // Change role - PATCH /admin/users/:id/role
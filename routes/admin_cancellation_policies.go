@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"apartments-clone-server/cancellation"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"net/http"
+	"regexp"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+var presetKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+type adminCancellationPolicyBody struct {
+	Key         string              `json:"key"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Tiers       []cancellation.Tier `json:"tiers"`
+	IsActive    *bool               `json:"isActive"`
+}
+
+// GET /admin/cancellation-policies?include_custom=true
+func AdminListCancellationPolicies(ctx iris.Context) {
+	q := storage.DB.Model(&models.CancellationPolicy{})
+	if includeCustom, _ := ctx.URLParamBool("include_custom"); !includeCustom {
+		q = q.Where("host_id IS NULL")
+	}
+	var items []models.CancellationPolicy
+	if err := q.Order("host_id NULLS FIRST, id ASC").Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	ctx.JSON(iris.Map{"data": items})
+}
+
+// POST /admin/cancellation-policies { key, name, description, tiers }
+func AdminCreateCancellationPolicy(ctx iris.Context) {
+	var body adminCancellationPolicyBody
+	if err := ctx.ReadJSON(&body); err != nil || body.Name == "" || !presetKeyPattern.MatchString(body.Key) || body.Key == cancellation.CustomKey {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", "key (a-z, 0-9, _) and name required")
+		return
+	}
+	tiers, err := cancellation.NormalizeTiers(body.Tiers)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_tiers", err.Error())
+		return
+	}
+
+	var count int64
+	storage.DB.Model(&models.CancellationPolicy{}).Where("host_id IS NULL AND key = ?", body.Key).Count(&count)
+	if count > 0 {
+		utils.JSONError(ctx, http.StatusConflict, "duplicate_key", "a preset with this key already exists")
+		return
+	}
+
+	policy := models.CancellationPolicy{
+		Key:         body.Key,
+		Name:        body.Name,
+		Description: body.Description,
+		Tiers:       cancellation.EncodeTiers(tiers),
+		IsActive:    body.IsActive == nil || *body.IsActive,
+	}
+	if err := storage.DB.Create(&policy).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "cancellation_policy.create", "cancellation_policy", policy.ID, nil, policy)
+	ctx.StatusCode(http.StatusCreated)
+	ctx.JSON(iris.Map{"data": policy})
+}
+
+// PUT /admin/cancellation-policies/:id { name, description, tiers, isActive }
+func AdminUpdateCancellationPolicy(ctx iris.Context) {
+	policy, ok := adminPresetPolicy(ctx)
+	if !ok {
+		return
+	}
+	var body adminCancellationPolicyBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", err.Error())
+		return
+	}
+
+	before := *policy
+	if body.Name != "" {
+		policy.Name = body.Name
+	}
+	if body.Description != "" {
+		policy.Description = body.Description
+	}
+	if body.Tiers != nil {
+		tiers, err := cancellation.NormalizeTiers(body.Tiers)
+		if err != nil {
+			utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_tiers", err.Error())
+			return
+		}
+		policy.Tiers = cancellation.EncodeTiers(tiers)
+	}
+	if body.IsActive != nil {
+		policy.IsActive = *body.IsActive
+	}
+	if err := storage.DB.Save(policy).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "cancellation_policy.update", "cancellation_policy", policy.ID, before, policy)
+	ctx.JSON(iris.Map{"data": policy})
+}
+
+// DELETE /admin/cancellation-policies/:id
+func AdminDeleteCancellationPolicy(ctx iris.Context) {
+	policy, ok := adminPresetPolicy(ctx)
+	if !ok {
+		return
+	}
+	// Properties keep the preset key and fall back to the built-in terms of that key
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := detachCancellationPolicy(tx, policy.ID, policy.Key); err != nil {
+			return err
+		}
+		return tx.Delete(policy).Error
+	})
+	if err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "cancellation_policy.delete", "cancellation_policy", policy.ID, policy, nil)
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+func adminPresetPolicy(ctx iris.Context) (*models.CancellationPolicy, bool) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
+		return nil, false
+	}
+	var policy models.CancellationPolicy
+	if err := storage.DB.Where("host_id IS NULL").First(&policy, id).Error; err != nil {
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "preset not found")
+		return nil, false
+	}
+	return &policy, true
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"net/http"
+
+	"github.com/kataras/iris/v12"
+)
+
+// GET /admin/coupons?issuer=&code=&active=
+func AdminListCoupons(ctx iris.Context) {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "coupons.created_at", ID: "coupons.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+
+	q := storage.DB.Model(&models.Coupon{})
+	if issuer := ctx.URLParamDefault("issuer", ""); issuer != "" {
+		q = q.Where("issuer = ?", issuer)
+	}
+	if code := ctx.URLParamDefault("code", ""); code != "" {
+		q = q.Where("code LIKE ?", "%"+coupons.Normalize(code)+"%")
+	}
+	if active := ctx.URLParamDefault("active", ""); active != "" {
+		q = q.Where("is_active = ?", active == "true")
+	}
+
+	var total int64
+	q.Count(&total)
+
+	var items []models.Coupon
+	if err := keyset.Apply(q.Preload("Targets")).Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
+}
+
+// POST /admin/coupons { code, type, value, currency, minSpend, startsAt, endsAt, maxRedemptions, maxPerUser, appliesTo, targets }
+func AdminCreateCoupon(ctx iris.Context) {
+	var body couponBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", err.Error())
+		return
+	}
+	coupon := models.Coupon{Issuer: coupons.IssuerPlatform, IsActive: true}
+	if problem := applyAdminCoupon(&coupon, body); problem != "" {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_coupon", problem)
+		return
+	}
+	if err := saveCoupon(&coupon); err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "coupon.create", "coupon", coupon.ID, nil, coupon)
+	ctx.StatusCode(http.StatusCreated)
+	ctx.JSON(iris.Map{"data": coupon})
+}
+
+// PUT /admin/coupons/:id — replaces the coupon, host coupons included; set isActive false to withdraw a code
+func AdminUpdateCoupon(ctx iris.Context) {
+	coupon, ok := adminCoupon(ctx)
+	if !ok {
+		return
+	}
+	var body couponBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", err.Error())
+		return
+	}
+	before := *coupon
+	if problem := applyAdminCoupon(coupon, body); problem != "" {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_coupon", problem)
+		return
+	}
+	if err := saveCoupon(coupon); err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "coupon.update", "coupon", coupon.ID, before, coupon)
+	ctx.JSON(iris.Map{"data": coupon})
+}
+
+// GET /admin/coupons/:id/redemptions — released redemptions included
+func AdminListCouponRedemptions(ctx iris.Context) {
+	coupon, ok := adminCoupon(ctx)
+	if !ok {
+		return
+	}
+	var items []models.CouponRedemption
+	if err := storage.DB.Where("coupon_id = ?", coupon.ID).Order("created_at DESC").Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	ctx.JSON(iris.Map{"data": items})
+}
+
+// applyAdminCoupon is couponBody.apply plus a check that every target exists
+func applyAdminCoupon(coupon *models.Coupon, body couponBody) string {
+	if problem := body.apply(coupon); problem != "" {
+		return problem
+	}
+	for _, t := range coupon.Targets {
+		var count int64
+		switch t.TargetType {
+		case coupons.TargetProperty:
+			storage.DB.Model(&models.Property{}).Where("id = ?", t.TargetID).Count(&count)
+		case coupons.TargetExperience:
+			storage.DB.Model(&models.Experience{}).Where("id = ?", t.TargetID).Count(&count)
+		case coupons.TargetOrganization:
+			storage.DB.Model(&models.Organization{}).Where("id = ?", t.TargetID).Count(&count)
+		}
+		if count == 0 {
+			return t.TargetType + " target not found"
+		}
+	}
+	return ""
+}
+
+func adminCoupon(ctx iris.Context) (*models.Coupon, bool) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
+		return nil, false
+	}
+	var coupon models.Coupon
+	if err := storage.DB.Preload("Targets").First(&coupon, id).Error; err != nil {
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "coupon not found")
+		return nil, false
+	}
+	return &coupon, true
+}
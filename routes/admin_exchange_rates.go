@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+type adminExchangeRateBody struct {
+	Rate     float64 `json:"rate"`
+	Decimals *int    `json:"decimals"`
+}
+
+// GET /admin/exchange-rates
+func AdminListExchangeRates(ctx iris.Context) {
+	var items []models.ExchangeRate
+	if err := storage.DB.Order("currency ASC").Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	ctx.JSON(iris.Map{"data": items, "base": fx.Base})
+}
+
+// PUT /admin/exchange-rates/:currency { rate, decimals } — rate is the value of one unit in MRU
+func AdminSetExchangeRate(ctx iris.Context) {
+	currency := fx.Normalize(ctx.Params().Get("currency"))
+	var body adminExchangeRateBody
+	if err := ctx.ReadJSON(&body); err != nil || !fx.ValidCode(currency) || body.Rate <= 0 ||
+		(body.Decimals != nil && (*body.Decimals < 0 || *body.Decimals > 4)) {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", "ISO currency code, positive rate and decimals (0-4) required")
+		return
+	}
+	if currency == fx.Base && body.Rate != 1 {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_rate", "the base currency always has a rate of 1")
+		return
+	}
+
+	var before interface{}
+	var existing models.ExchangeRate
+	err := storage.DB.Where("currency = ?", currency).First(&existing).Error
+	if err == nil {
+		before = existing
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	rate := models.ExchangeRate{Currency: currency, Rate: body.Rate, Decimals: fx.DefaultDecimals(currency), Source: "admin"}
+	if body.Decimals != nil {
+		rate.Decimals = *body.Decimals
+	} else if existing.ID != 0 {
+		rate.Decimals = existing.Decimals
+	}
+	if err := fx.Save(storage.DB, &rate); err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "exchange_rate.set", "exchange_rate", rate.ID, before, rate)
+	ctx.JSON(iris.Map{"data": rate})
+}
+
+// DELETE /admin/exchange-rates/:currency
+func AdminDeleteExchangeRate(ctx iris.Context) {
+	currency := fx.Normalize(ctx.Params().Get("currency"))
+	if currency == fx.Base {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_currency", "the base currency can't be removed")
+		return
+	}
+	var rate models.ExchangeRate
+	if err := storage.DB.Where("currency = ?", currency).First(&rate).Error; err != nil {
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "exchange rate not found")
+		return
+	}
+	if err := storage.DB.Delete(&rate).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "exchange_rate.delete", "exchange_rate", rate.ID, rate, nil)
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+// POST /admin/exchange-rates/reload — reloads EXCHANGE_RATES_FILE
+func AdminReloadExchangeRates(ctx iris.Context) {
+	path := os.Getenv("EXCHANGE_RATES_FILE")
+	if path == "" {
+		utils.JSONError(ctx, http.StatusConflict, "no_rates_file", "EXCHANGE_RATES_FILE is not set")
+		return
+	}
+	count, err := fx.SeedFromFile(storage.DB, path)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_rates_file", err.Error())
+		return
+	}
+	utils.Audit(ctx, "exchange_rate.reload", "exchange_rate", 0, nil, iris.Map{"file": path, "count": count})
+	ctx.JSON(iris.Map{"data": iris.Map{"loaded": count}})
+}
@@ -13,10 +13,10 @@ import (
 
 // GET /admin/experiences
 func AdminListExperiences(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "experiences.created_at", ID: "experiences.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	status := ctx.URLParamDefault("status", "")
@@ -51,11 +51,12 @@ func AdminListExperiences(ctx iris.Context) {
 	q.Count(&total)
 
 	var items []models.Experience
-	if err := q.Preload("Host").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&items).Error; err != nil {
+	if err := keyset.Apply(q.Preload("Host")).Find(&items).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, items, page, perPage, total)
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
 }
 
 // GET /admin/experiences/:id
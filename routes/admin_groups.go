@@ -10,12 +10,12 @@ import (
 	"github.com/kataras/iris/v12"
 )
 
-// GET /admin/groups?creator_id=&active=&min_members=&page=&per_page=
+// GET /admin/groups?creator_id=&active=&min_members=&page=&per_page=&cursor=
 func AdminListGroups(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "experience_groups.created_at", ID: "experience_groups.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	creatorID := ctx.URLParamDefault("creator_id", "")
@@ -48,11 +48,12 @@ func AdminListGroups(ctx iris.Context) {
 	q.Count(&total)
 
 	var groups []models.ExperienceGroup
-	if err := q.Preload("Members").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&groups).Error; err != nil {
+	if err := keyset.Apply(q.Preload("Members")).Find(&groups).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, groups, page, perPage, total)
+	n, next := keyset.Next(len(groups), func(last int) string { return keyset.TimeCursor(groups[last].CreatedAt, groups[last].ID) })
+	utils.JSONPageMeta(ctx, groups[:n], keyset.Meta(total, next))
 }
 
 // GET /admin/groups/:id
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"apartments-clone-server/jobs"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"net/http"
+
+	"github.com/kataras/iris/v12"
+)
+
+// GET /admin/jobs
+func AdminListJobs(ctx iris.Context) {
+	list := []iris.Map{}
+	for _, job := range jobs.Default.Jobs() {
+		var last models.JobRun
+		item := iris.Map{"name": job.Name, "interval": job.Interval.String(), "lastRun": nil}
+		if err := storage.DB.Where("name = ?", job.Name).Order("started_at DESC").First(&last).Error; err == nil {
+			item["lastRun"] = last
+		}
+		list = append(list, item)
+	}
+	ctx.JSON(iris.Map{"data": list})
+}
+
+// GET /admin/jobs/runs?name=
+func AdminListJobRuns(ctx iris.Context) {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "job_runs.started_at", ID: "job_runs.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+
+	q := storage.DB.Model(&models.JobRun{})
+	if name := ctx.URLParamDefault("name", ""); name != "" {
+		q = q.Where("name = ?", name)
+	}
+
+	var total int64
+	q.Count(&total)
+
+	var items []models.JobRun
+	if err := keyset.Apply(q).Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].StartedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
+}
+
+// POST /admin/jobs/:name/run
+func AdminRunJob(ctx iris.Context) {
+	run, err := jobs.Default.RunNow(ctx.Request().Context(), ctx.Params().Get("name"))
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "job not found")
+		return
+	case errors.Is(err, jobs.ErrLocked):
+		utils.JSONError(ctx, http.StatusConflict, "job_running", "job is already running")
+		return
+	case run == nil && err != nil:
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	// A failed run is still recorded; return it so the admin sees the error
+	utils.Audit(ctx, "job.run", "job_run", run.ID, nil, run)
+	ctx.JSON(iris.Map{"data": run})
+}
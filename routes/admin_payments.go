@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"apartments-clone-server/invoices"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"net/http"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GET /admin/payments?subject_type=&status=&payee_id=
+func AdminListPayments(ctx iris.Context) {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "payment_intents.created_at", ID: "payment_intents.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+
+	q := storage.DB.Model(&models.PaymentIntent{})
+	if subjectType := ctx.URLParamDefault("subject_type", ""); subjectType != "" {
+		q = q.Where("subject_type = ?", subjectType)
+	}
+	if status := ctx.URLParamDefault("status", ""); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if payeeID := ctx.URLParamDefault("payee_id", ""); payeeID != "" {
+		q = q.Where("payee_id = ?", payeeID)
+	}
+
+	var total int64
+	q.Count(&total)
+
+	var items []models.PaymentIntent
+	if err := keyset.Apply(q).Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
+}
+
+// GET /admin/payments/:id
+func AdminGetPayment(ctx iris.Context) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
+		return
+	}
+	var intent models.PaymentIntent
+	if err := storage.DB.Preload("Refunds").First(&intent, id).Error; err != nil {
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "payment not found")
+		return
+	}
+	var payouts []models.Payout
+	storage.DB.Where("intent_id = ?", intent.ID).Order("id ASC").Find(&payouts)
+	var entries []models.LedgerEntry
+	storage.DB.Where("intent_id = ?", intent.ID).Order("id ASC").Find(&entries)
+
+	ctx.JSON(iris.Map{"data": iris.Map{"payment": intent, "payouts": payouts, "ledger": entries}, "meta": iris.Map{}, "links": iris.Map{}})
+}
+
+// POST /admin/payments/:id/refund { amount, reason }
+func AdminRefundPayment(ctx iris.Context) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
+		return
+	}
+	var body struct {
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+	if err := ctx.ReadJSON(&body); err != nil || body.Amount <= 0 || body.Reason == "" {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", "amount and reason required")
+		return
+	}
+
+	var intent models.PaymentIntent
+	var refund *models.PaymentRefund
+	err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&intent, id).Error; err != nil {
+			return err
+		}
+		var err error
+		refund, err = payments.Refund(tx, &intent, body.Amount, body.Reason)
+		if err != nil {
+			return err
+		}
+		_, err = invoices.IssueCreditNote(tx, intent.SubjectType, intent.SubjectID, refund.Amount, body.Reason)
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "payment not found")
+		return
+	case errors.Is(err, payments.ErrInvalidState):
+		utils.JSONError(ctx, http.StatusConflict, "invalid_state", err.Error())
+		return
+	case err != nil:
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "refund_failed", err.Error())
+		return
+	}
+	utils.Audit(ctx, "payment.refund", "payment_intent", intent.ID, nil, refund)
+	ctx.JSON(iris.Map{"data": iris.Map{"payment": intent, "refund": refund}})
+}
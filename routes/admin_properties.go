@@ -15,10 +15,10 @@ import (
 
 // GET /admin/properties
 func AdminListProperties(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "properties.created_at", ID: "properties.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	status := ctx.URLParamDefault("status", "")
@@ -57,12 +57,13 @@ func AdminListProperties(ctx iris.Context) {
 	q.Count(&total)
 
 	var props []models.Property
-	if err := q.Preload("Host").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&props).Error; err != nil {
+	if err := keyset.Apply(q.Preload("Host")).Find(&props).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
 
-	utils.JSONPage(ctx, props, page, perPage, total)
+	n, next := keyset.Next(len(props), func(last int) string { return keyset.TimeCursor(props[last].CreatedAt, props[last].ID) })
+	utils.JSONPageMeta(ctx, props[:n], keyset.Meta(total, next))
 }
 
 // GET /admin/properties/:id?include=host,reservations,media,reviews
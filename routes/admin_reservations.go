@@ -2,20 +2,26 @@ package routes
 
 import (
 	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"gorm.io/gorm"
 )
 
 // GET /admin/reservations
 func AdminListReservations(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "reservations.created_at", ID: "reservations.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	status := ctx.URLParamDefault("status", "")
@@ -49,11 +55,12 @@ func AdminListReservations(ctx iris.Context) {
 	q.Count(&total)
 
 	var items []models.Reservation
-	if err := q.Preload("Property").Preload("Guest").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&items).Error; err != nil {
+	if err := keyset.Apply(q.Preload("Property").Preload("Guest")).Find(&items).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, items, page, perPage, total)
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
 }
 
 // GET /admin/reservations/:id
@@ -64,7 +71,9 @@ func AdminGetReservation(ctx iris.Context) {
 		return
 	}
 	var res models.Reservation
-	if err := storage.DB.Preload("Property").Preload("Guest").First(&res, id).Error; err != nil {
+	if err := storage.DB.Preload("Property").Preload("Guest").Preload("Transitions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC, id ASC")
+	}).First(&res, id).Error; err != nil {
 		utils.JSONError(ctx, http.StatusNotFound, "not_found", "reservation not found")
 		return
 	}
@@ -91,17 +100,29 @@ func AdminCancelReservation(ctx iris.Context) {
 		return
 	}
 	before := res
-	res.Status = "cancelled"
-	res.Note = body.Reason
-	if err := storage.DB.Save(&res).Error; err != nil {
+	// Admin cancellations refund the guest in full
+	var refunded float64
+	err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		if refunded, err = releaseReservation(tx, &res, services.ReservationCancelled, adminActor(ctx), body.Reason, body.Reason); err != nil {
+			return err
+		}
+		return tx.Model(&res).Update("note", body.Reason).Error
+	})
+	if writeAdminTransitionError(ctx, err) {
+		return
+	}
+	if err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
 	utils.Audit(ctx, "reservation.cancel", "reservation", res.ID, before, res)
-	ctx.JSON(iris.Map{"data": res})
+	offerToWaitlist(res.PropertyID, res.CheckIn, res.CheckOut)
+	ctx.JSON(iris.Map{"data": res, "meta": iris.Map{"refunded": refunded}})
 }
 
-// PATCH /admin/reservations/:id/status { status }
+// PATCH /admin/reservations/:id/status { status, reason } — only transitions the state machine allows admins.
+// Confirming re-checks the calendar and captures the payment, rejecting or cancelling gives the
+// guest everything back, as when the host does it.
 func AdminUpdateReservationStatus(ctx iris.Context) {
 	id, err := ctx.Params().GetUint("id")
 	if err != nil {
@@ -110,6 +131,7 @@ func AdminUpdateReservationStatus(ctx iris.Context) {
 	}
 	var body struct {
 		Status string `json:"status"`
+		Reason string `json:"reason"`
 	}
 	if err := ctx.ReadJSON(&body); err != nil || body.Status == "" {
 		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", "status required")
@@ -121,11 +143,71 @@ func AdminUpdateReservationStatus(ctx iris.Context) {
 		return
 	}
 	before := res
-	res.Status = body.Status
-	if err := storage.DB.Save(&res).Error; err != nil {
+	actor := adminActor(ctx)
+	if !services.CanTransition(res.Status, body.Status, actor.Role) {
+		utils.JSONError(ctx, http.StatusConflict, "invalid_transition", fmt.Sprintf("a %s reservation can't be %s", res.Status, body.Status))
+		return
+	}
+
+	meta := iris.Map{}
+	released := false
+	switch body.Status {
+	case services.ReservationConfirmed:
+		var conflict services.AvailabilityConflict
+		conflict, err = services.ReserveStay(storage.DB, res.PropertyID, res.CheckIn, res.CheckOut, res.ID, func(tx *gorm.DB, property *models.Property) error {
+			return confirmReservation(tx, &res, property, actor, body.Reason)
+		})
+		if errors.Is(err, services.ErrDatesUnavailable) {
+			ctx.StatusCode(http.StatusConflict)
+			ctx.JSON(iris.Map{"error": "dates_unavailable", "message": "the dates are no longer available",
+				"conflicts": conflict.Reservations, "blocks": conflict.Blocks, "blocked": conflict.BlockedDays})
+			return
+		}
+	case services.ReservationRejected, services.ReservationCancelled, services.ReservationExpired:
+		err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+			refunded, err := releaseReservation(tx, &res, body.Status, actor, body.Reason, "reservation "+body.Status)
+			meta["refunded"] = refunded
+			return err
+		})
+		released = true
+	default:
+		// Completing has no side effects here: the payout job pays the host afterwards
+		err = storage.DB.Transaction(func(tx *gorm.DB) error {
+			return services.TransitionReservation(tx, &res, body.Status, actor, body.Reason)
+		})
+	}
+	if writeAdminTransitionError(ctx, err) {
+		return
+	}
+	if err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
 	utils.Audit(ctx, "reservation.status_update", "reservation", res.ID, before, res)
-	ctx.JSON(iris.Map{"data": res})
+	if released {
+		offerToWaitlist(res.PropertyID, res.CheckIn, res.CheckOut)
+	}
+	ctx.JSON(iris.Map{"data": res, "meta": meta})
+}
+
+// adminActor is the signed-in admin, as recorded in reservation history
+func adminActor(ctx iris.Context) services.Actor {
+	actor := services.Actor{Role: services.ActorAdmin}
+	if tok, ok := jwt.Get(ctx).(*utils.AccessToken); ok {
+		actor.UserID = tok.ID
+	}
+	return actor
+}
+
+// writeAdminTransitionError answers 409 for status changes the state machine refuses
+func writeAdminTransitionError(ctx iris.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidTransition):
+		utils.JSONError(ctx, http.StatusConflict, "invalid_transition", err.Error())
+	case errors.Is(err, services.ErrStatusChanged):
+		utils.JSONError(ctx, http.StatusConflict, "status_changed", err.Error())
+	default:
+		return false
+	}
+	return true
 }
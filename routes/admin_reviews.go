@@ -10,12 +10,12 @@ import (
 	"github.com/kataras/iris/v12"
 )
 
-// GET /admin/reviews?property_id=&rating=&page=&per_page=
+// GET /admin/reviews?property_id=&rating=&page=&per_page=&cursor=
 func AdminListReviews(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "reviews.created_at", ID: "reviews.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	propertyID := ctx.URLParamDefault("property_id", "")
@@ -35,11 +35,12 @@ func AdminListReviews(ctx iris.Context) {
 	q.Count(&total)
 
 	var items []models.Review
-	if err := q.Preload("User").Preload("Property").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&items).Error; err != nil {
+	if err := keyset.Apply(q.Preload("User").Preload("Property")).Find(&items).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, items, page, perPage, total)
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
 }
 
 // PATCH /admin/reviews/:id/status { visible, reason }
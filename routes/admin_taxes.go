@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"apartments-clone-server/pricing"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+type adminTaxRuleBody struct {
+	Name               string     `json:"name"`
+	Country            string     `json:"country"`
+	City               string     `json:"city"`
+	LocationCriteriaID *uint      `json:"locationCriteriaID"`
+	Type               string     `json:"type"`
+	Rate               float64    `json:"rate"`
+	Currency           string     `json:"currency"`
+	MaxAmount          float64    `json:"maxAmount"`
+	MaxNights          int        `json:"maxNights"`
+	IncludeChildren    bool       `json:"includeChildren"`
+	ValidFrom          *time.Time `json:"validFrom"`
+	ValidUntil         *time.Time `json:"validUntil"`
+	IsActive           *bool      `json:"isActive"`
+}
+
+// apply copies the body onto a rule and returns what is wrong with the result, if anything
+func (b adminTaxRuleBody) apply(rule *models.TaxRule) string {
+	rule.Name = strings.TrimSpace(b.Name)
+	rule.Country = strings.TrimSpace(b.Country)
+	rule.City = strings.TrimSpace(b.City)
+	rule.LocationCriteriaID = b.LocationCriteriaID
+	rule.Type = b.Type
+	rule.Rate = b.Rate
+	rule.Currency = fx.Normalize(b.Currency)
+	if rule.Currency == "" {
+		rule.Currency = fx.Base
+	}
+	rule.MaxAmount = b.MaxAmount
+	rule.MaxNights = b.MaxNights
+	rule.IncludeChildren = b.IncludeChildren
+	rule.ValidFrom = b.ValidFrom
+	rule.ValidUntil = b.ValidUntil
+	if b.IsActive != nil {
+		rule.IsActive = *b.IsActive
+	}
+
+	switch {
+	case rule.Name == "":
+		return "name required"
+	case rule.LocationCriteriaID == nil && rule.Country == "":
+		return "country or locationCriteriaID required"
+	case rule.Type != pricing.TaxPercentage && rule.Type != pricing.TaxPerNight && rule.Type != pricing.TaxPerGuestNight:
+		return "type must be percentage, per_night or per_guest_night"
+	case rule.Rate <= 0 || (rule.Type == pricing.TaxPercentage && rule.Rate > 100):
+		return "rate must be positive (at most 100 for percentages)"
+	case !fx.ValidCode(rule.Currency):
+		return "invalid currency"
+	case rule.MaxAmount < 0 || rule.MaxNights < 0:
+		return "caps can't be negative"
+	case rule.ValidFrom != nil && rule.ValidUntil != nil && !rule.ValidUntil.After(*rule.ValidFrom):
+		return "validUntil must be after validFrom"
+	}
+	if rule.LocationCriteriaID != nil {
+		var count int64
+		storage.DB.Model(&models.LocationCriteria{}).Where("id = ?", *rule.LocationCriteriaID).Count(&count)
+		if count == 0 {
+			return "location criteria not found"
+		}
+	}
+	return ""
+}
+
+// GET /admin/tax-rules?country=&city=&location_criteria_id=
+func AdminListTaxRules(ctx iris.Context) {
+	q := storage.DB.Model(&models.TaxRule{})
+	if country := ctx.URLParamDefault("country", ""); country != "" {
+		q = q.Where("LOWER(country) = LOWER(?)", country)
+	}
+	if city := ctx.URLParamDefault("city", ""); city != "" {
+		q = q.Where("LOWER(city) = LOWER(?)", city)
+	}
+	if areaID := ctx.URLParamDefault("location_criteria_id", ""); areaID != "" {
+		q = q.Where("location_criteria_id = ?", areaID)
+	}
+	var items []models.TaxRule
+	if err := q.Order("country ASC, city ASC, id ASC").Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	ctx.JSON(iris.Map{"data": items})
+}
+
+// POST /admin/tax-rules { name, country, city | locationCriteriaID, type, rate, currency, maxAmount, maxNights, ... }
+func AdminCreateTaxRule(ctx iris.Context) {
+	var body adminTaxRuleBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", err.Error())
+		return
+	}
+	rule := models.TaxRule{IsActive: true}
+	if problem := body.apply(&rule); problem != "" {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_tax_rule", problem)
+		return
+	}
+	if err := storage.DB.Create(&rule).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "tax_rule.create", "tax_rule", rule.ID, nil, rule)
+	ctx.StatusCode(http.StatusCreated)
+	ctx.JSON(iris.Map{"data": rule})
+}
+
+// PUT /admin/tax-rules/:id — replaces the rule; existing reservations keep the taxes they were priced with
+func AdminUpdateTaxRule(ctx iris.Context) {
+	rule, ok := adminTaxRule(ctx)
+	if !ok {
+		return
+	}
+	var body adminTaxRuleBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", err.Error())
+		return
+	}
+	before := *rule
+	if problem := body.apply(rule); problem != "" {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_tax_rule", problem)
+		return
+	}
+	if err := storage.DB.Save(rule).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "tax_rule.update", "tax_rule", rule.ID, before, rule)
+	ctx.JSON(iris.Map{"data": rule})
+}
+
+// DELETE /admin/tax-rules/:id
+func AdminDeleteTaxRule(ctx iris.Context) {
+	rule, ok := adminTaxRule(ctx)
+	if !ok {
+		return
+	}
+	if err := storage.DB.Delete(rule).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	utils.Audit(ctx, "tax_rule.delete", "tax_rule", rule.ID, rule, nil)
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+// TaxReportRow is the tax collected in one jurisdiction, period and currency
+type TaxReportRow struct {
+	Jurisdiction string    `json:"jurisdiction"`
+	Period       time.Time `json:"period"`
+	Currency     string    `json:"currency"`
+	Reservations int64     `json:"reservations"`
+	Amount       float64   `json:"amount"`
+}
+
+// GET /admin/tax-reports?from=2025-01-01&to=2025-04-01&period=month&jurisdiction=
+// Tax of confirmed and completed stays, by check-in date; to is exclusive
+func AdminTaxReport(ctx iris.Context) {
+	period := ctx.URLParamDefault("period", "month")
+	if period != "day" && period != "week" && period != "month" && period != "quarter" && period != "year" {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_period", "period must be day, week, month, quarter or year")
+		return
+	}
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var err error
+	if v := ctx.URLParamDefault("from", ""); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			utils.JSONError(ctx, http.StatusBadRequest, "invalid_from", "from must be YYYY-MM-DD")
+			return
+		}
+	}
+	if v := ctx.URLParamDefault("to", ""); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			utils.JSONError(ctx, http.StatusBadRequest, "invalid_to", "to must be YYYY-MM-DD")
+			return
+		}
+	}
+	if !to.After(from) {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_range", "to must be after from")
+		return
+	}
+
+	q := storage.DB.Table("reservation_taxes AS rt").
+		Select("rt.jurisdiction, date_trunc(?, rt.check_in) AS period, rt.currency, COUNT(DISTINCT rt.reservation_id) AS reservations, SUM(rt.amount) AS amount", period).
+		Joins("JOIN reservations r ON r.id = rt.reservation_id AND r.deleted_at IS NULL").
+		Where("rt.deleted_at IS NULL AND r.status IN ?", []string{"confirmed", "completed"}).
+		Where("rt.check_in >= ? AND rt.check_in < ?", from, to)
+	if jurisdiction := ctx.URLParamDefault("jurisdiction", ""); jurisdiction != "" {
+		q = q.Where("rt.jurisdiction = ?", jurisdiction)
+	}
+
+	rows := []TaxReportRow{}
+	if err := q.Group("1, 2, 3").Order("2 ASC, 1 ASC").Scan(&rows).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	for i := range rows {
+		rows[i].Amount = math.Round(rows[i].Amount*100) / 100
+	}
+	ctx.JSON(iris.Map{"data": rows, "meta": iris.Map{"from": from, "to": to, "period": period}})
+}
+
+func adminTaxRule(ctx iris.Context) (*models.TaxRule, bool) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
+		return nil, false
+	}
+	var rule models.TaxRule
+	if err := storage.DB.First(&rule, id).Error; err != nil {
+		utils.JSONError(ctx, http.StatusNotFound, "not_found", "tax rule not found")
+		return nil, false
+	}
+	return &rule, true
+}
@@ -11,11 +11,6 @@ import (
 
 // GET /admin/videos
 func AdminListVideos(ctx iris.Context) {
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
-	}
 	status := ctx.URLParamDefault("status", "")
 	isFlagged := ctx.URLParamDefault("is_flagged", "")
 	propertyID := ctx.URLParamDefault("property_id", "")
@@ -36,25 +31,40 @@ func AdminListVideos(ctx iris.Context) {
 		q = q.Where("user_id = ?", uploaderID)
 	}
 
+	keyset := utils.Keyset{Column: "created_at", Desc: true}
 	switch sort {
 	case "most_liked":
-		q = q.Order("likes_count DESC")
+		keyset.Column = "likes_count"
 	case "most_commented":
-		q = q.Order("comments_count DESC")
+		keyset.Column = "comments_count"
 	case "most_viewed":
-		q = q.Order("view_count DESC")
-	default:
-		q = q.Order("created_at DESC")
+		keyset.Column = "view_count"
+	}
+	keyset, err := utils.ReadKeyset(ctx, keyset, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 
 	var total int64
 	q.Count(&total)
 	var items []models.Video
-	if err := q.Offset((page - 1) * perPage).Limit(perPage).Find(&items).Error; err != nil {
+	if err := keyset.Apply(q).Find(&items).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, items, page, perPage, total)
+	n, next := keyset.Next(len(items), func(last int) string {
+		switch sort {
+		case "most_liked":
+			return keyset.NumberCursor(float64(items[last].LikesCount), items[last].ID)
+		case "most_commented":
+			return keyset.NumberCursor(float64(items[last].CommentsCount), items[last].ID)
+		case "most_viewed":
+			return keyset.NumberCursor(float64(items[last].ViewCount), items[last].ID)
+		}
+		return keyset.TimeCursor(items[last].CreatedAt, items[last].ID)
+	})
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
 }
 
 // GET /admin/videos/:id
@@ -138,20 +148,21 @@ func AdminListVideoComments(ctx iris.Context) {
 		utils.JSONError(ctx, http.StatusBadRequest, "invalid_id", "invalid id")
 		return
 	}
-	page := ctx.URLParamIntDefault("page", 1)
-	perPage := ctx.URLParamIntDefault("per_page", 25)
-	if perPage <= 0 || perPage > 100 {
-		perPage = 25
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "created_at", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
 	}
 	q := storage.DB.Model(&models.VideoComment{}).Where("video_id = ?", id)
 	var total int64
 	q.Count(&total)
 	var items []models.VideoComment
-	if err := q.Preload("User").Offset((page - 1) * perPage).Limit(perPage).Order("created_at DESC").Find(&items).Error; err != nil {
+	if err := keyset.Apply(q.Preload("User")).Find(&items).Error; err != nil {
 		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
-	utils.JSONPage(ctx, items, page, perPage, total)
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
 }
 
 // DELETE /admin/videos/:id/comments/:comment_id
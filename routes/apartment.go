@@ -1,10 +1,18 @@
 package routes
 
 import (
+	"apartments-clone-server/cancellation"
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/fx"
+	"apartments-clone-server/invoices"
 	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/pricing"
 	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -12,6 +20,7 @@ import (
 
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/jwt"
+	"gorm.io/gorm"
 )
 
 // Reservations endpoints (Airbnb-like)
@@ -20,8 +29,16 @@ func GetReservationsByPropertyID(ctx iris.Context) {
 	params := ctx.Params()
 	id := params.Get("id")
 
+	keyset, ok := readReservationsKeyset(ctx)
+	if !ok {
+		return
+	}
+
+	q := storage.DB.Model(&models.Reservation{}).Where("property_id = ?", id)
+	var total int64
+	q.Count(&total)
 	var reservations []models.Reservation
-	res := storage.DB.Preload("Property").Preload("Guest").Where("property_id = ?", id).Order("created_at DESC").Find(&reservations)
+	res := keyset.Apply(q.Preload("Property").Preload("Guest")).Find(&reservations)
 
 	if res.Error != nil {
 		utils.CreateError(
@@ -30,7 +47,7 @@ func GetReservationsByPropertyID(ctx iris.Context) {
 		return
 	}
 
-	ctx.JSON(reservations)
+	writeReservationsPage(ctx, keyset, reservations, total)
 }
 
 // GetHostReservations returns reservations for all properties owned by the authenticated host
@@ -42,15 +59,22 @@ func GetHostReservations(ctx iris.Context) {
 	}
 	user := tok.(*utils.AccessToken)
 
-	var reservations []models.Reservation
+	keyset, ok := readReservationsKeyset(ctx)
+	if !ok {
+		return
+	}
+
 	// Join reservations with properties to filter by host id
-	res := storage.DB.
+	q := storage.DB.Model(&models.Reservation{}).
 		Joins("JOIN properties p ON p.id = reservations.property_id").
-		Where("p.host_id = ?", user.ID).
+		Where("p.host_id = ?", user.ID)
+	var total int64
+	q.Count(&total)
+	var reservations []models.Reservation
+	res := keyset.Apply(q.
 		Preload("Property").
 		Preload("Property.Host").
-		Preload("Guest").
-		Order("reservations.created_at DESC").
+		Preload("Guest")).
 		Find(&reservations)
 
 	if res.Error != nil {
@@ -58,7 +82,7 @@ func GetHostReservations(ctx iris.Context) {
 		return
 	}
 
-	ctx.JSON(reservations)
+	writeReservationsPage(ctx, keyset, reservations, total)
 }
 
 func GetUserReservations(ctx iris.Context) {
@@ -67,8 +91,16 @@ func GetUserReservations(ctx iris.Context) {
 
 	fmt.Printf("GetUserReservations: Looking for reservations for user ID: %s\n", userID)
 
+	keyset, ok := readReservationsKeyset(ctx)
+	if !ok {
+		return
+	}
+
+	q := storage.DB.Model(&models.Reservation{}).Where("guest_id = ?", userID)
+	var total int64
+	q.Count(&total)
 	var reservations []models.Reservation
-	res := storage.DB.Preload("Property").Preload("Property.Host").Preload("Guest").Where("guest_id = ?", userID).Order("created_at DESC").Find(&reservations)
+	res := keyset.Apply(q.Preload("Property").Preload("Property.Host").Preload("Guest")).Find(&reservations)
 
 	if res.Error != nil {
 		fmt.Printf("GetUserReservations: Database error: %v\n", res.Error)
@@ -79,7 +111,61 @@ func GetUserReservations(ctx iris.Context) {
 	}
 
 	fmt.Printf("GetUserReservations: Found %d reservations for user %s\n", len(reservations), userID)
-	ctx.JSON(reservations)
+	writeReservationsPage(ctx, keyset, reservations, total)
+}
+
+// readReservationsKeyset reads the paging of a reservations list, newest first, answering 400
+// for a bad cursor
+func readReservationsKeyset(ctx iris.Context) (utils.Keyset, bool) {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "reservations.created_at", ID: "reservations.id", Desc: true}, 50, 100)
+	if err != nil {
+		utils.CreateError(iris.StatusBadRequest, "Bad Request", err.Error(), ctx)
+		return keyset, false
+	}
+	return keyset, true
+}
+
+// writeReservationsPage answers a page of reservations as a bare array, the way these lists
+// always have, with the total and the next page's cursor in headers
+func writeReservationsPage(ctx iris.Context, keyset utils.Keyset, reservations []models.Reservation, total int64) {
+	n, next := keyset.Next(len(reservations), func(last int) string {
+		return keyset.TimeCursor(reservations[last].CreatedAt, reservations[last].ID)
+	})
+	utils.SetPageHeaders(ctx, keyset.Meta(total, next))
+	ctx.JSON(reservations[:n])
+}
+
+// GetReservation returns one reservation with its status history, for its guest or host.
+// nextStatuses lists what the caller may move it to.
+func GetReservation(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	reservationID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid reservation ID"})
+		return
+	}
+
+	var reservation models.Reservation
+	if err := storage.DB.Preload("Property").Preload("Property.Host").Preload("Guest").
+		Preload("Transitions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, id ASC") }).
+		First(&reservation, reservationID).Error; err != nil ||
+		reservation.Property == nil || (reservation.GuestID != userID && reservation.Property.HostID != userID) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Reservation not found"})
+		return
+	}
+
+	role := services.ActorGuest
+	if reservation.Property.HostID == userID {
+		role = services.ActorHost
+	}
+	next := services.NextStatuses(reservation.Status, role)
+	if next == nil {
+		next = []string{}
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": reservation, "nextStatuses": next})
 }
 
 type CreateReservationInput struct {
@@ -87,6 +173,16 @@ type CreateReservationInput struct {
 	CheckOut  time.Time `json:"checkOut" validate:"required"`
 	NumGuests int       `json:"numGuests" validate:"required,gte=1,lte=16"`
 	Note      string    `json:"note"`
+	// Children are counted in NumGuests, infants are not
+	NumChildren int `json:"numChildren" validate:"gte=0"`
+	NumInfants  int `json:"numInfants" validate:"gte=0"`
+	// QuoteID is the quote returned by /api/availability/calculate-price; when set the guest is
+	// charged the quoted amount, or told explicitly that the price has to be refreshed
+	QuoteID string `json:"quoteId"`
+	// Currency the guest sees prices in; stored with its rate, the guest still pays in the listing's currency
+	Currency string `json:"currency"`
+	// CouponCode is a promo code; it must be the one quoted when QuoteID is set
+	CouponCode string `json:"couponCode"`
 }
 
 func CreateReservation(ctx iris.Context) {
@@ -107,6 +203,11 @@ func CreateReservation(ctx iris.Context) {
 		utils.CreateError(iris.StatusBadRequest, "Validation Error", "checkIn must be before checkOut", ctx)
 		return
 	}
+	rates, err := displayRates(input.Currency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
 
 	// Get property details for price calculation
 	var property models.Property
@@ -115,39 +216,154 @@ func CreateReservation(ctx iris.Context) {
 		return
 	}
 
-	// Calculate total price
-	nights := int(input.CheckOut.Sub(input.CheckIn).Hours() / 24)
-	if nights < 1 {
-		nights = 1
+	party := services.Party{Guests: input.NumGuests, Children: input.NumChildren, Infants: input.NumInfants}
+	violations, err := services.CheckBookingRules(storage.DB, &property, input.CheckIn, input.CheckOut, party)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if len(violations) > 0 {
+		writeRuleViolations(ctx, violations)
+		return
 	}
 
-	nightlyPrice := property.NightlyPrice
-	cleaningFee := float32(0)
-	serviceFee := float32(0)
-
-	// Calculate cleaning fee (2% of nightly price)
-	cleaningFee = nightlyPrice * 0.02
-
-	// Calculate service fee (0% for now, can be configured later)
-	serviceFee = 0
-
-	totalPrice := (nightlyPrice * float32(nights)) + cleaningFee + serviceFee
+	priceRequest := pricing.Request{
+		PropertyID: property.ID,
+		CheckIn:    input.CheckIn,
+		CheckOut:   input.CheckOut,
+		Guests:     input.NumGuests,
+		Children:   input.NumChildren,
+		Infants:    input.NumInfants,
+		CouponCode: input.CouponCode,
+		UserID:     claims.ID,
+	}
 
 	// Persist reservation
 	var reservation models.Reservation
-	parsedID, _ := strconv.ParseUint(propertyID, 10, 64)
-	reservation.PropertyID = uint(parsedID)
+	reservation.PropertyID = property.ID
 	reservation.GuestID = claims.ID
 	reservation.CheckIn = input.CheckIn
 	reservation.CheckOut = input.CheckOut
 	reservation.NumGuests = input.NumGuests
-	reservation.TotalPrice = totalPrice
-	reservation.Status = "pending"
+	reservation.NumChildren = input.NumChildren
+	reservation.NumInfants = input.NumInfants
+	reservation.Status = services.ReservationPending
 	reservation.Note = input.Note
 	reservation.ExpiresAt = time.Now().Add(24 * time.Hour)
 
-	createRes := storage.DB.Create(&reservation)
-	if createRes.Error != nil {
+	// Instant properties (and hybrid ones, for guests meeting the host's criteria) confirm right away
+	decision, err := services.DecideBookingMode(storage.DB, &property, claims.ID, pricing.Nights(input.CheckIn, input.CheckOut))
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	reservation.BookingMode = decision.Mode
+
+	var priceQuote *models.PriceQuote
+	var breakdown pricing.Breakdown
+	if input.QuoteID != "" {
+		// Honour the price the guest was shown, as long as the quote is still valid for this stay
+		priceQuote, err = pricing.FindQuote(storage.DB, input.QuoteID)
+		if err == nil {
+			err = pricing.CheckQuote(priceQuote, priceRequest, time.Now())
+		}
+		if err != nil {
+			writeQuoteError(ctx, err, priceRequest)
+			return
+		}
+		reservation.TotalPrice = float32(priceQuote.Total)
+		reservation.Currency = priceQuote.Currency
+		reservation.PriceBreakdown = priceQuote.Breakdown
+		reservation.QuoteID = &priceQuote.ID
+		if err := json.Unmarshal(priceQuote.Breakdown, &breakdown); err != nil {
+			utils.CreateInternalServerError(ctx)
+			return
+		}
+	} else {
+		// Price the stay with the same engine used for quotes
+		quote, err := pricing.Quote(storage.DB, priceRequest)
+		if writeCouponError(ctx, "message", err) {
+			return
+		}
+		if err != nil {
+			utils.CreateInternalServerError(ctx)
+			return
+		}
+		breakdown = *quote
+		reservation.TotalPrice = float32(quote.Total)
+		reservation.Currency = quote.Currency
+		reservation.PriceBreakdown = quote.JSON()
+	}
+
+	reservation.DisplayCurrency = reservation.Currency
+	reservation.ExchangeRate = 1
+	if rates != nil {
+		rate, err := rates.Rate(reservation.Currency, input.Currency)
+		if err != nil {
+			writeCurrencyError(ctx, "message", err)
+			return
+		}
+		reservation.DisplayCurrency = fx.Normalize(input.Currency)
+		reservation.ExchangeRate = rate
+	}
+
+	// Check availability and insert under the property lock so two guests can't take the same nights
+	conflict, err := services.ReserveStay(storage.DB, property.ID, input.CheckIn, input.CheckOut, 0, func(tx *gorm.DB, locked *models.Property) error {
+		// Freeze the policy in force now; later edits don't change this booking's refunds
+		policy, err := cancellation.Resolve(tx, locked)
+		if err != nil {
+			return err
+		}
+		reservation.CancellationPolicy = policy.JSON()
+		if err := tx.Create(&reservation).Error; err != nil {
+			return err
+		}
+		if err := services.RecordReservationTransition(tx, reservation.ID, "", reservation.Status, services.Actor{Role: services.ActorGuest, UserID: claims.ID}, ""); err != nil {
+			return err
+		}
+		if err := pricing.RecordReservationTaxes(tx, &reservation); err != nil {
+			return err
+		}
+		if err := services.ClaimWaitlist(tx, &reservation); err != nil {
+			return err
+		}
+		if priceQuote != nil {
+			if err := pricing.ConsumeQuote(tx, priceQuote, reservation.ID); err != nil {
+				return err
+			}
+		}
+		// The promo code is checked again with the coupon locked, limits may have been reached since the quote
+		if breakdown.CouponID != 0 {
+			target := pricing.CouponTarget(&breakdown, &property, claims.ID)
+			if _, err := coupons.Redeem(tx, breakdown.CouponID, target, reservation.ID, breakdown.CouponDiscount); err != nil {
+				return err
+			}
+		}
+		// Hold the amount now; it is captured when the host confirms, or right away for instant bookings
+		if _, err = payments.Authorize(tx, reservationCharge(&reservation, property.HostID)); err != nil {
+			return err
+		}
+		if decision.Instant() {
+			return confirmReservation(tx, &reservation, locked, services.SystemActor, "instant booking")
+		}
+		return nil
+	})
+	if errors.Is(err, services.ErrDatesUnavailable) {
+		writeAvailabilityConflict(ctx, conflict)
+		return
+	}
+	if errors.Is(err, payments.ErrDeclined) {
+		utils.CreateError(iris.StatusPaymentRequired, "Payment Declined", "The payment could not be authorized", ctx)
+		return
+	}
+	if errors.Is(err, pricing.ErrQuoteUsed) || errors.Is(err, pricing.ErrQuoteExpired) {
+		writeQuoteError(ctx, err, priceRequest)
+		return
+	}
+	if writeCouponError(ctx, "message", err) {
+		return
+	}
+	if err != nil {
 		utils.CreateInternalServerError(ctx)
 		return
 	}
@@ -158,9 +374,15 @@ func CreateReservation(ctx iris.Context) {
 	// Create notification for host
 	var notification models.Notification
 	notification.UserID = property.HostID
-	notification.Title = "New Reservation Request"
-	notification.Message = fmt.Sprintf("You have a new reservation request for %s from %s to %s", property.Title, input.CheckIn.Format("Jan 2, 2006"), input.CheckOut.Format("Jan 2, 2006"))
-	notification.Type = "reservation_request"
+	if decision.Instant() {
+		notification.Title = "New Booking"
+		notification.Message = fmt.Sprintf("%s is booked from %s to %s", property.Title, input.CheckIn.Format("Jan 2, 2006"), input.CheckOut.Format("Jan 2, 2006"))
+		notification.Type = "reservation_confirmed"
+	} else {
+		notification.Title = "New Reservation Request"
+		notification.Message = fmt.Sprintf("You have a new reservation request for %s from %s to %s", property.Title, input.CheckIn.Format("Jan 2, 2006"), input.CheckOut.Format("Jan 2, 2006"))
+		notification.Type = "reservation_request"
+	}
 	notification.RefID = uint(reservation.ID)
 	notification.RefType = "reservation"
 	notification.IsRead = false
@@ -177,14 +399,32 @@ func CreateReservation(ctx iris.Context) {
 		log.Printf("👤 RESERVATION DEBUG: Guest ID=%d, Name='%s'", claims.ID, guestName)
 
 		notificationService := services.NewNotificationService()
-		go notificationService.SendReservationNotificationToHost(
-			reservation.ID,
-			property.ID,
-			property.HostID,
-			claims.ID,
-			guestName,
-			property.Title,
-		)
+		if decision.Instant() {
+			go notificationService.SendInstantBookingNotificationToHost(
+				reservation.ID,
+				property.ID,
+				property.HostID,
+				claims.ID,
+				guestName,
+				property.Title,
+			)
+			go notificationService.SendBookingConfirmedNotificationToGuest(
+				reservation.ID,
+				property.ID,
+				claims.ID,
+				property.HostID,
+				property.Title,
+			)
+		} else {
+			go notificationService.SendReservationNotificationToHost(
+				reservation.ID,
+				property.ID,
+				property.HostID,
+				claims.ID,
+				guestName,
+				property.Title,
+			)
+		}
 	}
 
 	ctx.JSON(reservation)
@@ -193,9 +433,11 @@ func CreateReservation(ctx iris.Context) {
 // Update reservation status (host action): confirm or reject
 type UpdateReservationStatusInput struct {
 	Status string `json:"status" validate:"required,oneof=confirmed rejected cancelled"`
+	Reason string `json:"reason"` // kept in the reservation's history
 }
 
 func UpdateReservationStatus(ctx iris.Context) {
+	claims := jwt.Get(ctx).(*utils.AccessToken)
 	id := ctx.Params().Get("id")
 
 	var input UpdateReservationStatusInput
@@ -209,54 +451,59 @@ func UpdateReservationStatus(ctx iris.Context) {
 		utils.CreateError(iris.StatusNotFound, "Not Found", "Reservation not found", ctx)
 		return
 	}
-
-	// Auto-expire if past ExpiresAt and still pending
-	if reservation.Status == "pending" && time.Now().After(reservation.ExpiresAt) {
-		reservation.Status = "expired"
-	} else {
-		reservation.Status = input.Status
+	if reservation.Property == nil || reservation.Property.HostID != claims.ID {
+		utils.CreateError(iris.StatusForbidden, "Forbidden", "Only the host can update this reservation", ctx)
+		return
 	}
 
-	if err := storage.DB.Save(&reservation).Error; err != nil {
-		utils.CreateInternalServerError(ctx)
+	// A request the host answers after ExpiresAt expires instead
+	status, actor, reason := input.Status, services.Actor{Role: services.ActorHost, UserID: claims.ID}, input.Reason
+	if reservation.Status == services.ReservationPending && time.Now().After(reservation.ExpiresAt) {
+		status, actor, reason = services.ReservationExpired, services.SystemActor, "the host did not answer in time"
+	}
+	if !services.CanTransition(reservation.Status, status, actor.Role) {
+		utils.CreateError(iris.StatusConflict, "Invalid Status", fmt.Sprintf("A %s reservation can't be %s", reservation.Status, status), ctx)
 		return
 	}
 
-	// When confirmed, block dates in availability as not available
-	if reservation.Status == "confirmed" {
-		start := reservation.CheckIn
-		end := reservation.CheckOut
-		for d := start; d.Before(end); d = d.Add(24 * time.Hour) {
-			day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, d.Location())
-			var avail models.PropertyAvailability
-			if err := storage.DB.Where("property_id = ? AND date = ?", reservation.PropertyID, day).First(&avail).Error; err == nil && avail.ID != 0 {
-				storage.DB.Model(&avail).Updates(map[string]interface{}{
-					"is_available": false,
-					"notes":        "booked",
-				})
-			} else {
-				price := float64(reservation.Property.NightlyPrice)
-				newAvail := models.PropertyAvailability{
-					PropertyID:   reservation.PropertyID,
-					Date:         day,
-					IsAvailable:  false,
-					Price:        price,
-					MinStay:      1,
-					MaxStay:      0,
-					CheckInTime:  "15:00",
-					CheckOutTime: "11:00",
-					Notes:        "booked",
-				}
-				storage.DB.Where("property_id = ? AND date = ?", reservation.PropertyID, day).FirstOrCreate(&newAvail)
-			}
+	if status == services.ReservationConfirmed {
+		// Confirmation re-checks the calendar under the property lock, ignoring this reservation itself,
+		// and captures the guest's payment
+		conflict, err := services.ReserveStay(storage.DB, reservation.PropertyID, reservation.CheckIn, reservation.CheckOut, reservation.ID, func(tx *gorm.DB, property *models.Property) error {
+			return confirmReservation(tx, &reservation, property, actor, reason)
+		})
+		if errors.Is(err, services.ErrDatesUnavailable) {
+			writeAvailabilityConflict(ctx, conflict)
+			return
+		}
+		if writeTransitionError(ctx, err) {
+			return
+		}
+		if err != nil {
+			utils.CreateInternalServerError(ctx)
+			return
+		}
+	} else {
+		// Rejected, expired or cancelled by the host: the guest gets everything back
+		err := payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+			_, err := releaseReservation(tx, &reservation, status, actor, reason, "reservation "+status)
+			return err
+		})
+		if writeTransitionError(ctx, err) {
+			return
+		}
+		if err != nil {
+			utils.CreateInternalServerError(ctx)
+			return
 		}
+		offerToWaitlist(reservation.PropertyID, reservation.CheckIn, reservation.CheckOut)
 	}
 
 	// Create notification for guest about status change
 	var notification models.Notification
 	notification.UserID = reservation.GuestID
 	notification.Title = "Reservation Status Updated"
-	notification.Message = fmt.Sprintf("Your reservation for %s has been %s", reservation.Property.Title, input.Status)
+	notification.Message = fmt.Sprintf("Your reservation for %s has been %s", reservation.Property.Title, reservation.Status)
 	notification.Type = "reservation_status"
 	notification.RefID = uint(reservation.ID)
 	notification.RefType = "reservation"
@@ -270,7 +517,7 @@ func UpdateReservationStatus(ctx iris.Context) {
 		hostName := fmt.Sprintf("%s %s", host.FirstName, host.LastName)
 		notificationService := services.NewNotificationService()
 
-		if input.Status == "confirmed" {
+		if reservation.Status == services.ReservationConfirmed {
 			go notificationService.SendReservationAcceptanceNotificationToGuest(
 				reservation.ID,
 				reservation.PropertyID,
@@ -279,7 +526,7 @@ func UpdateReservationStatus(ctx iris.Context) {
 				hostName,
 				reservation.Property.Title,
 			)
-		} else if input.Status == "rejected" {
+		} else if reservation.Status == services.ReservationRejected {
 			go notificationService.SendReservationRejectionNotificationToGuest(
 				reservation.ID,
 				reservation.PropertyID,
@@ -312,16 +559,10 @@ func CancelReservation(ctx iris.Context) {
 		return
 	}
 
-	// Check if reservation can be cancelled
-	if reservation.Status == "confirmed" || reservation.Status == "completed" {
+	// Check if reservation can be cancelled; confirmed stays follow the cancellation policy below
+	if !services.CanTransition(reservation.Status, services.ReservationCancelled, services.ActorGuest) {
 		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"message": "Cannot cancel confirmed or completed reservations"})
-		return
-	}
-
-	if reservation.Status == "cancelled" {
-		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"message": "Reservation is already cancelled"})
+		ctx.JSON(iris.Map{"message": fmt.Sprintf("Cannot cancel a %s reservation", reservation.Status)})
 		return
 	}
 
@@ -337,26 +578,42 @@ func CancelReservation(ctx iris.Context) {
 		return
 	}
 
-	// Update reservation status
-	reservation.Status = "cancelled"
-	if err := storage.DB.Save(&reservation).Error; err != nil {
+	// Update reservation status and return the money: a pending request was only authorized
+	// and is released in full, a confirmed stay is refunded according to the policy
+	err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		if err := services.TransitionReservation(tx, &reservation, services.ReservationCancelled, services.Actor{Role: services.ActorGuest, UserID: userID}, reason); err != nil {
+			return err
+		}
+		refunded, err := payments.Release(tx, payments.SubjectReservation, reservation.ID, float64(refundAmount), reason)
+		if err != nil {
+			return err
+		}
+		if refunded > 0 {
+			refundAmount = float32(refunded)
+		}
+		// The credit note follows the cancellation policy: it covers what the guest gets back
+		if _, err := invoices.IssueCreditNote(tx, payments.SubjectReservation, reservation.ID, refunded, reason); err != nil {
+			return err
+		}
+		// The promo code can be used again
+		if err := coupons.Release(tx, payments.SubjectReservation, reservation.ID); err != nil {
+			return err
+		}
+		return services.ReleaseReservationDeposit(tx, reservation.ID, "reservation cancelled")
+	})
+	if errors.Is(err, services.ErrStatusChanged) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": "The reservation was updated meanwhile, please try again"})
+		return
+	}
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to cancel reservation"})
 		return
 	}
 
-	// Free up the dates in availability
-	start := reservation.CheckIn
-	end := reservation.CheckOut
-	for d := start; d.Before(end); d = d.Add(24 * time.Hour) {
-		day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, d.Location())
-		storage.DB.Model(&models.PropertyAvailability{}).
-			Where("property_id = ? AND date = ?", reservation.PropertyID, day).
-			Updates(map[string]interface{}{
-				"is_available": true,
-				"notes":        "",
-			})
-	}
+	// The nights free up with the status change
+	offerToWaitlist(reservation.PropertyID, reservation.CheckIn, reservation.CheckOut)
 
 	// Create notification
 	var notification models.Notification
@@ -378,54 +635,37 @@ func CancelReservation(ctx iris.Context) {
 	})
 }
 
-// calculateRefund determines refund amount based on cancellation policy
+// calculateRefund determines the refund from the cancellation policy snapshotted on the
+// reservation. Reservations made before snapshots existed use the property's current policy.
 func calculateRefund(reservation models.Reservation) (float32, bool, string) {
-	now := time.Now()
-	checkIn := reservation.CheckIn
-	policy := reservation.Property.CancellationPolicy
-
-	// Calculate days until check-in
-	daysUntilCheckIn := int(checkIn.Sub(now).Hours() / 24)
-
-	switch policy {
-	case "flexible":
-		// Full refund if cancelled 24+ hours before check-in
-		if daysUntilCheckIn >= 1 {
-			return reservation.TotalPrice, true, "Full refund - cancelled 24+ hours before check-in"
-		}
-		return 0, false, "No refund - cancelled less than 24 hours before check-in"
-
-	case "moderate":
-		// Full refund if cancelled 5+ days before check-in
-		if daysUntilCheckIn >= 5 {
-			return reservation.TotalPrice, true, "Full refund - cancelled 5+ days before check-in"
-		}
-		// 50% refund if cancelled 1-4 days before check-in
-		if daysUntilCheckIn >= 1 {
-			return reservation.TotalPrice * 0.5, true, "50% refund - cancelled 1-4 days before check-in"
-		}
-		return 0, false, "No refund - cancelled less than 24 hours before check-in"
-
-	case "strict":
-		// 50% refund if cancelled 7+ days before check-in
-		if daysUntilCheckIn >= 7 {
-			return reservation.TotalPrice * 0.5, true, "50% refund - cancelled 7+ days before check-in"
-		}
-		return 0, false, "No refund - cancelled less than 7 days before check-in"
+	policy, err := cancellation.Decode(reservation.CancellationPolicy)
+	if err != nil && reservation.Property != nil {
+		policy, err = cancellation.Resolve(storage.DB, reservation.Property)
+	}
+	if err != nil {
+		fallback := cancellation.Preset(cancellation.DefaultKey)
+		policy = &fallback
+	}
 
-	default:
-		// Default to flexible policy
-		if daysUntilCheckIn >= 1 {
-			return reservation.TotalPrice, true, "Full refund - cancelled 24+ hours before check-in"
-		}
-		return 0, false, "No refund - cancelled less than 24 hours before check-in"
+	fees := 0.0
+	if breakdown, err := pricing.Decode(reservation.PriceBreakdown); err == nil {
+		fees = breakdown.CleaningFee + breakdown.ServiceFee
+	} else if reservation.Property != nil {
+		fees = float64(reservation.Property.CleaningFee + reservation.Property.ServiceFee)
 	}
+
+	result := policy.Evaluate(float64(reservation.TotalPrice), fees, reservation.CheckIn, time.Now())
+	return float32(result.Refund), result.CanCancel, result.Reason
 }
 
 // ValidateAvailabilityInput is used to check if a date range is free for booking
 type ValidateAvailabilityInput struct {
-	CheckIn  time.Time `json:"checkIn" validate:"required"`
-	CheckOut time.Time `json:"checkOut" validate:"required"`
+	CheckIn   time.Time `json:"checkIn" validate:"required"`
+	CheckOut  time.Time `json:"checkOut" validate:"required"`
+	NumGuests int       `json:"numGuests" validate:"gte=0"` // optional, defaults to one guest
+	// Children are counted in NumGuests, infants are not
+	NumChildren int `json:"numChildren" validate:"gte=0"`
+	NumInfants  int `json:"numInfants" validate:"gte=0"`
 }
 
 // ValidateReservationAvailability checks for conflicts before attempting to create a reservation
@@ -443,46 +683,181 @@ func ValidateReservationAvailability(ctx iris.Context) {
 		return
 	}
 
-	// Check overlapping confirmed reservations
-	var conflicts int64
-	storage.DB.Model(&models.Reservation{}).
-		Where("property_id = ? AND status = ? AND check_in < ? AND check_out > ?", propertyID, "confirmed", input.CheckOut, input.CheckIn).
-		Count(&conflicts)
-
-	// Additionally, check availability rows explicitly blocked (IsAvailable = false)
-	// Iterate dates and verify none are blocked
-	blocked := 0
-	start := input.CheckIn
-	end := input.CheckOut
-	for d := start; d.Before(end); d = d.Add(24 * time.Hour) {
-		day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, d.Location())
-		var avail models.PropertyAvailability
-		if err := storage.DB.Where("property_id = ? AND date = ?", propertyID, day).First(&avail).Error; err == nil {
-			if !avail.IsAvailable {
-				blocked++
-			}
-		}
+	parsedID, err := strconv.ParseUint(propertyID, 10, 64)
+	if err != nil {
+		utils.CreateError(iris.StatusBadRequest, "Validation Error", "Invalid property ID", ctx)
+		return
 	}
 
-	if conflicts > 0 || blocked > 0 {
-		ctx.StatusCode(iris.StatusConflict)
-		ctx.JSON(iris.Map{
-			"ok":        false,
-			"conflicts": conflicts,
-			"blocked":   blocked,
-			"message":   "Selected dates are not available",
-		})
+	var property models.Property
+	if err := storage.DB.First(&property, parsedID).Error; err != nil {
+		utils.CreateError(iris.StatusNotFound, "Not Found", "Property not found", ctx)
+		return
+	}
+	party := services.Party{Guests: input.NumGuests, Children: input.NumChildren, Infants: input.NumInfants}
+	if party.Guests == 0 {
+		party.Guests = 1
+	}
+	violations, err := services.CheckBookingRules(storage.DB, &property, input.CheckIn, input.CheckOut, party)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if len(violations) > 0 {
+		writeRuleViolations(ctx, violations)
+		return
+	}
+
+	// Same check that reservation creation runs inside its transaction
+	conflict, err := services.CheckStayAvailability(storage.DB, uint(parsedID), input.CheckIn, input.CheckOut, 0)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	if conflict.Any() {
+		writeAvailabilityConflict(ctx, conflict)
 		return
 	}
 
 	ctx.JSON(iris.Map{"ok": true})
 }
 
-// Cron-like endpoint to expire old pending reservations (can be called by a scheduler)
-func ExpirePendingReservations(ctx iris.Context) {
-	// Set any pending reservations older than 24h to expired
-	storage.DB.Model(&models.Reservation{}).
-		Where("status = ? AND expires_at < ?", "pending", time.Now()).
-		Update("status", "expired")
-	ctx.JSON(iris.Map{"ok": true})
+// writeAvailabilityConflict answers 409 with the details of what occupies the requested nights
+func writeAvailabilityConflict(ctx iris.Context, conflict services.AvailabilityConflict) {
+	ctx.StatusCode(iris.StatusConflict)
+	ctx.JSON(iris.Map{
+		"ok":        false,
+		"conflicts": conflict.Reservations,
+		"blocks":    conflict.Blocks,
+		"blocked":   conflict.BlockedDays,
+		"message":   "Selected dates are not available",
+		"waitlist":  true, // the guest can wait for the dates, see JoinWaitlist
+	})
+}
+
+// confirmReservation confirms a reservation inside the booking transaction: it captures the
+// guest's payment and holds the security deposit. The confirmed status itself takes the
+// nights off the calendar.
+// Hosts confirming a request and instant bookings (actor system) both go through here.
+func confirmReservation(tx *gorm.DB, reservation *models.Reservation, property *models.Property, actor services.Actor, reason string) error {
+	if err := services.TransitionReservation(tx, reservation, services.ReservationConfirmed, actor, reason); err != nil {
+		return err
+	}
+	intent, err := payments.IntentFor(tx, payments.SubjectReservation, reservation.ID)
+	if err == nil {
+		err = payments.Capture(tx, intent)
+	}
+	if err != nil && !errors.Is(err, payments.ErrNoPayment) {
+		return err
+	}
+	if _, err := invoices.ReservationReceipt(tx, reservation.ID); err != nil {
+		return err
+	}
+	// The security deposit is held from confirmation until after checkout
+	_, err = services.HoldSecurityDeposit(tx, reservation, property.HostID, reservationDeposit(reservation))
+	return err
+}
+
+// releaseReservation rejects, expires or cancels a reservation inside a transaction and gives
+// the guest everything back: the payment is released or refunded in full with a credit note,
+// and the promo code and the security deposit are released. It returns the amount refunded.
+// Hosts and admins both go through here.
+func releaseReservation(tx *gorm.DB, reservation *models.Reservation, status string, actor services.Actor, reason, note string) (float64, error) {
+	if err := services.TransitionReservation(tx, reservation, status, actor, reason); err != nil {
+		return 0, err
+	}
+	refunded, err := payments.Release(tx, payments.SubjectReservation, reservation.ID, float64(reservation.TotalPrice), note)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := invoices.IssueCreditNote(tx, payments.SubjectReservation, reservation.ID, refunded, note); err != nil {
+		return 0, err
+	}
+	if err := coupons.Release(tx, payments.SubjectReservation, reservation.ID); err != nil {
+		return 0, err
+	}
+	return refunded, services.ReleaseReservationDeposit(tx, reservation.ID, note)
+}
+
+// writeTransitionError answers 409 when a status change isn't allowed or another request
+// changed the status first, and reports whether it did
+func writeTransitionError(ctx iris.Context, err error) bool {
+	if errors.Is(err, services.ErrInvalidTransition) || errors.Is(err, services.ErrStatusChanged) {
+		utils.CreateError(iris.StatusConflict, "Invalid Status", err.Error(), ctx)
+		return true
+	}
+	return false
+}
+
+// writeRuleViolations answers 422 with the booking rules the stay breaks
+func writeRuleViolations(ctx iris.Context, violations []services.RuleViolation) {
+	ctx.StatusCode(iris.StatusUnprocessableEntity)
+	ctx.JSON(iris.Map{
+		"ok":         false,
+		"violations": violations,
+		"message":    violations[0].Message,
+	})
+}
+
+// reservationCharge is what the guest pays for a reservation; the service fee is the platform's share
+func reservationCharge(reservation *models.Reservation, hostID uint) payments.Charge {
+	fee, tax := 0.0, 0.0
+	if breakdown, err := pricing.Decode(reservation.PriceBreakdown); err == nil {
+		fee = breakdown.ServiceFee
+		tax = breakdown.TaxAmount
+	}
+	return payments.Charge{
+		SubjectType: payments.SubjectReservation,
+		SubjectID:   reservation.ID,
+		PayerID:     reservation.GuestID,
+		PayeeID:     hostID,
+		Amount:      float64(reservation.TotalPrice),
+		PlatformFee: fee,
+		Tax:         tax,
+		Currency:    reservation.Currency,
+		Description: fmt.Sprintf("Reservation #%d", reservation.ID),
+	}
+}
+
+// reservationDeposit is the security deposit priced into the reservation
+func reservationDeposit(reservation *models.Reservation) float64 {
+	if breakdown, err := pricing.Decode(reservation.PriceBreakdown); err == nil {
+		return breakdown.SecurityDeposit
+	}
+	return 0
+}
+
+// writeQuoteError explains why a quote can't be honoured. Expired quotes are re-priced so the
+// client can show the new figure and book again with the fresh quote.
+func writeQuoteError(ctx iris.Context, err error, req pricing.Request) {
+	switch {
+	case errors.Is(err, pricing.ErrQuoteNotFound):
+		utils.CreateError(iris.StatusBadRequest, "Invalid Quote", "Quote not found", ctx)
+	case errors.Is(err, pricing.ErrQuoteMismatch):
+		utils.CreateError(iris.StatusBadRequest, "Invalid Quote", "Quote does not match the requested property, dates, guests or promo code", ctx)
+	case errors.Is(err, pricing.ErrQuoteUsed):
+		utils.CreateError(iris.StatusConflict, "Invalid Quote", "Quote has already been used", ctx)
+	case errors.Is(err, pricing.ErrQuoteExpired):
+		issued, quote, err := pricing.IssueQuote(storage.DB, req)
+		if writeCouponError(ctx, "message", err) {
+			return
+		}
+		if err != nil {
+			utils.CreateInternalServerError(ctx)
+			return
+		}
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{
+			"ok":         false,
+			"message":    "Quote has expired, please review the updated price",
+			"quoteId":    issued.Token,
+			"expiresAt":  issued.ExpiresAt,
+			"totalPrice": quote.Total,
+			"currency":   quote.Currency,
+			"lineItems":  quote.LineItems,
+		})
+	default:
+		utils.CreateInternalServerError(ctx)
+	}
 }
@@ -1,19 +1,27 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
 	"apartments-clone-server/models"
+	"apartments-clone-server/pricing"
+	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
 
 	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"gorm.io/gorm"
 )
 
 // Availability Management Routes
 
+// maxCalendarRange bounds the nights resolved for one availability request
+const maxCalendarRange = 366 * 24 * time.Hour
+
 type AvailabilityInput struct {
 	PropertyID   uint      `json:"propertyID" validate:"required"`
 	Date         time.Time `json:"date" validate:"required"`
@@ -49,6 +57,12 @@ type PricingInput struct {
 	ServiceFee      float64 `json:"serviceFee" validate:"min=0"`
 	SecurityDeposit float64 `json:"securityDeposit" validate:"min=0"`
 	Currency        string  `json:"currency"`
+	// Occupancy pricing, see models.PropertyPricing; nil child/infant settings mean no rule of their own
+	BaseOccupancy int      `json:"baseOccupancy" validate:"min=0"`
+	ExtraGuestFee float64  `json:"extraGuestFee" validate:"min=0"`
+	ChildFee      *float64 `json:"childFee" validate:"omitempty,min=0"`
+	MaxChildren   *int     `json:"maxChildren" validate:"omitempty,min=0"`
+	MaxInfants    *int     `json:"maxInfants" validate:"omitempty,min=0"`
 }
 
 type DiscountInput struct {
@@ -63,6 +77,21 @@ type DiscountInput struct {
 	IsActive   bool      `json:"isActive"`
 }
 
+type BookingRulesInput struct {
+	PropertyID         uint   `json:"propertyID" validate:"required"`
+	MinStay            int    `json:"minStay" validate:"min=1"`
+	MaxStay            int    `json:"maxStay" validate:"min=0"`
+	CheckInDays        string `json:"checkInDays"` // e.g. "fri,sat"; empty allows any day
+	AdvanceNoticeHours int    `json:"advanceNoticeHours" validate:"min=0"`
+	BookingWindowDays  int    `json:"bookingWindowDays" validate:"min=0"`
+}
+
+type BookingModeInput struct {
+	PropertyID  uint                         `json:"propertyID" validate:"required"`
+	BookingMode string                       `json:"bookingMode" validate:"required,oneof=instant request hybrid"`
+	InstantBook services.InstantBookCriteria `json:"instantBook"` // used in hybrid mode
+}
+
 type BlockInput struct {
 	PropertyID    uint      `json:"propertyID" validate:"required"`
 	StartDate     time.Time `json:"startDate" validate:"required"`
@@ -104,11 +133,15 @@ func GetPropertyAvailability(ctx iris.Context) {
 		return
 	}
 
-	var availability []models.PropertyAvailability
-	result := storage.DB.Where("property_id = ? AND date >= ? AND date <= ?",
-		propertyID, startDate, endDate).Order("date ASC").Find(&availability)
+	if endDate.Before(startDate) || endDate.Sub(startDate) > maxCalendarRange {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "End date must be on or after start date, at most a year later"})
+		return
+	}
 
-	if result.Error != nil {
+	// End date is inclusive
+	availability, err := services.ResolveCalendar(storage.DB, uint(propertyID), startDate, endDate.AddDate(0, 0, 1))
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to fetch availability"})
 		return
@@ -138,60 +171,34 @@ func SetPropertyAvailability(ctx iris.Context) {
 		return
 	}
 
-	// Check if availability already exists for this date
-	var existingAvailability models.PropertyAvailability
-	result := storage.DB.Where("property_id = ? AND date = ?", input.PropertyID, input.Date).First(&existingAvailability)
-
-	if result.Error == nil {
-		// Update existing availability
-		existingAvailability.IsAvailable = input.IsAvailable
-		existingAvailability.Price = input.Price
-		existingAvailability.MinStay = input.MinStay
-		existingAvailability.MaxStay = input.MaxStay
-		existingAvailability.CheckInTime = input.CheckInTime
-		existingAvailability.CheckOutTime = input.CheckOutTime
-		existingAvailability.Notes = input.Notes
-
-		if err := storage.DB.Save(&existingAvailability).Error; err != nil {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.JSON(iris.Map{"message": "Failed to update availability"})
-			return
-		}
-
-		ctx.JSON(iris.Map{
-			"success": true,
-			"message": "Availability updated successfully",
-			"data":    existingAvailability,
-		})
-	} else {
-		// Create new availability
-		availability := models.PropertyAvailability{
-			PropertyID:   input.PropertyID,
-			Date:         input.Date,
-			IsAvailable:  input.IsAvailable,
-			Price:        input.Price,
-			MinStay:      input.MinStay,
-			MaxStay:      input.MaxStay,
-			CheckInTime:  input.CheckInTime,
-			CheckOutTime: input.CheckOutTime,
-			Notes:        input.Notes,
-		}
-
-		if err := storage.DB.Create(&availability).Error; err != nil {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.JSON(iris.Map{"message": "Failed to create availability"})
-			return
-		}
-
-		ctx.JSON(iris.Map{
-			"success": true,
-			"message": "Availability created successfully",
-			"data":    availability,
-		})
+	rule := models.AvailabilityRule{
+		PropertyID:   input.PropertyID,
+		StartDate:    input.Date,
+		EndDate:      input.Date.AddDate(0, 0, 1),
+		IsAvailable:  input.IsAvailable,
+		Price:        input.Price,
+		MinStay:      input.MinStay,
+		MaxStay:      input.MaxStay,
+		CheckInTime:  input.CheckInTime,
+		CheckOutTime: input.CheckOutTime,
+		Notes:        input.Notes,
+	}
+	if err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SetAvailabilityRange(tx, &rule)
+	}); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update availability"})
+		return
 	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Availability updated successfully",
+		"data":    rule,
+	})
 }
 
-// Set bulk availability for date range
+// Set bulk availability for date range; both dates are included
 func SetBulkPropertyAvailability(ctx iris.Context) {
 	userID := ctx.Values().Get("userID").(uint)
 	var input BulkAvailabilityInput
@@ -201,6 +208,12 @@ func SetBulkPropertyAvailability(ctx iris.Context) {
 		return
 	}
 
+	if input.EndDate.Before(input.StartDate) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "End date must be on or after start date"})
+		return
+	}
+
 	// Verify property ownership
 	var property models.Property
 	if err := storage.DB.Where("id = ? AND host_id = ?", input.PropertyID, userID).First(&property).Error; err != nil {
@@ -209,55 +222,32 @@ func SetBulkPropertyAvailability(ctx iris.Context) {
 		return
 	}
 
-	// Generate dates between start and end
-	var availabilities []models.PropertyAvailability
-	currentDate := input.StartDate
-	for currentDate.Before(input.EndDate) || currentDate.Equal(input.EndDate) {
-		availabilities = append(availabilities, models.PropertyAvailability{
-			PropertyID:   input.PropertyID,
-			Date:         currentDate,
-			IsAvailable:  input.IsAvailable,
-			Price:        input.Price,
-			MinStay:      input.MinStay,
-			MaxStay:      input.MaxStay,
-			CheckInTime:  input.CheckInTime,
-			CheckOutTime: input.CheckOutTime,
-			Notes:        input.Notes,
-		})
-		currentDate = currentDate.AddDate(0, 0, 1)
-	}
-
-	// Use transaction to ensure atomicity
-	tx := storage.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Delete existing availability for the date range
-	if err := tx.Where("property_id = ? AND date >= ? AND date <= ?",
-		input.PropertyID, input.StartDate, input.EndDate).Delete(&models.PropertyAvailability{}).Error; err != nil {
-		tx.Rollback()
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"message": "Failed to clear existing availability"})
-		return
-	}
-
-	// Create new availability records
-	if err := tx.Create(&availabilities).Error; err != nil {
-		tx.Rollback()
+	// A single rule covers the whole range
+	rule := models.AvailabilityRule{
+		PropertyID:   input.PropertyID,
+		StartDate:    input.StartDate,
+		EndDate:      input.EndDate.AddDate(0, 0, 1),
+		IsAvailable:  input.IsAvailable,
+		Price:        input.Price,
+		MinStay:      input.MinStay,
+		MaxStay:      input.MaxStay,
+		CheckInTime:  input.CheckInTime,
+		CheckOutTime: input.CheckOutTime,
+		Notes:        input.Notes,
+	}
+	if err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SetAvailabilityRange(tx, &rule)
+	}); err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to create bulk availability"})
 		return
 	}
 
-	tx.Commit()
-
+	days := int(rule.EndDate.Sub(rule.StartDate).Hours() / 24)
 	ctx.JSON(iris.Map{
 		"success": true,
-		"message": fmt.Sprintf("Bulk availability set for %d days", len(availabilities)),
-		"data":    availabilities,
+		"message": fmt.Sprintf("Bulk availability set for %d days", days),
+		"data":    rule,
 	})
 }
 
@@ -318,6 +308,11 @@ func SetPropertyPricing(ctx iris.Context) {
 		existingPricing.ServiceFee = input.ServiceFee
 		existingPricing.SecurityDeposit = input.SecurityDeposit
 		existingPricing.Currency = input.Currency
+		existingPricing.BaseOccupancy = input.BaseOccupancy
+		existingPricing.ExtraGuestFee = input.ExtraGuestFee
+		existingPricing.ChildFee = input.ChildFee
+		existingPricing.MaxChildren = input.MaxChildren
+		existingPricing.MaxInfants = input.MaxInfants
 
 		if err := storage.DB.Save(&existingPricing).Error; err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -342,6 +337,11 @@ func SetPropertyPricing(ctx iris.Context) {
 			ServiceFee:      input.ServiceFee,
 			SecurityDeposit: input.SecurityDeposit,
 			Currency:        input.Currency,
+			BaseOccupancy:   input.BaseOccupancy,
+			ExtraGuestFee:   input.ExtraGuestFee,
+			ChildFee:        input.ChildFee,
+			MaxChildren:     input.MaxChildren,
+			MaxInfants:      input.MaxInfants,
 		}
 
 		if err := storage.DB.Create(&pricing).Error; err != nil {
@@ -458,32 +458,6 @@ func BlockPropertyDates(ctx iris.Context) {
 		return
 	}
 
-	// Also update availability for blocked dates
-	currentDate := input.StartDate
-	for currentDate.Before(input.EndDate) || currentDate.Equal(input.EndDate) {
-		var availability models.PropertyAvailability
-		result := storage.DB.Where("property_id = ? AND date = ?", input.PropertyID, currentDate).First(&availability)
-
-		if result.Error == nil {
-			availability.IsAvailable = false
-			availability.Notes = fmt.Sprintf("Blocked: %s", input.Reason)
-			storage.DB.Save(&availability)
-		} else {
-			// Create new availability record as blocked
-			availability = models.PropertyAvailability{
-				PropertyID:  input.PropertyID,
-				Date:        currentDate,
-				IsAvailable: false,
-				Price:       0,
-				MinStay:     1,
-				MaxStay:     0,
-				Notes:       fmt.Sprintf("Blocked: %s", input.Reason),
-			}
-			storage.DB.Create(&availability)
-		}
-		currentDate = currentDate.AddDate(0, 0, 1)
-	}
-
 	ctx.JSON(iris.Map{
 		"success": true,
 		"message": "Dates blocked successfully",
@@ -516,6 +490,40 @@ func GetPropertyBlocks(ctx iris.Context) {
 	})
 }
 
+// Remove a block; the nights it closed reopen (unless something else holds them) and are offered to the waitlist
+func DeletePropertyBlock(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	blockID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid block ID"})
+		return
+	}
+
+	var block models.PropertyBlock
+	if err := storage.DB.Joins("JOIN properties ON properties.id = property_blocks.property_id").
+		Where("property_blocks.id = ? AND properties.host_id = ?", blockID, userID).
+		First(&block).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Block not found or access denied"})
+		return
+	}
+
+	if err := storage.DB.Delete(&block).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to remove block"})
+		return
+	}
+
+	// Block end dates are inclusive
+	offerToWaitlist(block.PropertyID, block.StartDate, block.EndDate.AddDate(0, 0, 1))
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Block removed successfully",
+	})
+}
+
 // Calculate booking price with discounts
 func CalculateBookingPrice(ctx iris.Context) {
 	var input struct {
@@ -523,6 +531,12 @@ func CalculateBookingPrice(ctx iris.Context) {
 		StartDate  time.Time `json:"startDate" validate:"required"`
 		EndDate    time.Time `json:"endDate" validate:"required"`
 		Guests     int       `json:"guests" validate:"required,min=1"`
+		Children   int       `json:"children" validate:"min=0"` // counted in guests
+		Infants    int       `json:"infants" validate:"min=0"`
+		// Currency optionally asks for the amounts converted for display
+		Currency string `json:"currency"`
+		// CouponCode is a promo code; per-guest limits are only checked when booking
+		CouponCode string `json:"couponCode"`
 	}
 
 	if err := ctx.ReadJSON(&input); err != nil {
@@ -530,94 +544,241 @@ func CalculateBookingPrice(ctx iris.Context) {
 		return
 	}
 
-	// Get property pricing
-	var pricing models.PropertyPricing
-	if err := storage.DB.Where("property_id = ?", input.PropertyID).First(&pricing).Error; err != nil {
+	if !input.StartDate.Before(input.EndDate) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "startDate must be before endDate"})
+		return
+	}
+	rates, err := displayRates(input.Currency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
+
+	req := pricing.Request{
+		PropertyID: input.PropertyID,
+		CheckIn:    input.StartDate,
+		CheckOut:   input.EndDate,
+		Guests:     input.Guests,
+		Children:   input.Children,
+		Infants:    input.Infants,
+		CouponCode: input.CouponCode,
+	}
+	// Signed-in guests get the quote persisted, so a reservation made within its TTL is
+	// charged exactly this amount; anonymous visitors only see the price
+	var issued *models.PriceQuote
+	var quote *pricing.Breakdown
+	if _, signedIn := jwt.Get(ctx).(*utils.AccessToken); signedIn {
+		issued, quote, err = pricing.IssueQuote(storage.DB, req)
+	} else {
+		quote, err = pricing.Quote(storage.DB, req)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		ctx.StatusCode(iris.StatusNotFound)
-		ctx.JSON(iris.Map{"message": "Property pricing not found"})
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
+	if writeCouponError(ctx, "message", err) {
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to calculate price"})
 		return
 	}
 
-	// Calculate base price
-	nights := int(input.EndDate.Sub(input.StartDate).Hours() / 24)
-	basePrice := pricing.BasePrice * float64(nights)
+	var display *models.DisplayPrice
+	if rates != nil {
+		display, _ = rates.Display(quote.Currency, input.Currency, map[string]float64{
+			"basePrice":       quote.BasePrice,
+			"weekendPrice":    quote.WeekendPrice,
+			"seasonalPrice":   quote.PriceRuleAdjustment,
+			"lengthOfStay":    quote.LengthOfStay,
+			"extraGuestFee":   quote.ExtraGuestFee,
+			"cleaningFee":     quote.CleaningFee,
+			"serviceFee":      quote.ServiceFee,
+			"securityDeposit": quote.SecurityDeposit,
+			"discountAmount":  quote.DiscountAmount,
+			"couponDiscount":  quote.CouponDiscount,
+			"taxAmount":       quote.TaxAmount,
+			"totalPrice":      quote.Total,
+		})
+	}
 
-	// Apply weekend pricing
-	weekendPrice := 0.0
-	currentDate := input.StartDate
-	for i := 0; i < nights; i++ {
-		if currentDate.Weekday() == time.Saturday || currentDate.Weekday() == time.Sunday {
-			if pricing.WeekendPrice > 0 {
-				weekendPrice += pricing.WeekendPrice - pricing.BasePrice
-			}
-		}
-		currentDate = currentDate.AddDate(0, 0, 1)
+	data := map[string]interface{}{
+		"basePrice":        quote.BasePrice,
+		"weekendPrice":     quote.WeekendPrice,
+		"seasonalPrice":    quote.PriceRuleAdjustment,
+		"lengthOfStay":     quote.LengthOfStay,
+		"extraGuests":      quote.ExtraGuests,
+		"extraGuestFee":    quote.ExtraGuestFee,
+		"cleaningFee":      quote.CleaningFee,
+		"serviceFee":       quote.ServiceFee,
+		"securityDeposit":  quote.SecurityDeposit,
+		"discountAmount":   quote.DiscountAmount,
+		"appliedDiscounts": quote.AppliedDiscounts,
+		"couponCode":       quote.CouponCode,
+		"couponDiscount":   quote.CouponDiscount,
+		"taxAmount":        quote.TaxAmount,
+		"taxes":            quote.Taxes,
+		"nightlyRates":     quote.NightlyRates,
+		"lineItems":        quote.LineItems,
+		"totalPrice":       quote.Total,
+		"nights":           quote.Nights,
+		"currency":         quote.Currency,
+		"display":          display,
+	}
+	if issued != nil {
+		data["quoteId"] = issued.Token
+		data["expiresAt"] = issued.ExpiresAt
 	}
 
-	// Apply weekly/monthly discounts
-	var discountAmount float64
-	if nights >= 7 && pricing.WeeklyPrice > 0 {
-		weeklyNights := nights / 7
-		remainingNights := nights % 7
-		discountAmount = (pricing.BasePrice - pricing.WeeklyPrice) * float64(weeklyNights*7)
-		basePrice = pricing.WeeklyPrice*float64(weeklyNights*7) + pricing.BasePrice*float64(remainingNights)
-	} else if nights >= 30 && pricing.MonthlyPrice > 0 {
-		monthlyNights := nights / 30
-		remainingNights := nights % 30
-		discountAmount = (pricing.BasePrice - pricing.MonthlyPrice) * float64(monthlyNights*30)
-		basePrice = pricing.MonthlyPrice*float64(monthlyNights*30) + pricing.BasePrice*float64(remainingNights)
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// Get the booking rules of a property (maximum guests comes from its capacity)
+func GetPropertyBookingRules(ctx iris.Context) {
+	propertyIDStr := ctx.Params().Get("propertyID")
+	propertyID, err := strconv.ParseUint(propertyIDStr, 10, 32)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return
 	}
 
-	// Apply additional discounts
-	var discounts []models.PropertyDiscount
-	storage.DB.Where("property_id = ? AND is_active = ? AND start_date <= ? AND end_date >= ?",
-		input.PropertyID, true, input.StartDate, input.EndDate).Find(&discounts)
-
-	var appliedDiscounts []map[string]interface{}
-	for _, discount := range discounts {
-		var discountValue float64
-		if discount.Type == "percentage" {
-			discountValue = basePrice * (discount.Value / 100)
-		} else if discount.Type == "fixed" {
-			discountValue = discount.Value
-		} else if discount.Type == "early_bird" {
-			daysUntilCheckIn := int(input.StartDate.Sub(time.Now()).Hours() / 24)
-			if daysUntilCheckIn >= 30 {
-				discountValue = basePrice * (discount.Value / 100)
-			}
-		} else if discount.Type == "last_minute" {
-			daysUntilCheckIn := int(input.StartDate.Sub(time.Now()).Hours() / 24)
-			if daysUntilCheckIn <= 7 {
-				discountValue = basePrice * (discount.Value / 100)
-			}
-		}
+	var property models.Property
+	if err := storage.DB.First(&property, propertyID).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
 
-		if discountValue > 0 {
-			discountAmount += discountValue
-			appliedDiscounts = append(appliedDiscounts, map[string]interface{}{
-				"name":           discount.Name,
-				"type":           discount.Type,
-				"value":          discount.Value,
-				"discountAmount": discountValue,
-			})
-		}
+	rules, err := services.PropertyBookingRules(storage.DB, &property)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch booking rules"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// Set the booking rules of a property; per-date min/max stay is set through availability
+func SetPropertyBookingRules(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input BookingRulesInput
+
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	if input.MaxStay > 0 && input.MaxStay < input.MinStay {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "maxStay must be at least minStay"})
+		return
+	}
+	days, err := services.ParseCheckInDays(input.CheckInDays)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": err.Error()})
+		return
+	}
+
+	// Verify property ownership
+	var property models.Property
+	if err := storage.DB.Where("id = ? AND host_id = ?", input.PropertyID, userID).First(&property).Error; err != nil {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(iris.Map{"message": "Property not found or access denied"})
+		return
+	}
+
+	if err := storage.DB.Model(&property).Updates(map[string]interface{}{
+		"min_stay":             input.MinStay,
+		"max_stay":             input.MaxStay,
+		"check_in_days":        services.FormatCheckInDays(days),
+		"advance_notice_hours": input.AdvanceNoticeHours,
+		"booking_window_days":  input.BookingWindowDays,
+	}).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update booking rules"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Booking rules updated successfully",
+	})
+}
+
+// Get how a property takes bookings and, in hybrid mode, who may book instantly
+func GetPropertyBookingMode(ctx iris.Context) {
+	propertyIDStr := ctx.Params().Get("propertyID")
+	propertyID, err := strconv.ParseUint(propertyIDStr, 10, 32)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return
 	}
 
-	totalPrice := basePrice + weekendPrice - discountAmount + pricing.CleaningFee + pricing.ServiceFee
+	var property models.Property
+	if err := storage.DB.First(&property, propertyID).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
 
 	ctx.JSON(iris.Map{
 		"success": true,
-		"data": map[string]interface{}{
-			"basePrice":        basePrice,
-			"weekendPrice":     weekendPrice,
-			"cleaningFee":      pricing.CleaningFee,
-			"serviceFee":       pricing.ServiceFee,
-			"securityDeposit":  pricing.SecurityDeposit,
-			"discountAmount":   discountAmount,
-			"appliedDiscounts": appliedDiscounts,
-			"totalPrice":       totalPrice,
-			"nights":           nights,
-			"currency":         pricing.Currency,
+		"data": iris.Map{
+			"bookingMode": property.BookingMode,
+			"instantBook": services.CriteriaFor(&property),
 		},
 	})
 }
+
+// Set the booking mode of a property and its hybrid instant-book criteria
+func SetPropertyBookingMode(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input BookingModeInput
+
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+	if input.InstantBook.MinCompletedStays < 0 || input.InstantBook.MaxNights < 0 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Instant book criteria can't be negative"})
+		return
+	}
+
+	// Verify property ownership
+	var property models.Property
+	if err := storage.DB.Where("id = ? AND host_id = ?", input.PropertyID, userID).First(&property).Error; err != nil {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(iris.Map{"message": "Property not found or access denied"})
+		return
+	}
+
+	if err := storage.DB.Model(&property).Updates(map[string]interface{}{
+		"booking_mode":                     input.BookingMode,
+		"instant_book_require_verified":    input.InstantBook.RequireVerified,
+		"instant_book_min_completed_stays": input.InstantBook.MinCompletedStays,
+		"instant_book_max_nights":          input.InstantBook.MaxNights,
+	}).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update booking mode"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Booking mode updated successfully",
+	})
+}
@@ -0,0 +1,310 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// iCal calendar sync: a secret .ics feed per property for other platforms to subscribe to,
+// and an importer turning their feeds into PropertyBlock rows tagged with the source.
+
+const (
+	icalUIDDomain     = "apartments-clone-server"
+	icalMaxImportSize = 2 << 20
+)
+
+var icalSourcePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+type CalendarImportInput struct {
+	// Source names the other platform's calendar (e.g. "airbnb"); re-importing the same source replaces its blocks
+	Source  string `json:"source" validate:"required"`
+	Content string `json:"content"`
+	URL     string `json:"url"`
+}
+
+// Get (creating on first use) the secret iCal feed URL of a property
+func GetPropertyCalendarFeed(ctx iris.Context) {
+	property, ok := hostOwnedProperty(ctx)
+	if !ok {
+		return
+	}
+
+	if property.CalendarToken == nil {
+		if err := setCalendarToken(property); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to create calendar feed"})
+			return
+		}
+	}
+
+	writeCalendarFeed(ctx, property)
+}
+
+// Rotate the feed token, invalidating the URL shared with other platforms
+func RotatePropertyCalendarFeed(ctx iris.Context) {
+	property, ok := hostOwnedProperty(ctx)
+	if !ok {
+		return
+	}
+
+	if err := setCalendarToken(property); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to rotate calendar feed"})
+		return
+	}
+
+	writeCalendarFeed(ctx, property)
+}
+
+// Public .ics feed: confirmed reservations and host blocks. Imported blocks are left out
+// so that two platforms syncing each other don't echo blocks back and forth.
+func ExportPropertyCalendar(ctx iris.Context) {
+	token := strings.TrimSuffix(ctx.Params().Get("token"), ".ics")
+
+	var property models.Property
+	if token == "" || storage.DB.Where("calendar_token = ?", token).First(&property).Error != nil {
+		utils.CreateNotFound(ctx)
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -30)
+
+	var reservations []models.Reservation
+	if err := storage.DB.Where("property_id = ? AND status = ? AND check_out >= ?", property.ID, "confirmed", since).
+		Order("check_in ASC").Find(&reservations).Error; err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	var blocks []models.PropertyBlock
+	if err := storage.DB.Where("property_id = ? AND source = ? AND end_date >= ?", property.ID, "", since).
+		Order("start_date ASC").Find(&blocks).Error; err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	events := make([]utils.ICalEvent, 0, len(reservations)+len(blocks))
+	for _, r := range reservations {
+		events = append(events, utils.ICalEvent{
+			UID:     fmt.Sprintf("reservation-%d@%s", r.ID, icalUIDDomain),
+			Summary: "Reserved",
+			Start:   calendarDay(r.CheckIn),
+			End:     calendarDay(r.CheckOut),
+			AllDay:  true,
+		})
+	}
+	for _, b := range blocks {
+		// Block end dates are inclusive, iCal all-day ends are exclusive
+		events = append(events, utils.ICalEvent{
+			UID:     fmt.Sprintf("block-%d@%s", b.ID, icalUIDDomain),
+			Summary: "Not available",
+			Start:   calendarDay(b.StartDate),
+			End:     calendarDay(b.EndDate).AddDate(0, 0, 1),
+			AllDay:  true,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := utils.WriteICal(&buf, property.Title, events); err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	ctx.ContentType("text/calendar; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="property-%d.ics"`, property.ID))
+	ctx.Write(buf.Bytes())
+}
+
+// Import another platform's .ics (inline content or URL) as blocks tagged with its source
+func ImportPropertyCalendar(ctx iris.Context) {
+	property, ok := hostOwnedProperty(ctx)
+	if !ok {
+		return
+	}
+
+	var input CalendarImportInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	source := strings.ToLower(strings.TrimSpace(input.Source))
+	if !icalSourcePattern.MatchString(source) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "source must be 1-64 characters of a-z, 0-9, _ or -"})
+		return
+	}
+	if (input.Content == "") == (input.URL == "") {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Provide either content or url"})
+		return
+	}
+
+	if u, err := url.Parse(input.URL); input.URL != "" && (err != nil || utils.CheckPublicURL(u) != nil) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "url must be an https URL"})
+		return
+	}
+
+	var body io.Reader = strings.NewReader(input.Content)
+	if input.URL != "" {
+		raw, err := fetchCalendar(input.URL)
+		if err != nil {
+			fmt.Printf("⚠️ Failed to fetch calendar %q: %v\n", input.URL, err)
+			ctx.StatusCode(iris.StatusBadGateway)
+			ctx.JSON(iris.Map{"message": "Failed to fetch calendar"})
+			return
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	events, err := utils.ParseICal(body)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid iCalendar content", "error": err.Error()})
+		return
+	}
+
+	blocks := make([]models.PropertyBlock, 0, len(events))
+	for _, e := range events {
+		start := calendarDay(e.Start)
+		// The guest leaves on the end day, so the last blocked night is the day before
+		end := calendarDay(e.End).AddDate(0, 0, -1)
+		if end.Before(start) {
+			end = start
+		}
+		reason := e.Summary
+		if reason == "" {
+			reason = "Imported from " + source
+		}
+		blocks = append(blocks, models.PropertyBlock{
+			PropertyID:  property.ID,
+			StartDate:   start,
+			EndDate:     end,
+			Reason:      reason,
+			Source:      source,
+			ExternalUID: e.UID,
+		})
+	}
+
+	var removed int64
+	var previous []models.PropertyBlock
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("property_id = ? AND source = ?", property.ID, source).Find(&previous).Error; err != nil {
+			return err
+		}
+		result := tx.Where("property_id = ? AND source = ?", property.ID, source).Delete(&models.PropertyBlock{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		if len(blocks) == 0 {
+			return nil
+		}
+		return tx.Create(&blocks).Error
+	})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to import calendar"})
+		return
+	}
+
+	// Nights the other platform released may be wanted by the waitlist; the freshly
+	// imported blocks are taken into account when it checks them
+	for _, b := range previous {
+		offerToWaitlist(property.ID, b.StartDate, b.EndDate.AddDate(0, 0, 1))
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Calendar imported successfully",
+		"data": iris.Map{
+			"source":   source,
+			"imported": len(blocks),
+			"removed":  removed,
+			"blocks":   blocks,
+		},
+	})
+}
+
+// hostOwnedProperty loads the property in the route and checks the caller is its host
+func hostOwnedProperty(ctx iris.Context) (*models.Property, bool) {
+	userID := ctx.Values().Get("userID").(uint)
+	propertyID, err := strconv.ParseUint(ctx.Params().Get("propertyID"), 10, 32)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return nil, false
+	}
+
+	var property models.Property
+	if err := storage.DB.Where("id = ? AND host_id = ?", propertyID, userID).First(&property).Error; err != nil {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(iris.Map{"message": "Property not found or access denied"})
+		return nil, false
+	}
+	return &property, true
+}
+
+func setCalendarToken(property *models.Property) error {
+	token := utils.GenerateShortToken(24)
+	if err := storage.DB.Model(property).Update("calendar_token", token).Error; err != nil {
+		return err
+	}
+	property.CalendarToken = &token
+	return nil
+}
+
+func writeCalendarFeed(ctx iris.Context, property *models.Property) {
+	path := fmt.Sprintf("/api/availability/ical/feed/%s.ics", *property.CalendarToken)
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data": iris.Map{
+			"propertyID": property.ID,
+			"url":        ctx.AbsoluteURI(path),
+		},
+	})
+}
+
+// calendarClient fetches the calendars hosts import by URL, from public addresses only
+var calendarClient = utils.NewPublicClient(15 * time.Second)
+
+func fetchCalendar(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckPublicURL(u); err != nil {
+		return nil, err
+	}
+
+	resp, err := calendarClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, icalMaxImportSize))
+}
+
+// calendarDay is the UTC midnight of t's calendar date
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"apartments-clone-server/cancellation"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+type CancellationPolicyInput struct {
+	Name        string              `json:"name" validate:"required,max=128"`
+	Description string              `json:"description"`
+	Tiers       []cancellation.Tier `json:"tiers" validate:"required,min=1"`
+}
+
+type SetPropertyCancellationPolicyInput struct {
+	PolicyID uint `json:"policyId" validate:"required"`
+}
+
+// List the platform presets plus the host's own policies
+func GetCancellationPolicies(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	var policies []models.CancellationPolicy
+	if err := storage.DB.Where("(host_id IS NULL AND is_active = ?) OR host_id = ?", true, userID).
+		Order("host_id NULLS FIRST, id ASC").Find(&policies).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch cancellation policies"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": policies})
+}
+
+// Host writes a custom policy
+func CreateCancellationPolicy(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input CancellationPolicyInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	tiers, err := cancellation.NormalizeTiers(input.Tiers)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": err.Error()})
+		return
+	}
+
+	policy := models.CancellationPolicy{
+		HostID:      &userID,
+		Key:         cancellation.CustomKey,
+		Name:        input.Name,
+		Description: input.Description,
+		Tiers:       cancellation.EncodeTiers(tiers),
+		IsActive:    true,
+	}
+	if err := storage.DB.Create(&policy).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to create cancellation policy"})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(iris.Map{"success": true, "data": policy})
+}
+
+// Host edits one of their policies; existing reservations keep their snapshot
+func UpdateCancellationPolicy(ctx iris.Context) {
+	policy, ok := hostCancellationPolicy(ctx)
+	if !ok {
+		return
+	}
+	var input CancellationPolicyInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	tiers, err := cancellation.NormalizeTiers(input.Tiers)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": err.Error()})
+		return
+	}
+
+	policy.Name = input.Name
+	policy.Description = input.Description
+	policy.Tiers = cancellation.EncodeTiers(tiers)
+	if err := storage.DB.Save(policy).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update cancellation policy"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": policy})
+}
+
+// Host deletes one of their policies; properties using it fall back to the default preset
+func DeleteCancellationPolicy(ctx iris.Context) {
+	policy, ok := hostCancellationPolicy(ctx)
+	if !ok {
+		return
+	}
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := detachCancellationPolicy(tx, policy.ID, cancellation.DefaultKey); err != nil {
+			return err
+		}
+		return tx.Delete(policy).Error
+	})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to delete cancellation policy"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "message": "Cancellation policy deleted"})
+}
+
+// Public: the policy a guest booking this property now would get
+func GetPropertyCancellationPolicy(ctx iris.Context) {
+	var property models.Property
+	if err := storage.DB.First(&property, ctx.Params().Get("propertyID")).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
+
+	policy, err := cancellation.Resolve(storage.DB, &property)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to load cancellation policy"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": policy})
+}
+
+// Host picks a preset or one of their own policies for a property
+func SetPropertyCancellationPolicy(ctx iris.Context) {
+	property, ok := hostOwnedProperty(ctx)
+	if !ok {
+		return
+	}
+	var input SetPropertyCancellationPolicyInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	var policy models.CancellationPolicy
+	if err := storage.DB.Where("(host_id IS NULL AND is_active = ?) OR host_id = ?", true, property.HostID).
+		First(&policy, input.PolicyID).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Cancellation policy not found"})
+		return
+	}
+
+	if err := storage.DB.Model(property).Updates(map[string]interface{}{
+		"cancellation_policy_id": policy.ID,
+		"cancellation_policy":    policy.Key,
+	}).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update property"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": policy})
+}
+
+// hostCancellationPolicy loads the host's own policy named by the {id} route parameter
+func hostCancellationPolicy(ctx iris.Context) (*models.CancellationPolicy, bool) {
+	userID := ctx.Values().Get("userID").(uint)
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid policy ID"})
+		return nil, false
+	}
+
+	var policy models.CancellationPolicy
+	err = storage.DB.Where("host_id = ?", userID).First(&policy, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Cancellation policy not found"})
+		return nil, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to load cancellation policy"})
+		return nil, false
+	}
+	return &policy, true
+}
+
+// detachCancellationPolicy points properties using a deleted policy back at a preset key
+func detachCancellationPolicy(tx *gorm.DB, policyID uint, key string) error {
+	return tx.Model(&models.Property{}).Where("cancellation_policy_id = ?", policyID).
+		Updates(map[string]interface{}{"cancellation_policy_id": nil, "cancellation_policy": key}).Error
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"apartments-clone-server/models"
+	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
 	"strconv"
@@ -149,7 +150,7 @@ func GetPropertyAmenities(ctx iris.Context) {
 
 	var amenities []models.Amenity
 	if err := storage.DB.Raw(`
-        SELECT a.id, a.name, a.icon, a.category, a.description, a.is_active, a.sort_order, a.created_at, a.updated_at
+        SELECT a.id, a.key, a.name, a.icon, a.category, a.description, a.is_active, a.sort_order, a.created_at, a.updated_at
         FROM amenities a
         INNER JOIN property_amenities pa ON a.id = pa.amenity_id
         WHERE pa.property_id = ? AND a.is_active = true
@@ -264,27 +265,8 @@ func UpdatePropertyAmenities(ctx iris.Context) {
 		return
 	}
 
-	tx := storage.DB.Begin()
-	if err := tx.Error; err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"message": "Failed to start transaction"})
-		return
-	}
-	defer func() { _ = tx.Rollback().Error }()
-
-	if err := tx.Exec("DELETE FROM property_amenities WHERE property_id = ?", propertyID).Error; err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"message": "Failed to remove existing amenities"})
-		return
-	}
-	for _, amenityID := range request.AmenityIDs {
-		if err := tx.Exec("INSERT INTO property_amenities (property_id, amenity_id) VALUES (?, ?)", propertyID, amenityID).Error; err != nil {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.JSON(iris.Map{"message": "Failed to add amenity"})
-			return
-		}
-	}
-	if err := tx.Commit().Error; err != nil {
+	// The listing's amenities list is rewritten with the keys of the same amenities
+	if err := services.SetPropertyAmenityIDs(storage.DB, prop.ID, request.AmenityIDs); err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to save changes"})
 		return
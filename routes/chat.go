@@ -19,7 +19,7 @@ type sendMessageInput struct {
 	TTLSec  int    `json:"ttlSec"`
 }
 
-// List recent messages for a group (last 100)
+// List a group's messages a page at a time, from the most recent; each page is in chronological order
 func ListGroupMessages(ctx iris.Context) {
 	tok := jsonWT.Get(ctx)
 	if tok == nil {
@@ -38,16 +38,25 @@ func ListGroupMessages(ctx iris.Context) {
 		ctx.StopWithStatus(http.StatusForbidden)
 		return
 	}
+	// Newest first, older pages by cursor
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Desc: true}, 50, 100)
+	if err != nil {
+		ctx.StopWithStatus(http.StatusBadRequest)
+		return
+	}
+	q := storage.DB.Model(&models.ChatMessage{}).Where("group_id = ?", groupID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	var total int64
+	q.Count(&total)
 	var msgs []models.ChatMessage
-	storage.DB.Where("group_id = ?", groupID).
-		Preload("Sender").
-		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
-		Order("id DESC").Limit(100).Find(&msgs)
+	keyset.Apply(q.Preload("Sender")).Find(&msgs)
+	n, next := keyset.Next(len(msgs), func(last int) string { return keyset.IDCursor(msgs[last].ID) })
+	msgs = msgs[:n]
 	// reverse to chronological
 	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
 		msgs[i], msgs[j] = msgs[j], msgs[i]
 	}
-	ctx.JSON(iris.Map{"success": true, "messages": msgs})
+	ctx.JSON(iris.Map{"success": true, "messages": msgs, "meta": keyset.Meta(total, next)})
 }
 
 // Send a message
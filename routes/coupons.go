@@ -0,0 +1,296 @@
+package routes
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Promo codes: hosts issue codes for their own listings, admins issue platform codes
+// (see admin_coupons.go) that can also target organizations
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+type couponTargetBody struct {
+	TargetType string `json:"targetType"`
+	TargetID   uint   `json:"targetID"`
+}
+
+type couponBody struct {
+	Code           string             `json:"code"`
+	Type           string             `json:"type"`
+	Value          float64            `json:"value"`
+	Currency       string             `json:"currency"`
+	MinSpend       float64            `json:"minSpend"`
+	StartsAt       *time.Time         `json:"startsAt"`
+	EndsAt         *time.Time         `json:"endsAt"`
+	MaxRedemptions int                `json:"maxRedemptions"`
+	MaxPerUser     int                `json:"maxPerUser"`
+	IsActive       *bool              `json:"isActive"`
+	AppliesTo      string             `json:"appliesTo"`
+	Targets        []couponTargetBody `json:"targets"`
+}
+
+// apply copies the body onto a coupon and returns what is wrong with the result, if anything.
+// Targets are checked by the caller, hosts and admins may target different things.
+func (b couponBody) apply(coupon *models.Coupon) string {
+	coupon.Code = coupons.Normalize(b.Code)
+	coupon.Type = b.Type
+	coupon.Value = b.Value
+	coupon.Currency = fx.Normalize(b.Currency)
+	if coupon.Currency == "" {
+		coupon.Currency = fx.Base
+	}
+	coupon.MinSpend = b.MinSpend
+	coupon.StartsAt = b.StartsAt
+	coupon.EndsAt = b.EndsAt
+	coupon.MaxRedemptions = b.MaxRedemptions
+	coupon.MaxPerUser = b.MaxPerUser
+	if b.IsActive != nil {
+		coupon.IsActive = *b.IsActive
+	}
+	coupon.AppliesTo = b.AppliesTo
+	if coupon.AppliesTo == "" {
+		coupon.AppliesTo = coupons.AppliesAll
+	}
+	coupon.Targets = nil
+	for _, t := range b.Targets {
+		coupon.Targets = append(coupon.Targets, models.CouponTarget{TargetType: t.TargetType, TargetID: t.TargetID})
+	}
+
+	switch {
+	case !couponCodePattern.MatchString(coupon.Code):
+		return "code must be 3 to 32 letters, digits, dashes or underscores"
+	case coupon.Type != coupons.Percent && coupon.Type != coupons.Fixed:
+		return "type must be percent or fixed"
+	case coupon.Value <= 0 || (coupon.Type == coupons.Percent && coupon.Value > 100):
+		return "value must be positive (at most 100 for percentages)"
+	case !fx.ValidCode(coupon.Currency):
+		return "invalid currency"
+	case coupon.MinSpend < 0 || coupon.MaxRedemptions < 0 || coupon.MaxPerUser < 0:
+		return "minimum spend and limits can't be negative"
+	case coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt):
+		return "endsAt must be after startsAt"
+	case coupon.AppliesTo != coupons.AppliesAll && coupon.AppliesTo != coupons.AppliesStays && coupon.AppliesTo != coupons.AppliesExperiences:
+		return "appliesTo must be all, stays or experiences"
+	}
+	for _, t := range coupon.Targets {
+		if t.TargetType != coupons.TargetProperty && t.TargetType != coupons.TargetExperience && t.TargetType != coupons.TargetOrganization {
+			return "target type must be property, experience or organization"
+		}
+	}
+	if coupon.MaxRedemptions > 0 && coupon.Redemptions > coupon.MaxRedemptions {
+		return "maxRedemptions is below the redemptions already made"
+	}
+	// Deleted codes keep their unique index entry
+	var count int64
+	storage.DB.Unscoped().Model(&models.Coupon{}).Where("code = ? AND id <> ?", coupon.Code, coupon.ID).Count(&count)
+	if count > 0 {
+		return "code already in use"
+	}
+	return ""
+}
+
+// saveCoupon creates or updates coupon and replaces its targets
+func saveCoupon(coupon *models.Coupon) error {
+	return storage.DB.Transaction(func(tx *gorm.DB) error {
+		targets := coupon.Targets
+		coupon.Targets = nil
+		if err := tx.Save(coupon).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("coupon_id = ?", coupon.ID).Delete(&models.CouponTarget{}).Error; err != nil {
+			return err
+		}
+		for i := range targets {
+			targets[i].ID = 0
+			targets[i].CouponID = coupon.ID
+		}
+		if len(targets) > 0 {
+			if err := tx.Create(&targets).Error; err != nil {
+				return err
+			}
+		}
+		coupon.Targets = targets
+		return nil
+	})
+}
+
+// Get the promo codes the host issued
+func GetHostCoupons(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	var items []models.Coupon
+	if err := storage.DB.Preload("Targets").Where("issuer = ? AND issuer_id = ?", coupons.IssuerHost, userID).
+		Order("created_at DESC").Find(&items).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch promo codes"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    items,
+	})
+}
+
+// Create a promo code valid on the host's listings, or on some of them through targets
+func CreateHostCoupon(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var body couponBody
+
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	coupon := models.Coupon{Issuer: coupons.IssuerHost, IssuerID: &userID, IsActive: true}
+	if !applyHostCoupon(ctx, &coupon, body, userID) {
+		return
+	}
+
+	if err := saveCoupon(&coupon); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to create promo code"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Promo code created successfully",
+		"data":    coupon,
+	})
+}
+
+// Update a promo code of the host; redemptions already made are kept
+func UpdateHostCoupon(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	coupon, ok := findHostCoupon(ctx, userID)
+	if !ok {
+		return
+	}
+
+	var body couponBody
+	if err := ctx.ReadJSON(&body); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+	if !applyHostCoupon(ctx, coupon, body, userID) {
+		return
+	}
+
+	if err := saveCoupon(coupon); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update promo code"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Promo code updated successfully",
+		"data":    coupon,
+	})
+}
+
+// Delete a promo code of the host; bookings that used it keep their discount
+func DeleteHostCoupon(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	coupon, ok := findHostCoupon(ctx, userID)
+	if !ok {
+		return
+	}
+
+	if err := storage.DB.Delete(coupon).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to delete promo code"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Promo code deleted successfully",
+	})
+}
+
+// findHostCoupon loads the coupon in the id param if the host issued it, answering 404 otherwise
+func findHostCoupon(ctx iris.Context, userID uint) (*models.Coupon, bool) {
+	couponID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid promo code ID"})
+		return nil, false
+	}
+
+	var coupon models.Coupon
+	if err := storage.DB.Preload("Targets").Where("id = ? AND issuer = ? AND issuer_id = ?", couponID, coupons.IssuerHost, userID).
+		First(&coupon).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Promo code not found or access denied"})
+		return nil, false
+	}
+	return &coupon, true
+}
+
+// applyHostCoupon validates body and copies it onto coupon, answering 400 when invalid.
+// Hosts can only target their own properties and experiences.
+func applyHostCoupon(ctx iris.Context, coupon *models.Coupon, body couponBody, userID uint) bool {
+	message := body.apply(coupon)
+	for _, t := range coupon.Targets {
+		if message != "" {
+			break
+		}
+		var count int64
+		switch t.TargetType {
+		case coupons.TargetProperty:
+			storage.DB.Model(&models.Property{}).Where("id = ? AND host_id = ?", t.TargetID, userID).Count(&count)
+		case coupons.TargetExperience:
+			storage.DB.Model(&models.Experience{}).Where("id = ? AND host_id = ?", t.TargetID, userID).Count(&count)
+		}
+		if count == 0 {
+			message = "Targets must be your own properties or experiences"
+		}
+	}
+	if message != "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": message})
+		return false
+	}
+	return true
+}
+
+// writeCouponError answers 4xx when err is why a promo code can't be used, under the key the
+// calling handler uses for errors, and reports whether it did
+func writeCouponError(ctx iris.Context, key string, err error) bool {
+	code := ""
+	status := iris.StatusUnprocessableEntity
+	switch {
+	case errors.Is(err, coupons.ErrNotFound):
+		code, status = "coupon_not_found", iris.StatusNotFound
+	case errors.Is(err, coupons.ErrNotValidNow):
+		code = "coupon_not_valid_now"
+	case errors.Is(err, coupons.ErrNotApplicable):
+		code = "coupon_not_applicable"
+	case errors.Is(err, coupons.ErrCurrency):
+		code = "coupon_currency"
+	case errors.Is(err, coupons.ErrMinSpend):
+		code = "coupon_min_spend"
+	case errors.Is(err, coupons.ErrExhausted):
+		code, status = "coupon_exhausted", iris.StatusConflict
+	case errors.Is(err, coupons.ErrUserLimit):
+		code, status = "coupon_user_limit", iris.StatusConflict
+	default:
+		return false
+	}
+	ctx.StatusCode(status)
+	ctx.JSON(iris.Map{key: err.Error(), "code": code})
+	return true
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"apartments-clone-server/fx"
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+	"errors"
+	"fmt"
+
+	"github.com/kataras/iris/v12"
+)
+
+// displayRates loads the rate table for a display currency. It returns a nil table when
+// no currency was asked for and fx.ErrUnknownCurrency when there is no rate for it.
+func displayRates(code string) (fx.Table, error) {
+	code = fx.Normalize(code)
+	if code == "" {
+		return nil, nil
+	}
+	table, err := fx.Load(storage.DB)
+	if err != nil {
+		return nil, err
+	}
+	if !table.Has(code) {
+		return nil, fmt.Errorf("%w: %s", fx.ErrUnknownCurrency, code)
+	}
+	return table, nil
+}
+
+// displayProperty converts a listing's prices and searched stay price; a nil table leaves it untouched
+func displayProperty(table fx.Table, code string, property *models.Property) {
+	if table == nil {
+		return
+	}
+	property.Display, _ = table.Display(property.Currency, code, map[string]float64{
+		"nightlyPrice": float64(property.NightlyPrice),
+		"cleaningFee":  float64(property.CleaningFee),
+		"serviceFee":   float64(property.ServiceFee),
+	})
+	if stay := property.StayPrice; stay != nil {
+		stay.Display, _ = table.Display(stay.Currency, code, map[string]float64{
+			"total":    stay.Total,
+			"perNight": stay.PerNight,
+		})
+	}
+}
+
+// displayPropertySale converts a sale listing's prices; a nil table leaves it untouched
+func displayPropertySale(table fx.Table, code string, sale *models.PropertySale) {
+	if table == nil {
+		return
+	}
+	sale.Display, _ = table.Display(sale.Currency, code, map[string]float64{
+		"listing_price":  sale.ListingPrice,
+		"price_per_sqft": sale.PricePerSqFt,
+		"property_tax":   sale.PropertyTax,
+		"hoa":            sale.HOA,
+	})
+}
+
+// writeCurrencyError answers 400 for currencies without a rate and 500 otherwise, under
+// the key the calling handler uses for errors ("message" or "error")
+func writeCurrencyError(ctx iris.Context, key string, err error) {
+	if errors.Is(err, fx.ErrUnknownCurrency) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{key: err.Error()})
+		return
+	}
+	ctx.StatusCode(iris.StatusInternalServerError)
+	ctx.JSON(iris.Map{key: "Failed to load exchange rates"})
+}
@@ -0,0 +1,258 @@
+package routes
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"net/http"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Security deposit endpoints: guests and hosts see the deposit of their reservations,
+// hosts claim after checkout, guests accept or dispute, admins arbitrate disputes.
+
+type DepositClaimInput struct {
+	Amount float64  `json:"amount" validate:"required,gt=0"`
+	Reason string   `json:"reason" validate:"required"`
+	Photos []string `json:"photos" validate:"required,min=1,dive,url"`
+}
+
+type DepositDisputeInput struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// Get the deposit of a reservation (guest or host of that reservation)
+func GetReservationDeposit(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	reservationID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid reservation ID"})
+		return
+	}
+
+	var deposit models.SecurityDeposit
+	if err := storage.DB.Where("reservation_id = ? AND (guest_id = ? OR host_id = ?)", reservationID, userID, userID).
+		First(&deposit).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Security deposit not found"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": deposit})
+}
+
+// List the deposits held for the guest's reservations
+func GetGuestDeposits(ctx iris.Context) {
+	listDeposits(ctx, "guest_id")
+}
+
+// List the deposits held for the host's properties
+func GetHostDeposits(ctx iris.Context) {
+	listDeposits(ctx, "host_id")
+}
+
+func listDeposits(ctx iris.Context, column string) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	q := storage.DB.Where(column+" = ?", userID)
+	if status := ctx.URLParamDefault("status", ""); status != "" {
+		q = q.Where("status = ?", status)
+	}
+
+	var deposits []models.SecurityDeposit
+	if err := q.Order("created_at DESC").Find(&deposits).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch security deposits"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": deposits})
+}
+
+// Host claims part or all of the deposit, with photos, within the claim window
+func ClaimDeposit(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input DepositClaimInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	deposit, err := updateDeposit(ctx, func(tx *gorm.DB, deposit *models.SecurityDeposit) error {
+		if deposit.HostID != userID {
+			return errDepositForbidden
+		}
+		var reservation models.Reservation
+		if err := tx.Select("id, check_out").First(&reservation, deposit.ReservationID).Error; err != nil {
+			return err
+		}
+		return services.ClaimSecurityDeposit(tx, deposit, reservation.CheckOut, input.Amount, input.Reason, input.Photos)
+	})
+	if err != nil {
+		writeDepositError(ctx, err)
+		return
+	}
+
+	createReservationNotification(deposit.GuestID, "deposit_claimed", "Security Deposit Claim",
+		"Your host has claimed part of your security deposit. You can accept or dispute the claim.", deposit.ReservationID)
+
+	ctx.JSON(iris.Map{"success": true, "message": "Claim submitted", "data": deposit})
+}
+
+// Guest accepts the host's claim; the claimed amount goes to the host
+func AcceptDepositClaim(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	deposit, err := updateDeposit(ctx, func(tx *gorm.DB, deposit *models.SecurityDeposit) error {
+		if deposit.GuestID != userID {
+			return errDepositForbidden
+		}
+		if deposit.Status != services.DepositClaimed {
+			return services.ErrDepositState
+		}
+		return services.SettleSecurityDeposit(tx, deposit, deposit.ClaimAmount, "Claim accepted by guest", nil)
+	})
+	if err != nil {
+		writeDepositError(ctx, err)
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "message": "Claim accepted", "data": deposit})
+}
+
+// Guest disputes the host's claim; an admin decides the outcome
+func DisputeDeposit(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input DepositDisputeInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	deposit, err := updateDeposit(ctx, func(tx *gorm.DB, deposit *models.SecurityDeposit) error {
+		if deposit.GuestID != userID {
+			return errDepositForbidden
+		}
+		return services.DisputeSecurityDeposit(tx, deposit, input.Reason)
+	})
+	if err != nil {
+		writeDepositError(ctx, err)
+		return
+	}
+
+	createReservationNotification(deposit.HostID, "deposit_disputed", "Security Deposit Disputed",
+		"Your guest disputed the security deposit claim. Our team will review it.", deposit.ReservationID)
+
+	ctx.JSON(iris.Map{"success": true, "message": "Dispute submitted", "data": deposit})
+}
+
+// GET /admin/deposits?status=
+func AdminListDeposits(ctx iris.Context) {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "security_deposits.created_at", ID: "security_deposits.id", Desc: true}, 25, 100)
+	if err != nil {
+		utils.JSONError(ctx, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+
+	q := storage.DB.Model(&models.SecurityDeposit{})
+	if status := ctx.URLParamDefault("status", ""); status != "" {
+		q = q.Where("status = ?", status)
+	}
+
+	var total int64
+	q.Count(&total)
+
+	var items []models.SecurityDeposit
+	if err := keyset.Apply(q.Preload("Reservation")).Find(&items).Error; err != nil {
+		utils.JSONError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	n, next := keyset.Next(len(items), func(last int) string { return keyset.TimeCursor(items[last].CreatedAt, items[last].ID) })
+	utils.JSONPageMeta(ctx, items[:n], keyset.Meta(total, next))
+}
+
+// POST /admin/deposits/:id/resolve { awardedAmount, note }
+func AdminResolveDeposit(ctx iris.Context) {
+	adminID := ctx.Values().Get("userID").(uint)
+	var body struct {
+		AwardedAmount float64 `json:"awardedAmount"`
+		Note          string  `json:"note"`
+	}
+	if err := ctx.ReadJSON(&body); err != nil || body.Note == "" || body.AwardedAmount < 0 {
+		utils.JSONError(ctx, http.StatusUnprocessableEntity, "invalid_payload", "awardedAmount and note required")
+		return
+	}
+
+	var before models.SecurityDeposit
+	deposit, err := updateDeposit(ctx, func(tx *gorm.DB, deposit *models.SecurityDeposit) error {
+		before = *deposit
+		if deposit.Status != services.DepositDisputed {
+			return services.ErrDepositState
+		}
+		return services.SettleSecurityDeposit(tx, deposit, body.AwardedAmount, body.Note, &adminID)
+	})
+	if err != nil {
+		writeDepositError(ctx, err)
+		return
+	}
+
+	utils.Audit(ctx, "deposit.resolve", "security_deposit", deposit.ID, before, deposit)
+	for _, userID := range []uint{deposit.GuestID, deposit.HostID} {
+		createReservationNotification(userID, "deposit_resolved", "Security Deposit Dispute Resolved", body.Note, deposit.ReservationID)
+	}
+	ctx.JSON(iris.Map{"data": deposit})
+}
+
+var errDepositForbidden = errors.New("not allowed to act on this deposit")
+
+// updateDeposit runs fn on the locked deposit named by the {id} route parameter
+func updateDeposit(ctx iris.Context, fn func(tx *gorm.DB, deposit *models.SecurityDeposit) error) (*models.SecurityDeposit, error) {
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var deposit *models.SecurityDeposit
+	err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		var err error
+		if deposit, err = services.LockDeposit(tx, id); err != nil {
+			return err
+		}
+		return fn(tx, deposit)
+	})
+	return deposit, err
+}
+
+func writeDepositError(ctx iris.Context, err error) {
+	status := iris.StatusInternalServerError
+	message := "Failed to update security deposit"
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status, message = iris.StatusNotFound, "Security deposit not found"
+	case errors.Is(err, errDepositForbidden):
+		status, message = iris.StatusForbidden, "Access denied"
+	case errors.Is(err, services.ErrDepositState), errors.Is(err, services.ErrClaimWindowClosed):
+		status, message = iris.StatusConflict, err.Error()
+	case errors.Is(err, services.ErrClaimAmount):
+		status, message = iris.StatusBadRequest, err.Error()
+	}
+	ctx.StatusCode(status)
+	ctx.JSON(iris.Map{"message": message})
+}
+
+func createReservationNotification(userID uint, notificationType, title, message string, reservationID uint) {
+	storage.DB.Create(&models.Notification{
+		UserID:  userID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+		RefType: "reservation",
+		RefID:   reservationID,
+	})
+}
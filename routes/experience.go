@@ -6,6 +6,7 @@ import (
 	"apartments-clone-server/utils"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/kataras/iris/v12"
 	jsonWT "github.com/kataras/iris/v12/middleware/jwt"
@@ -322,13 +323,17 @@ func GetPublicExperiences(ctx iris.Context) {
 	offset := (page - 1) * limit
 
 	var experiences []models.Experience
-	query := storage.DB.Where("status = ?", "live").
-		Preload("Host").
-		Order("created_at DESC")
+	query := storage.DB.Model(&models.Experience{}).Where("status = ?", "live").
+		Preload("Host")
 
 	if city != "" {
 		query = query.Where("city ILIKE ?", "%"+city+"%")
 	}
+	// Full-text search over the title, description and what we'll do, best matches first
+	if text := strings.TrimSpace(ctx.URLParam("q")); text != "" {
+		query = searchText(query, "experiences", text).Order("search_rank DESC")
+	}
+	query = query.Order("created_at DESC")
 
 	if err := query.Limit(limit).Offset(offset).Find(&experiences).Error; err != nil {
 		utils.CreateInternalServerError(ctx)
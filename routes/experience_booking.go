@@ -1,15 +1,21 @@
 package routes
 
 import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/invoices"
 	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/pricing"
 	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
 )
 
 type ExperienceBookingRequest struct {
@@ -19,6 +25,7 @@ type ExperienceBookingRequest struct {
 	SelectedDate     string `json:"selectedDate" validate:"required"`
 	SelectedTime     string `json:"selectedTime"`
 	Notes            string `json:"notes"`
+	CouponCode       string `json:"couponCode"`
 }
 
 type ExperienceBookingResponse struct {
@@ -31,6 +38,8 @@ type ExperienceBookingResponse struct {
 	Notes            string                 `json:"notes"`
 	Status           string                 `json:"status"`
 	TotalPrice       float64                `json:"totalPrice"`
+	CouponCode       string                 `json:"couponCode,omitempty"`
+	DiscountAmount   float64                `json:"discountAmount"`
 	CreatedAt        time.Time              `json:"createdAt"`
 	Experience       models.Experience      `json:"experience"`
 	Group            models.ExperienceGroup `json:"group"`
@@ -145,6 +154,34 @@ func CreateExperienceBooking(ctx iris.Context) {
 		return
 	}
 
+	// Promo code, checked again with the coupon locked when the booking is saved
+	price := experience.PricePerPerson * float64(request.ParticipantCount)
+	couponTarget := coupons.Target{
+		SubjectType: payments.SubjectExperienceBooking,
+		ListingID:   experience.ID,
+		HostID:      experience.HostID,
+		UserID:      userID,
+		Amount:      price,
+		Currency:    pricing.DefaultCurrency,
+	}
+	var coupon *models.Coupon
+	var discount float64
+	if request.CouponCode != "" {
+		coupon, err = coupons.Find(storage.DB, request.CouponCode)
+		if err == nil {
+			err = coupons.Check(storage.DB, coupon, couponTarget, time.Now())
+		}
+		if writeCouponError(ctx, "message", err) {
+			return
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to check promo code"})
+			return
+		}
+		discount = coupons.Discount(coupon, price)
+	}
+
 	// Create the booking
 	booking := models.ExperienceBooking{
 		ExperienceID:     request.ExperienceID,
@@ -154,12 +191,49 @@ func CreateExperienceBooking(ctx iris.Context) {
 		SelectedTime:     request.SelectedTime,
 		Notes:            request.Notes,
 		Status:           "confirmed",
-		TotalPrice:       experience.PricePerPerson * float64(request.ParticipantCount),
+		TotalPrice:       price - discount,
+		DiscountAmount:   discount,
 		UserID:           userID,
 		GuestID:          userID, // Set guest_id to the same as user_id for now
 	}
+	if coupon != nil {
+		booking.CouponCode = coupon.Code
+	}
 
-	if err := storage.DB.Create(&booking).Error; err != nil {
+	// Experience bookings are confirmed immediately, so the guest is charged right away
+	err = payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		if err := tx.Create(&booking).Error; err != nil {
+			return err
+		}
+		if coupon != nil {
+			if _, err := coupons.Redeem(tx, coupon.ID, couponTarget, booking.ID, discount); err != nil {
+				return err
+			}
+		}
+		_, err := payments.ChargeNow(tx, payments.Charge{
+			SubjectType: payments.SubjectExperienceBooking,
+			SubjectID:   booking.ID,
+			PayerID:     userID,
+			PayeeID:     experience.HostID,
+			Amount:      booking.TotalPrice,
+			Currency:    pricing.DefaultCurrency,
+			Description: fmt.Sprintf("Experience booking #%d", booking.ID),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = invoices.ExperienceBookingReceipt(tx, booking.ID)
+		return err
+	})
+	if errors.Is(err, payments.ErrDeclined) {
+		ctx.StatusCode(iris.StatusPaymentRequired)
+		ctx.JSON(iris.Map{"message": "The payment could not be authorized"})
+		return
+	}
+	if writeCouponError(ctx, "message", err) {
+		return
+	}
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to create booking"})
 		return
@@ -233,6 +307,8 @@ func CreateExperienceBooking(ctx iris.Context) {
 		Notes:            booking.Notes,
 		Status:           booking.Status,
 		TotalPrice:       booking.TotalPrice,
+		CouponCode:       booking.CouponCode,
+		DiscountAmount:   booking.DiscountAmount,
 		CreatedAt:        booking.CreatedAt,
 		Experience:       experience,
 		Group:            group,
@@ -316,9 +392,24 @@ func CancelExperienceBooking(ctx iris.Context) {
 		return
 	}
 
-	// Update booking status
+	// Update booking status; cancellations outside the last 24 hours are refunded in full
 	booking.Status = "cancelled"
-	if err := storage.DB.Save(&booking).Error; err != nil {
+	var refunded float64
+	err := payments.Transaction(storage.DB, func(tx *gorm.DB) error {
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		var err error
+		refunded, err = payments.Release(tx, payments.SubjectExperienceBooking, booking.ID, booking.TotalPrice, "guest cancellation")
+		if err != nil {
+			return err
+		}
+		if _, err = invoices.IssueCreditNote(tx, payments.SubjectExperienceBooking, booking.ID, refunded, "Booking cancelled by the guest"); err != nil {
+			return err
+		}
+		return coupons.Release(tx, payments.SubjectExperienceBooking, booking.ID)
+	})
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to cancel booking"})
 		return
@@ -350,8 +441,9 @@ func CancelExperienceBooking(ctx iris.Context) {
 	}
 
 	ctx.JSON(iris.Map{
-		"success": true,
-		"message": "Booking cancelled successfully",
+		"success":       true,
+		"message":       "Booking cancelled successfully",
+		"refund_amount": refunded,
 	})
 }
 
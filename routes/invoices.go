@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"apartments-clone-server/invoices"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/storage"
+	"errors"
+	"fmt"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Invoice endpoints: guests and hosts list the receipts and credit notes of their bookings
+// and download them as PDF.
+
+// List the user's invoices; ?role=host lists those of the host's bookings
+func GetUserInvoices(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	column := "guest_id"
+	if ctx.URLParamDefault("role", "guest") == "host" {
+		column = "host_id"
+	}
+	q := storage.DB.Where(column+" = ?", userID)
+	if kind := ctx.URLParamDefault("kind", ""); kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+
+	var items []models.Invoice
+	if err := q.Order("issued_at DESC, id DESC").Find(&items).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch invoices"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": items})
+}
+
+// Receipt and credit notes of a reservation; the receipt is issued on first request once the stay is paid
+func GetReservationInvoices(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	reservationID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid reservation ID"})
+		return
+	}
+
+	var reservation models.Reservation
+	if err := storage.DB.Joins("JOIN properties ON properties.id = reservations.property_id").
+		Where("reservations.id = ? AND (reservations.guest_id = ? OR properties.host_id = ?)", reservationID, userID, userID).
+		First(&reservation).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Reservation not found"})
+		return
+	}
+
+	writeSubjectInvoices(ctx, payments.SubjectReservation, reservation.ID, func(tx *gorm.DB) (*models.Invoice, error) {
+		return invoices.ReservationReceipt(tx, reservation.ID)
+	})
+}
+
+// Receipt and credit notes of an experience booking (guest or experience host)
+func GetExperienceBookingInvoices(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	bookingID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid booking ID"})
+		return
+	}
+
+	var booking models.ExperienceBooking
+	if err := storage.DB.Joins("JOIN experiences ON experiences.id = experience_bookings.experience_id").
+		Where("experience_bookings.id = ? AND (experience_bookings.user_id = ? OR experiences.host_id = ?)", bookingID, userID, userID).
+		First(&booking).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Booking not found"})
+		return
+	}
+
+	writeSubjectInvoices(ctx, payments.SubjectExperienceBooking, booking.ID, func(tx *gorm.DB) (*models.Invoice, error) {
+		return invoices.ExperienceBookingReceipt(tx, booking.ID)
+	})
+}
+
+// Download an invoice as PDF
+func DownloadInvoice(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	invoiceID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid invoice ID"})
+		return
+	}
+
+	var invoice models.Invoice
+	if err := storage.DB.Where("id = ? AND (guest_id = ? OR host_id = ?)", invoiceID, userID, userID).First(&invoice).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Invoice not found"})
+		return
+	}
+
+	var receiptNumber string
+	if invoice.ReceiptID != nil {
+		var receipt models.Invoice
+		if err := storage.DB.Select("number").First(&receipt, *invoice.ReceiptID).Error; err == nil {
+			receiptNumber = receipt.Number
+		}
+	}
+
+	ctx.ContentType("application/pdf")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	ctx.Write(invoices.Render(&invoice, receiptNumber))
+}
+
+// writeSubjectInvoices issues the receipt of a booking if needed and lists its invoices
+func writeSubjectInvoices(ctx iris.Context, subjectType string, subjectID uint, receipt func(tx *gorm.DB) (*models.Invoice, error)) {
+	var items []models.Invoice
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := receipt(tx); err != nil {
+			return err
+		}
+		return tx.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+			Order("issued_at ASC, id ASC").Find(&items).Error
+	})
+	if errors.Is(err, invoices.ErrNotPaid) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": "No invoice yet: the booking has not been paid"})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to issue invoice"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": items})
+}
@@ -189,8 +189,14 @@ func GetPropertiesWithFilters(ctx iris.Context) {
 		limit = 20
 	}
 
+	// Optional stay: only properties bookable from checkIn to checkOut for guests
+	stay, ok := readStaySearch(ctx, "error")
+	if !ok {
+		return
+	}
+
 	// Build query
-	query := storage.DB.Where("is_active = ?", true)
+	query := whereAvailable(storage.DB.Where("is_active = ?", true), stay)
 
 	// Property type filter
 	if propertyType != "" {
@@ -264,7 +270,7 @@ func GetPropertiesWithFilters(ctx iris.Context) {
 				for _, requested := range requestedAmenities {
 					found := false
 					for _, propertyAmenity := range propertyAmenities {
-						if propertyAmenity == requested {
+						if models.AmenityKey(propertyAmenity) == models.AmenityKey(requested) {
 							found = true
 							break
 						}
@@ -283,6 +289,15 @@ func GetPropertiesWithFilters(ctx iris.Context) {
 		}
 	}
 
+	nearbyProperties, err = withStayPrices(nearbyProperties, stay)
+	if err != nil {
+		ctx.JSON(iris.Map{
+			"success": false,
+			"error":   "Failed to price stays",
+		})
+		return
+	}
+
 	// Limit results
 	if len(nearbyProperties) > limit {
 		nearbyProperties = nearbyProperties[:limit]
@@ -304,6 +319,9 @@ func GetPropertiesWithFilters(ctx iris.Context) {
 			"bedrooms":      bedroomsStr,
 			"bathrooms":     bathroomsStr,
 			"amenities":     amenitiesStr,
+			"checkIn":       ctx.URLParam("checkIn"),
+			"checkOut":      ctx.URLParam("checkOut"),
+			"guests":        ctx.URLParam("guests"),
 		},
 	})
 }
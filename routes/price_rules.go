@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"apartments-clone-server/models"
+	"apartments-clone-server/pricing"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Price rules: seasonal and event pricing on top of a property's base and weekend prices
+
+type PriceRuleInput struct {
+	PropertyID uint      `json:"propertyID" validate:"required"`
+	Name       string    `json:"name" validate:"required"`
+	StartDate  time.Time `json:"startDate" validate:"required"`
+	EndDate    time.Time `json:"endDate" validate:"required"` // included
+	Adjustment string    `json:"adjustment" validate:"required,oneof=absolute percent delta"`
+	Value      float64   `json:"value"`
+	Priority   int       `json:"priority"`
+	DaysOfWeek string    `json:"daysOfWeek"` // e.g. "fri,sat"; empty matches every night
+}
+
+// Get the price rules of a property
+func GetPropertyPriceRules(ctx iris.Context) {
+	propertyID, err := strconv.ParseUint(ctx.Params().Get("propertyID"), 10, 32)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return
+	}
+
+	var rules []models.PriceRule
+	if err := storage.DB.Where("property_id = ?", propertyID).Order("start_date ASC, priority DESC").Find(&rules).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch price rules"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// Create a price rule
+func CreatePriceRule(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	var input PriceRuleInput
+
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	var rule models.PriceRule
+	if !applyPriceRuleInput(ctx, &rule, input) {
+		return
+	}
+
+	// Verify property ownership
+	var property models.Property
+	if err := storage.DB.Where("id = ? AND host_id = ?", input.PropertyID, userID).First(&property).Error; err != nil {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(iris.Map{"message": "Property not found or access denied"})
+		return
+	}
+
+	if err := storage.DB.Create(&rule).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to create price rule"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Price rule created successfully",
+		"data":    rule,
+	})
+}
+
+// Update a price rule; the property can't be changed
+func UpdatePriceRule(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	ruleID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid price rule ID"})
+		return
+	}
+
+	var input PriceRuleInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	rule, ok := findHostPriceRule(ctx, ruleID, userID)
+	if !ok {
+		return
+	}
+	input.PropertyID = rule.PropertyID
+	if !applyPriceRuleInput(ctx, rule, input) {
+		return
+	}
+
+	if err := storage.DB.Save(rule).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to update price rule"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Price rule updated successfully",
+		"data":    rule,
+	})
+}
+
+// Delete a price rule
+func DeletePriceRule(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	ruleID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid price rule ID"})
+		return
+	}
+
+	rule, ok := findHostPriceRule(ctx, ruleID, userID)
+	if !ok {
+		return
+	}
+	if err := storage.DB.Delete(rule).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to delete price rule"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"message": "Price rule deleted successfully",
+	})
+}
+
+// Effective nightly price of each date between startDate and endDate (both included) and
+// what set it: the base or weekend price, a price set on the calendar, or a price rule
+func GetPropertyPriceCalendar(ctx iris.Context) {
+	propertyID, err := strconv.ParseUint(ctx.Params().Get("propertyID"), 10, 32)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", ctx.URLParam("startDate"))
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid start date format"})
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", ctx.URLParam("endDate"))
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid end date format"})
+		return
+	}
+	if endDate.Before(startDate) || endDate.Sub(startDate) > maxCalendarRange {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "End date must be on or after start date, at most a year later"})
+		return
+	}
+
+	in, err := pricing.Load(storage.DB, pricing.Request{PropertyID: uint(propertyID), CheckIn: startDate, CheckOut: endDate.AddDate(0, 0, 1)})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch prices"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data": iris.Map{
+			"currency": in.Currency(),
+			"nights":   pricing.NightlyCalendar(in, startDate, endDate.AddDate(0, 0, 1)),
+		},
+	})
+}
+
+// findHostPriceRule loads a price rule of one of the host's properties, answering 404 otherwise
+func findHostPriceRule(ctx iris.Context, ruleID, userID uint) (*models.PriceRule, bool) {
+	var rule models.PriceRule
+	if err := storage.DB.Joins("JOIN properties ON properties.id = price_rules.property_id").
+		Where("price_rules.id = ? AND properties.host_id = ?", ruleID, userID).
+		First(&rule).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Price rule not found or access denied"})
+		return nil, false
+	}
+	return &rule, true
+}
+
+// applyPriceRuleInput validates input and copies it onto rule, answering 400 when invalid
+func applyPriceRuleInput(ctx iris.Context, rule *models.PriceRule, input PriceRuleInput) bool {
+	message := ""
+	days, err := services.ParseCheckInDays(input.DaysOfWeek)
+	switch {
+	case err != nil:
+		message = err.Error()
+	case input.EndDate.Before(input.StartDate):
+		message = "endDate must be on or after startDate"
+	case input.Adjustment == pricing.AdjustAbsolute && input.Value < 0:
+		message = "An absolute price can't be negative"
+	case input.Adjustment == pricing.AdjustPercent && input.Value < -100:
+		message = "A percentage can't lower the price by more than 100%"
+	}
+	if message != "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": message})
+		return false
+	}
+
+	rule.PropertyID = input.PropertyID
+	rule.Name = input.Name
+	rule.StartDate = services.CalendarDate(input.StartDate)
+	rule.EndDate = services.CalendarDate(input.EndDate)
+	rule.Adjustment = input.Adjustment
+	rule.Value = input.Value
+	rule.Priority = input.Priority
+	rule.DaysOfWeek = services.FormatCheckInDays(days)
+	return true
+}
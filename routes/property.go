@@ -2,6 +2,7 @@ package routes
 
 import (
 	"apartments-clone-server/models"
+	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
 	"encoding/json"
@@ -13,6 +14,7 @@ import (
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/jwt"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -25,12 +27,13 @@ func CreateProperty(ctx iris.Context) {
 		return
 	}
 
-	// Ensure arrays are never null
-	amenities := input.Amenities
-	if amenities == nil {
-		amenities = []string{}
+	// The listed amenities are stored as catalog keys, linked in the same transaction
+	amenities, err := services.ResolveAmenities(storage.DB, input.Amenities)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"error": "Failed to create property"})
+		return
 	}
-	amenitiesJSON, _ := json.Marshal(amenities)
 
 	// Nearby attractions JSON
 	nearby := input.NearbyAttractions
@@ -68,7 +71,7 @@ func CreateProperty(ctx iris.Context) {
 		CleaningFee:        input.CleaningFee,
 		ServiceFee:         input.ServiceFee,
 		Currency:           input.Currency,
-		Amenities:          string(amenitiesJSON),
+		Amenities:          services.AmenityList(amenities),
 		HouseRules:         input.HouseRules,
 		CancellationPolicy: input.CancellationPolicy,
 		Images:             string(imagesJSON),
@@ -114,27 +117,18 @@ func CreateProperty(ctx iris.Context) {
 		len(property.Images),
 	)
 
-	result := storage.DB.Create(&property)
-	if result.Error != nil {
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&property).Error; err != nil {
+			return err
+		}
+		return services.ReplacePropertyAmenities(tx, property.ID, amenities)
+	})
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"error": "Failed to create property"})
 		return
 	}
 
-	// Sync amenity links into junction table (property_amenities)
-	if len(input.Amenities) > 0 {
-		for _, a := range input.Amenities {
-			if id, err := strconv.Atoi(a); err == nil {
-				// insert if not exists
-				storage.DB.Exec(`
-                    INSERT INTO property_amenities (property_id, amenity_id, is_active, created_at, updated_at)
-                    VALUES (?, ?, TRUE, NOW(), NOW())
-                    ON CONFLICT DO NOTHING
-                `, property.ID, id)
-			}
-		}
-	}
-
 	// Auto-assign property to location criteria
 	if err := AssignSinglePropertyToLocationCriteria(property.ID); err != nil {
 		// Log the error but don't fail the property creation
@@ -148,10 +142,21 @@ func GetProperty(ctx iris.Context) {
 	params := ctx.Params()
 	id := params.Get("id")
 
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
+
 	property := GetPropertyAndAssociationsByPropertyID(id, ctx)
 	if property == nil {
 		return
 	}
+	one := []models.Property{*property}
+	withAmenityDetails(one)
+	property.AmenityDetails = one[0].AmenityDetails
+	displayProperty(rates, displayCurrency, property)
 
 	ctx.JSON(property)
 }
@@ -169,6 +174,7 @@ func GetPropertiesByUserID(ctx iris.Context) {
 			"Error", propertiesExist.Error.Error(), ctx)
 		return
 	}
+	withAmenityDetails(properties)
 
 	ctx.JSON(properties)
 }
@@ -228,7 +234,13 @@ func UpdateProperty(ctx iris.Context) {
 		return
 	}
 
-	amenities, _ := json.Marshal(input.Amenities)
+	amenities, err := services.ResolveAmenities(storage.DB, input.Amenities)
+	if err != nil {
+		utils.CreateError(
+			iris.StatusInternalServerError,
+			"Error", err.Error(), ctx)
+		return
+	}
 
 	imagesArr := insertImages(InsertImages{
 		images:     input.Images,
@@ -256,18 +268,27 @@ func UpdateProperty(ctx iris.Context) {
 	property.CleaningFee = input.CleaningFee
 	property.ServiceFee = input.ServiceFee
 	property.Currency = input.Currency
-	property.Amenities = string(amenities)
+	property.Amenities = services.AmenityList(amenities)
 	property.HouseRules = input.HouseRules
+	if input.CancellationPolicy != property.CancellationPolicy {
+		// Picking a preset by key replaces any policy chosen by ID
+		storage.DB.Model(property).Update("cancellation_policy_id", nil)
+		property.CancellationPolicyID = nil
+	}
 	property.CancellationPolicy = input.CancellationPolicy
 	property.Images = string(jsonImgs)
 	property.IsActive = input.IsActive
 
-	rowsUpdated := storage.DB.Model(&property).Updates(property)
-
-	if rowsUpdated.Error != nil {
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&property).Updates(property).Error; err != nil {
+			return err
+		}
+		return services.ReplacePropertyAmenities(tx, property.ID, amenities)
+	})
+	if err != nil {
 		utils.CreateError(
 			iris.StatusInternalServerError,
-			"Error", rowsUpdated.Error.Error(), ctx)
+			"Error", err.Error(), ctx)
 		return
 	}
 
@@ -307,12 +328,24 @@ func GetPropertiesByBoundingBox(ctx iris.Context) {
 		utils.HandleValidationErrors(err, ctx)
 		return
 	}
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
+	// Optional ?checkIn=&checkOut=&guests= keep the properties bookable for that stay
+	stay, ok := readStaySearch(ctx, "message")
+	if !ok {
+		return
+	}
 
 	fmt.Printf("GetPropertiesByBoundingBox - Searching in bounds: lat[%f-%f], lng[%f-%f]\n",
 		boundingBox.LatLow, boundingBox.LatHigh, boundingBox.LngLow, boundingBox.LngHigh)
 
 	var properties []models.Property
-	result := storage.DB.Preload("Host").
+	result := whereAvailable(storage.DB, stay).
+		Preload("Host").
 		Preload("Reviews").
 		Where("lat >= ? AND lat <= ? AND lng >= ? AND lng <= ? AND is_active = true AND status IN (?)",
 			boundingBox.LatLow, boundingBox.LatHigh, boundingBox.LngLow, boundingBox.LngHigh, []string{"approved", "live"}).
@@ -324,6 +357,10 @@ func GetPropertiesByBoundingBox(ctx iris.Context) {
 		utils.CreateInternalServerError(ctx)
 		return
 	}
+	if properties, err = withStayPrices(properties, stay); err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
 
 	fmt.Printf("GetPropertiesByBoundingBox - Found %d properties\n", len(properties))
 
@@ -333,6 +370,10 @@ func GetPropertiesByBoundingBox(ctx iris.Context) {
 			i, property.ID, property.Title, property.City, property.NightlyPrice,
 			property.Host.FirstName, property.Host.LastName)
 	}
+	withAmenityDetails(properties)
+	for i := range properties {
+		displayProperty(rates, displayCurrency, &properties[i])
+	}
 
 	ctx.JSON(properties)
 }
@@ -1,12 +1,14 @@
 package routes
 
 import (
+	"apartments-clone-server/fx"
 	"apartments-clone-server/models"
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kataras/iris/v12"
@@ -179,6 +181,12 @@ func GetUserPropertySales(ctx iris.Context) {
 // GetPropertySale gets a specific property sale
 func GetPropertySale(ctx iris.Context) {
 	propertyID, _ := strconv.ParseUint(ctx.Params().Get("id"), 10, 32)
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "error", err)
+		return
+	}
 
 	var property models.PropertySale
 	if err := storage.DB.Preload("Organization").Preload("Agent.User").First(&property, propertyID).Error; err != nil {
@@ -186,6 +194,7 @@ func GetPropertySale(ctx iris.Context) {
 		ctx.JSON(iris.Map{"error": "Property not found"})
 		return
 	}
+	displayPropertySale(rates, displayCurrency, &property)
 
 	ctx.JSON(iris.Map{"property": property})
 }
@@ -213,6 +222,8 @@ func CreateOffer(ctx iris.Context) {
 	var payload struct {
 		Amount  float64 `json:"amount"`
 		Message string  `json:"message"`
+		// Currency of amount, the listing's currency when empty
+		Currency string `json:"currency"`
 	}
 	if err := ctx.ReadJSON(&payload); err != nil {
 		ctx.StatusCode(http.StatusBadRequest)
@@ -226,12 +237,28 @@ func CreateOffer(ctx iris.Context) {
 	}
 
 	offer := models.PropertyOffer{
-		PropertyID: property.ID,
-		UserID:     userID,
-		Amount:     payload.Amount,
-		Message:    payload.Message,
-		Status:     "pending",
-		CreatedAt:  time.Now(),
+		PropertyID:      property.ID,
+		UserID:          userID,
+		Amount:          payload.Amount,
+		Message:         payload.Message,
+		Status:          "pending",
+		CreatedAt:       time.Now(),
+		Currency:        property.Currency,
+		ListingCurrency: property.Currency,
+		ListingAmount:   payload.Amount,
+		ExchangeRate:    1,
+	}
+	// Offers in another currency are compared with the others in the listing's currency
+	if currency := fx.Normalize(payload.Currency); currency != "" && currency != fx.Normalize(property.Currency) {
+		rates, err := displayRates(currency)
+		if err == nil {
+			offer.ListingAmount, offer.ExchangeRate, err = rates.Convert(payload.Amount, currency, property.Currency)
+		}
+		if err != nil {
+			writeCurrencyError(ctx, "error", err)
+			return
+		}
+		offer.Currency = currency
 	}
 	if err := storage.DB.Create(&offer).Error; err != nil {
 		ctx.StatusCode(http.StatusInternalServerError)
@@ -289,11 +316,15 @@ func GetOrganizationOffers(ctx iris.Context) {
 			fullName = (o.User.FirstName + " " + o.User.LastName)
 		}
 		resp = append(resp, iris.Map{
-			"id":         o.ID,
-			"amount":     o.Amount,
-			"message":    o.Message,
-			"status":     o.Status,
-			"created_at": o.CreatedAt,
+			"id":               o.ID,
+			"amount":           o.Amount,
+			"currency":         o.Currency,
+			"listing_amount":   o.ListingAmount,
+			"listing_currency": o.ListingCurrency,
+			"exchange_rate":    o.ExchangeRate,
+			"message":          o.Message,
+			"status":           o.Status,
+			"created_at":       o.CreatedAt,
 			"user": iris.Map{
 				"id":          o.UserID,
 				"firstName":   o.User.FirstName,
@@ -378,6 +409,12 @@ func UpdateOfferStatus(ctx iris.Context) {
 func PublicOfferInsights(ctx iris.Context) {
 	propertyIDU64, _ := strconv.ParseUint(ctx.Params().Get("id"), 10, 32)
 	propertyID := uint(propertyIDU64)
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "error", err)
+		return
+	}
 
 	// Only for published properties
 	var property models.PropertySale
@@ -387,7 +424,7 @@ func PublicOfferInsights(ctx iris.Context) {
 		return
 	}
 
-	// Aggregate offers
+	// Aggregate offers in the listing's currency; offers made before conversions were stored are already in it
 	type Row struct {
 		Count int64
 		Min   float64
@@ -396,21 +433,30 @@ func PublicOfferInsights(ctx iris.Context) {
 	}
 	var row Row
 	if err := storage.DB.
-		Raw("SELECT COUNT(*) as count, COALESCE(MIN(amount),0) as min, COALESCE(MAX(amount),0) as max, COALESCE(AVG(amount),0) as avg FROM property_offers WHERE property_id = ?", propertyID).
+		Raw(`SELECT COUNT(*) as count, COALESCE(MIN(a),0) as min, COALESCE(MAX(a),0) as max, COALESCE(AVG(a),0) as avg
+			FROM (SELECT COALESCE(NULLIF(listing_amount,0), amount) AS a FROM property_offers WHERE property_id = ?) o`, propertyID).
 		Scan(&row).Error; err != nil {
 		ctx.StatusCode(http.StatusInternalServerError)
 		ctx.JSON(iris.Map{"error": "Failed to compute insights"})
 		return
 	}
 
+	offers := iris.Map{
+		"count":    row.Count,
+		"lowest":   row.Min,
+		"highest":  row.Max,
+		"average":  row.Avg,
+		"currency": property.Currency,
+	}
+	if rates != nil {
+		offers["display"], _ = rates.Display(property.Currency, displayCurrency, map[string]float64{
+			"lowest":  row.Min,
+			"highest": row.Max,
+			"average": row.Avg,
+		})
+	}
 	ctx.JSON(iris.Map{
-		"offers": iris.Map{
-			"count":    row.Count,
-			"lowest":   row.Min,
-			"highest":  row.Max,
-			"average":  row.Avg,
-			"currency": "MRU",
-		},
+		"offers":   offers,
 		"property": iris.Map{"id": property.ID, "title": property.Title},
 	})
 }
@@ -734,14 +780,33 @@ func PublishProperty(ctx iris.Context) {
 	})
 }
 
-// GetPublishedProperties gets all published properties for public viewing
+// GetPublishedProperties gets all published properties for public viewing; with q only those
+// matching it, best matches first
 func GetPublishedProperties(ctx iris.Context) {
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "error", err)
+		return
+	}
+
+	query := storage.DB.Model(&models.PropertySale{}).Preload("Organization").Preload("Agent.User").
+		Where("(status = ? OR is_published = ?)", "published", true)
+	// Full-text search over the title, description and features, best matches first
+	if text := strings.TrimSpace(ctx.URLParam("q")); text != "" {
+		query = searchText(query, "property_sales", text).Order("search_rank DESC")
+	}
+
 	var properties []models.PropertySale
-	if err := storage.DB.Preload("Organization").Preload("Agent.User").Where("status = ? OR is_published = ?", "published", true).Order("created_at DESC").Find(&properties).Error; err != nil {
+	if err := query.Order("created_at DESC").Find(&properties).Error; err != nil {
 		ctx.StatusCode(http.StatusInternalServerError)
 		ctx.JSON(iris.Map{"error": "Failed to fetch properties"})
 		return
 	}
 
+	for i := range properties {
+		displayPropertySale(rates, displayCurrency, &properties[i])
+	}
+
 	ctx.JSON(iris.Map{"properties": properties})
 }
@@ -1,16 +1,126 @@
 package routes
 
 import (
+	"apartments-clone-server/fx"
 	"apartments-clone-server/models"
+	"apartments-clone-server/pricing"
+	"apartments-clone-server/services"
 	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
 )
 
-// SearchProperties handles property search with multiple filters
-func SearchProperties(ctx iris.Context) {
-	q := storage.DB.Model(&models.Property{})
+// readStaySearch reads the optional checkIn and checkOut (YYYY-MM-DD) and guests parameters of
+// a property search. It returns nil without dates, and answers 400 under key when they are invalid.
+func readStaySearch(ctx iris.Context, key string) (*pricing.Request, bool) {
+	checkInParam, checkOutParam := ctx.URLParam("checkIn"), ctx.URLParam("checkOut")
+	if checkInParam == "" && checkOutParam == "" {
+		return nil, true
+	}
+
+	message := ""
+	checkIn, errIn := time.Parse("2006-01-02", checkInParam)
+	checkOut, errOut := time.Parse("2006-01-02", checkOutParam)
+	guests := ctx.URLParamIntDefault("guests", 1)
+	switch {
+	case errIn != nil || errOut != nil:
+		message = "checkIn and checkOut must both be dates (YYYY-MM-DD)"
+	case !checkIn.Before(checkOut) || checkOut.Sub(checkIn) > maxCalendarRange:
+		message = "checkOut must be after checkIn, at most a year later"
+	case checkIn.Before(services.CalendarDate(time.Now())):
+		message = "checkIn can't be in the past"
+	case guests < 1:
+		message = "guests must be at least 1"
+	}
+	if message != "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{key: message})
+		return nil, false
+	}
+	return &pricing.Request{CheckIn: checkIn, CheckOut: checkOut, Guests: guests}, true
+}
+
+// whereAvailable narrows a properties query to those free for the stay, and whose booking rules
+// accept it, when there is one
+func whereAvailable(q *gorm.DB, stay *pricing.Request) *gorm.DB {
+	if stay == nil {
+		return q
+	}
+	q = services.WhereAvailableForStay(q, stay.CheckIn, stay.CheckOut, stay.Guests)
+	return services.WhereBookingRulesAllow(q, stay.CheckIn, stay.CheckOut, time.Now())
+}
+
+// withStayPrices drops the properties whose booking rules refuse the stay and sets the stay's
+// price on the others; without a stay it returns properties untouched
+func withStayPrices(properties []models.Property, stay *pricing.Request) ([]models.Property, error) {
+	if stay == nil {
+		return properties, nil
+	}
+	quotes, err := pricing.QuoteStays(storage.DB, properties, *stay)
+	if err != nil {
+		return nil, err
+	}
+	bookable := properties[:0]
+	for _, property := range properties {
+		quote, ok := quotes[property.ID]
+		if !ok {
+			continue
+		}
+		property.StayPrice = &models.StayPrice{
+			Nights:   quote.Nights,
+			Guests:   quote.Guests,
+			Total:    quote.Total,
+			PerNight: math.Round(quote.Total/float64(quote.Nights)*100) / 100,
+			Currency: quote.Currency,
+		}
+		bookable = append(bookable, property)
+	}
+	return bookable, nil
+}
+
+// withAmenityDetails sets the catalog amenities of properties, with their names in each
+// language; when they can't be read the properties are answered without them
+func withAmenityDetails(properties []models.Property) {
+	if err := services.LoadPropertyAmenities(storage.DB, properties); err != nil {
+		fmt.Printf("⚠️ Failed to load property amenities: %v\n", err)
+	}
+}
+
+// readPriceRange reads the minPrice and maxPrice filters of a property search; 0 means no bound
+func readPriceRange(ctx iris.Context) (float64, float64) {
+	minPrice, maxPrice := ctx.URLParamFloat64Default("minPrice", 0), ctx.URLParamFloat64Default("maxPrice", 0)
+	return math.Max(minPrice, 0), math.Max(maxPrice, 0)
+}
+
+// whereNightlyPrice narrows a properties query to the nightly prices within [minPrice, maxPrice]
+func whereNightlyPrice(q *gorm.DB, minPrice, maxPrice float64) *gorm.DB {
+	if minPrice > 0 {
+		q = q.Where("nightly_price >= ?", minPrice)
+	}
+	if maxPrice > 0 {
+		q = q.Where("nightly_price <= ?", maxPrice)
+	}
+	return q
+}
+
+// searchPropertiesQuery builds the query of a property search from its filters but the price
+// range: the stay, q, location, attributes and status. It returns the query and the searched
+// text, if any.
+func searchPropertiesQuery(ctx iris.Context, stay *pricing.Request) (*gorm.DB, string) {
+	q := whereAvailable(storage.DB.Model(&models.Property{}), stay)
+
+	// Full-text search over the title, description, neighborhood and house rules
+	text := strings.TrimSpace(ctx.URLParam("q"))
+	if text != "" {
+		q = searchText(q, "properties", text)
+	}
 
 	// Text/location filters
 	if city := strings.TrimSpace(ctx.URLParam("city")); city != "" {
@@ -27,12 +137,6 @@ func SearchProperties(ctx iris.Context) {
 	if pType := strings.TrimSpace(ctx.URLParam("propertyType")); pType != "" {
 		q = q.Where("property_type = ?", pType)
 	}
-	if minPrice, err := ctx.URLParamInt("minPrice"); err == nil && minPrice > 0 {
-		q = q.Where("nightly_price >= ?", minPrice)
-	}
-	if maxPrice, err := ctx.URLParamInt("maxPrice"); err == nil && maxPrice > 0 {
-		q = q.Where("nightly_price <= ?", maxPrice)
-	}
 	if minBeds, err := ctx.URLParamInt("minBeds"); err == nil && minBeds > 0 {
 		q = q.Where("beds >= ?", minBeds)
 	}
@@ -45,6 +149,10 @@ func SearchProperties(ctx iris.Context) {
 	if minRating, err := ctx.URLParamInt("minRating"); err == nil && minRating > 0 {
 		q = q.Where("rating >= ?", minRating)
 	}
+	// Amenities by key, all of them (amenities=wifi,air_conditioning)
+	if keys := services.AmenityKeys(ctx.URLParam("amenities")); len(keys) > 0 {
+		q = services.WhereHasAmenities(q, "properties.id", keys)
+	}
 
 	// Enforce only approved/live properties by default for safety
 	status := strings.TrimSpace(ctx.URLParam("status"))
@@ -62,26 +170,267 @@ func SearchProperties(ctx iris.Context) {
 
 	// Active flag additionally required
 	q = q.Where("COALESCE(is_active, ?) = ?", true, true)
+	return q, text
+}
 
-	// Sorting
+// SearchProperties handles property search with multiple filters. With checkIn, checkOut and
+// guests it only returns properties that can be booked for that stay, with its price, and the
+// price range and sort apply to the stay's price per night. With q the best text matches come
+// first, unless another sort is asked for. Results come a page at a time (limit, cursor), with
+// the total and the next cursor in the X-Total-Count and X-Next-Cursor headers; the total
+// counts the matches of every filter, stay rules included.
+func SearchProperties(ctx iris.Context) {
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
+	stay, ok := readStaySearch(ctx, "message")
+	if !ok {
+		return
+	}
+
+	q, text := searchPropertiesQuery(ctx, stay)
+	minPrice, maxPrice := readPriceRange(ctx)
+
+	// Sorting; pages follow a cursor, ties go by id
+	keyset := utils.Keyset{Column: "created_at", Desc: true}
 	sort := strings.ToLower(strings.TrimSpace(ctx.URLParam("sort")))
+	if stay != nil && (minPrice > 0 || maxPrice > 0 || sort == "price_low" || sort == "price_high") {
+		// The price is the stay's, which only Go computes
+		keyset = utils.Keyset{Column: stayPriceColumn, Desc: sort == "price_high"}
+		keyset, err = utils.ReadKeyset(ctx, keyset, 20, 100)
+		if err != nil || (keyset.After != nil && keyset.After.Number == nil) {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(iris.Map{"message": "Invalid cursor"})
+			return
+		}
+		searchByStayPrice(ctx, q, stay, keyset, minPrice, maxPrice, rates, displayCurrency)
+		return
+	}
+	q = whereNightlyPrice(q, minPrice, maxPrice)
 	switch sort {
 	case "price_low":
-		q = q.Order("nightly_price ASC").Order("id DESC")
+		keyset.Column, keyset.Desc = "nightly_price", false
 	case "price_high":
-		q = q.Order("nightly_price DESC").Order("id DESC")
+		keyset.Column = "nightly_price"
 	case "rating":
-		q = q.Order("rating DESC").Order("id DESC")
+		keyset.Column = "rating"
 	default:
-		q = q.Order("created_at DESC")
+		if text != "" {
+			// The rank is computed by the select, so the cursor compares it outside
+			q = storage.DB.Table("(?) AS properties", q)
+			keyset.Column = "search_rank"
+		}
+	}
+	keyset, err = utils.ReadKeyset(ctx, keyset, 20, 100)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid cursor"})
+		return
 	}
 
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to search properties"})
+		return
+	}
 	var properties []models.Property
-	if err := q.Find(&properties).Error; err != nil {
+	if err := keyset.Apply(q).Find(&properties).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to search properties"})
+		return
+	}
+	n, next := keyset.Next(len(properties), func(last int) string {
+		property := properties[last]
+		switch keyset.Column {
+		case "nightly_price":
+			return keyset.NumberCursor(float64(property.NightlyPrice), property.ID)
+		case "rating":
+			return keyset.NumberCursor(float64(property.Rating), property.ID)
+		case "search_rank":
+			return keyset.NumberCursor(property.SearchRank, property.ID)
+		}
+		return keyset.TimeCursor(property.CreatedAt, property.ID)
+	})
+	properties = properties[:n]
+	if properties, err = withStayPrices(properties, stay); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to price stays"})
+		return
+	}
+	withAmenityDetails(properties)
+	for i := range properties {
+		displayProperty(rates, displayCurrency, &properties[i])
+	}
+
+	utils.SetPageHeaders(ctx, keyset.Meta(total, next))
+	ctx.JSON(properties)
+}
+
+// stayPriceColumn names the sort of searches ordered by the stay's price per night in cursors
+const stayPriceColumn = "stay_price"
+
+// stayPriceBatch is how many matches a search on the stay price prices at a time
+const stayPriceBatch = 500
+
+// maxStayPriced caps how many matches a search on the stay price prices; beyond it the results
+// are marked truncated (X-Results-Truncated) and the total only counts the ones priced
+const maxStayPriced = 5000
+
+// searchByStayPrice answers SearchProperties when a stay is searched with a price range or a
+// price sort, both on the stay's price per night: the matches are priced, filtered and sorted
+// here and then cut into the page keyset asks for.
+func searchByStayPrice(ctx iris.Context, q *gorm.DB, stay *pricing.Request, keyset utils.Keyset, minPrice, maxPrice float64, rates fx.Table, displayCurrency string) {
+	properties, truncated, err := stayPricedMatches(q, stay, keyset, minPrice, maxPrice)
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to search properties"})
 		return
 	}
+	setTruncatedHeader(ctx, truncated)
+	total := int64(len(properties))
+	properties = properties[keysetStart(properties, keyset):]
+	if len(properties) > keyset.Limit+1 {
+		properties = properties[:keyset.Limit+1]
+	}
+
+	n, next := keyset.Next(len(properties), func(last int) string {
+		return keyset.NumberCursor(properties[last].StayPrice.PerNight, properties[last].ID)
+	})
+	properties = properties[:n]
+	withAmenityDetails(properties)
+	for i := range properties {
+		displayProperty(rates, displayCurrency, &properties[i])
+	}
 
+	utils.SetPageHeaders(ctx, keyset.Meta(total, next))
 	ctx.JSON(properties)
 }
+
+// stayPricedMatches prices the properties q finds for the stay, a batch at a time, and returns
+// those within the price range, as pageByStayPrice sorts them. It reports whether it stopped
+// at maxStayPriced with matches left unpriced.
+func stayPricedMatches(q *gorm.DB, stay *pricing.Request, keyset utils.Keyset, minPrice, maxPrice float64) ([]models.Property, bool, error) {
+	var matches []models.Property
+	var lastID uint
+	for priced := 0; ; priced += stayPriceBatch {
+		if priced >= maxStayPriced {
+			var more []models.Property
+			if err := q.Session(&gorm.Session{}).Where("properties.id > ?", lastID).Limit(1).Find(&more).Error; err != nil {
+				return nil, false, err
+			}
+			return pageByStayPrice(matches, keyset, minPrice, maxPrice), len(more) > 0, nil
+		}
+
+		var batch []models.Property
+		if err := q.Session(&gorm.Session{}).Where("properties.id > ?", lastID).
+			Order("properties.id ASC").Limit(stayPriceBatch).Find(&batch).Error; err != nil {
+			return nil, false, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+		quoted, err := withStayPrices(batch, stay)
+		if err != nil {
+			return nil, false, err
+		}
+		matches = append(matches, pageByStayPrice(quoted, keyset, minPrice, maxPrice)...)
+		if len(batch) < stayPriceBatch {
+			break
+		}
+	}
+	return pageByStayPrice(matches, keyset, minPrice, maxPrice), false, nil
+}
+
+// setTruncatedHeader tells clients when a search stopped before checking every match
+func setTruncatedHeader(ctx iris.Context, truncated bool) {
+	if truncated {
+		ctx.Header("X-Results-Truncated", "true")
+	}
+}
+
+// pageByStayPrice keeps the priced properties whose price per night is within [minPrice,
+// maxPrice] (0 for no bound), sorted by it, then by id, in the direction of keyset
+func pageByStayPrice(properties []models.Property, keyset utils.Keyset, minPrice, maxPrice float64) []models.Property {
+	matches := properties[:0]
+	for _, property := range properties {
+		perNight := property.StayPrice.PerNight
+		if (minPrice > 0 && perNight < minPrice) || (maxPrice > 0 && perNight > maxPrice) {
+			continue
+		}
+		matches = append(matches, property)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.StayPrice.PerNight != b.StayPrice.PerNight {
+			return (a.StayPrice.PerNight < b.StayPrice.PerNight) != keyset.Desc
+		}
+		return (a.ID < b.ID) != keyset.Desc
+	})
+	return matches
+}
+
+// keysetStart is the index of the first of properties, as sorted by pageByStayPrice, on the page
+// keyset asks for
+func keysetStart(properties []models.Property, keyset utils.Keyset) int {
+	if keyset.After == nil {
+		return int(math.Min(float64((keyset.Page-1)*keyset.Limit), float64(len(properties))))
+	}
+	after := *keyset.After.Number
+	for i, property := range properties {
+		perNight := property.StayPrice.PerNight
+		beyond := perNight > after || (perNight == after && property.ID > keyset.After.ID)
+		if keyset.Desc {
+			beyond = perNight < after || (perNight == after && property.ID < keyset.After.ID)
+		}
+		if beyond {
+			return i
+		}
+	}
+	return len(properties)
+}
+
+// SearchPropertyFacets counts the properties SearchProperties would find with the same filters
+// per type, category, amenity, bedrooms and area, with their nightly prices split into buckets
+// equal ranges (10 by default, at most 50). The total is the search's.
+func SearchPropertyFacets(ctx iris.Context) {
+	stay, ok := readStaySearch(ctx, "message")
+	if !ok {
+		return
+	}
+	q, _ := searchPropertiesQuery(ctx, stay)
+	minPrice, maxPrice := readPriceRange(ctx)
+	if stay != nil && (minPrice > 0 || maxPrice > 0) {
+		// Count what the search finds, within the range of the stay's price
+		matches, truncated, err := stayPricedMatches(q, stay, utils.Keyset{}, minPrice, maxPrice)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to load facets"})
+			return
+		}
+		setTruncatedHeader(ctx, truncated)
+		ids := make([]uint, len(matches))
+		for i, property := range matches {
+			ids[i] = property.ID
+		}
+		q = q.Where("properties.id IN ?", ids)
+	} else {
+		q = whereNightlyPrice(q, minPrice, maxPrice)
+	}
+
+	facets, err := services.LoadPropertyFacets(storage.DB, q, ctx.URLParamIntDefault("buckets", services.DefaultPriceBuckets))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to load facets"})
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    facets,
+	})
+}
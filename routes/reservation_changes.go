@@ -0,0 +1,422 @@
+package routes
+
+import (
+	"apartments-clone-server/coupons"
+	"apartments-clone-server/invoices"
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"apartments-clone-server/pricing"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Change requests let a guest move the dates or guest count of a pending or confirmed
+// reservation without cancelling it. The host accepts or declines; on acceptance the
+// reservation is updated and the price difference charged or refunded.
+
+type ReservationChangeInput struct {
+	CheckIn   time.Time `json:"checkIn"`
+	CheckOut  time.Time `json:"checkOut"`
+	NumGuests int       `json:"numGuests" validate:"gte=0"`
+	Message   string    `json:"message"`
+	// Children are counted in NumGuests, infants are not; zero is a valid new value
+	NumChildren *int `json:"numChildren"`
+	NumInfants  *int `json:"numInfants"`
+}
+
+type ReservationChangeResponseInput struct {
+	Note string `json:"note"`
+}
+
+var errChangeNotPending = errors.New("change request is no longer pending")
+
+// Guest proposes new dates and/or guest count
+func RequestReservationChange(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	reservationID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid reservation ID"})
+		return
+	}
+	var input ReservationChangeInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+
+	var reservation models.Reservation
+	if err := storage.DB.Preload("Property").Where("id = ? AND guest_id = ?", reservationID, userID).First(&reservation).Error; err != nil ||
+		reservation.Property == nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Reservation not found"})
+		return
+	}
+	if (reservation.Status != "pending" && reservation.Status != "confirmed") || !reservation.CheckIn.After(time.Now()) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Only upcoming pending or confirmed reservations can be changed"})
+		return
+	}
+
+	// Anything not sent keeps its current value
+	change := models.ReservationChangeRequest{
+		ReservationID:  reservation.ID,
+		RequestedBy:    userID,
+		OldCheckIn:     reservation.CheckIn,
+		OldCheckOut:    reservation.CheckOut,
+		OldNumGuests:   reservation.NumGuests,
+		OldNumChildren: reservation.NumChildren,
+		OldNumInfants:  reservation.NumInfants,
+		OldTotal:       float64(reservation.TotalPrice),
+		NewCheckIn:     reservation.CheckIn,
+		NewCheckOut:    reservation.CheckOut,
+		NewNumGuests:   reservation.NumGuests,
+		NewNumChildren: reservation.NumChildren,
+		NewNumInfants:  reservation.NumInfants,
+		Status:         "pending",
+		Message:        input.Message,
+	}
+	if !input.CheckIn.IsZero() {
+		change.NewCheckIn = input.CheckIn
+	}
+	if !input.CheckOut.IsZero() {
+		change.NewCheckOut = input.CheckOut
+	}
+	if input.NumGuests > 0 {
+		change.NewNumGuests = input.NumGuests
+	}
+	if input.NumChildren != nil {
+		change.NewNumChildren = *input.NumChildren
+	}
+	if input.NumInfants != nil {
+		change.NewNumInfants = *input.NumInfants
+	}
+
+	switch {
+	case change.NewCheckIn.Equal(change.OldCheckIn) && change.NewCheckOut.Equal(change.OldCheckOut) && change.NewNumGuests == change.OldNumGuests &&
+		change.NewNumChildren == change.OldNumChildren && change.NewNumInfants == change.OldNumInfants:
+		utils.CreateError(iris.StatusBadRequest, "Validation Error", "Nothing to change", ctx)
+		return
+	case !change.NewCheckIn.Before(change.NewCheckOut):
+		utils.CreateError(iris.StatusBadRequest, "Validation Error", "checkIn must be before checkOut", ctx)
+		return
+	case !change.NewCheckIn.After(time.Now()):
+		utils.CreateError(iris.StatusBadRequest, "Validation Error", "checkIn must be in the future", ctx)
+		return
+	}
+
+	party := services.Party{Guests: change.NewNumGuests, Children: change.NewNumChildren, Infants: change.NewNumInfants}
+	violations, err := services.CheckBookingRules(storage.DB, reservation.Property, change.NewCheckIn, change.NewCheckOut, party)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if len(violations) > 0 {
+		writeRuleViolations(ctx, violations)
+		return
+	}
+
+	var pending int64
+	storage.DB.Model(&models.ReservationChangeRequest{}).Where("reservation_id = ? AND status = ?", reservation.ID, "pending").Count(&pending)
+	if pending > 0 {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": "A change request for this reservation is already pending"})
+		return
+	}
+
+	conflict, err := services.CheckStayAvailability(storage.DB, reservation.PropertyID, change.NewCheckIn, change.NewCheckOut, reservation.ID)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if conflict.Any() {
+		writeAvailabilityConflict(ctx, conflict)
+		return
+	}
+
+	// The promo code the stay was booked with keeps applying to the new price
+	booked, _ := pricing.Decode(reservation.PriceBreakdown)
+	quote, err := pricing.Requote(storage.DB, pricing.Request{
+		PropertyID: reservation.PropertyID,
+		CheckIn:    change.NewCheckIn,
+		CheckOut:   change.NewCheckOut,
+		Guests:     change.NewNumGuests,
+		Children:   change.NewNumChildren,
+		Infants:    change.NewNumInfants,
+		UserID:     reservation.GuestID,
+	}, booked)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	change.NewTotal = quote.Total
+	change.PriceBreakdown = quote.JSON()
+	change.PriceDifference = quote.Total - change.OldTotal
+	change.Currency = quote.Currency
+
+	if err := storage.DB.Create(&change).Error; err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	createReservationNotification(reservation.Property.HostID, "reservation_change_requested", "Reservation Change Requested",
+		fmt.Sprintf("Your guest asked to change their stay at %s to %s - %s for %d guests",
+			reservation.Property.Title, change.NewCheckIn.Format("Jan 2, 2006"), change.NewCheckOut.Format("Jan 2, 2006"), change.NewNumGuests),
+		reservation.ID)
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(iris.Map{"success": true, "data": change})
+}
+
+// Change history of a reservation, for its guest or host
+func GetReservationChanges(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	reservationID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid reservation ID"})
+		return
+	}
+
+	var reservation models.Reservation
+	if err := storage.DB.Preload("Property").First(&reservation, reservationID).Error; err != nil ||
+		(reservation.GuestID != userID && (reservation.Property == nil || reservation.Property.HostID != userID)) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Reservation not found"})
+		return
+	}
+
+	var changes []models.ReservationChangeRequest
+	if err := storage.DB.Where("reservation_id = ?", reservation.ID).Order("created_at DESC").Find(&changes).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch change requests"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": changes})
+}
+
+// Host accepts: the reservation moves to the new dates/guests and the difference is settled
+func AcceptReservationChange(ctx iris.Context) {
+	change, reservation, ok := hostReservationChange(ctx)
+	if !ok {
+		return
+	}
+	var input ReservationChangeResponseInput
+	_ = ctx.ReadJSON(&input) // the note is optional
+
+	var oldCheckIn, oldCheckOut time.Time
+	conflict, err := services.ReserveStay(storage.DB, reservation.PropertyID, change.NewCheckIn, change.NewCheckOut, reservation.ID, func(tx *gorm.DB, property *models.Property) error {
+		if err := lockPendingChange(tx, change); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(reservation, reservation.ID).Error; err != nil {
+			return err
+		}
+		if reservation.Status != "pending" && reservation.Status != "confirmed" {
+			return errChangeNotPending
+		}
+		oldCheckIn, oldCheckOut = reservation.CheckIn, reservation.CheckOut
+
+		if reservation.Status == "confirmed" {
+			// The receipt shows what was paid before the change; the difference gets its own document below
+			if _, err := invoices.ReservationReceipt(tx, reservation.ID); err != nil && !errors.Is(err, invoices.ErrNotPaid) {
+				return err
+			}
+			// A deposit still held can be claimed for the usual window after the new checkout
+			if err := tx.Model(&models.SecurityDeposit{}).Where("reservation_id = ? AND status = ?", reservation.ID, services.DepositHeld).
+				Update("claim_deadline", change.NewCheckOut.Add(services.DepositClaimWindow())).Error; err != nil {
+				return err
+			}
+		}
+
+		reservation.CheckIn = change.NewCheckIn
+		reservation.CheckOut = change.NewCheckOut
+		reservation.NumGuests = change.NewNumGuests
+		reservation.NumChildren = change.NewNumChildren
+		reservation.NumInfants = change.NewNumInfants
+		reservation.TotalPrice = float32(change.NewTotal)
+		reservation.PriceBreakdown = change.PriceBreakdown
+		if err := tx.Save(reservation).Error; err != nil {
+			return err
+		}
+		if err := pricing.RecordReservationTaxes(tx, reservation); err != nil {
+			return err
+		}
+		if breakdown, err := pricing.Decode(change.PriceBreakdown); err == nil && breakdown.CouponID != 0 {
+			if err := coupons.UpdateDiscount(tx, payments.SubjectReservation, reservation.ID, breakdown.CouponDiscount); err != nil {
+				return err
+			}
+		}
+
+		reason := fmt.Sprintf("Change request #%d", change.ID)
+		settled, err := payments.Reprice(tx, reservationCharge(reservation, property.HostID), reason)
+		if err != nil && !errors.Is(err, payments.ErrNoPayment) {
+			return err
+		}
+		// A supplementary receipt for an extra charge, a credit note for a refund
+		if settled > 0 {
+			tax := 0.0
+			if breakdown, err := pricing.Decode(change.PriceBreakdown); err == nil {
+				tax = breakdown.TaxAmount
+			}
+			if _, err := invoices.IssueSupplement(tx, payments.SubjectReservation, reservation.ID, settled, tax, reason); err != nil {
+				return err
+			}
+		} else if settled < 0 {
+			if _, err := invoices.IssueCreditNote(tx, payments.SubjectReservation, reservation.ID, -settled, reason); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		change.Status = "accepted"
+		change.Settled = settled
+		change.RespondedAt = &now
+		change.ResponseNote = input.Note
+		return tx.Save(change).Error
+	})
+	if errors.Is(err, services.ErrDatesUnavailable) {
+		writeAvailabilityConflict(ctx, conflict)
+		return
+	}
+	if errors.Is(err, payments.ErrDeclined) {
+		utils.CreateError(iris.StatusPaymentRequired, "Payment Declined", "The price difference could not be charged", ctx)
+		return
+	}
+	if errors.Is(err, errChangeNotPending) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+
+	message := "Your host accepted the change to your reservation."
+	if change.Settled > 0 {
+		message += fmt.Sprintf(" %.2f %s was charged.", change.Settled, change.Currency)
+	} else if change.Settled < 0 {
+		message += fmt.Sprintf(" %.2f %s will be refunded.", -change.Settled, change.Currency)
+	}
+	createReservationNotification(reservation.GuestID, "reservation_change_accepted", "Reservation Change Accepted", message, reservation.ID)
+	// A shorter or moved stay frees some of the old nights
+	if change.NewCheckIn.After(oldCheckIn) || change.NewCheckOut.Before(oldCheckOut) {
+		offerToWaitlist(reservation.PropertyID, oldCheckIn, oldCheckOut)
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": iris.Map{"change": change, "reservation": reservation}})
+}
+
+// Host declines; the reservation is unchanged
+func DeclineReservationChange(ctx iris.Context) {
+	change, reservation, ok := hostReservationChange(ctx)
+	if !ok {
+		return
+	}
+	var input ReservationChangeResponseInput
+	_ = ctx.ReadJSON(&input) // the note is optional
+
+	if err := respondToChange(change, "declined", input.Note); err != nil {
+		writeChangeError(ctx, err)
+		return
+	}
+
+	createReservationNotification(reservation.GuestID, "reservation_change_declined", "Reservation Change Declined",
+		"Your host declined the change to your reservation. Your booking is unchanged.", reservation.ID)
+
+	ctx.JSON(iris.Map{"success": true, "data": change})
+}
+
+// Guest withdraws a change they no longer want
+func WithdrawReservationChange(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid change request ID"})
+		return
+	}
+
+	var change models.ReservationChangeRequest
+	if err := storage.DB.Where("requested_by = ?", userID).First(&change, id).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Change request not found"})
+		return
+	}
+
+	if err := respondToChange(&change, "withdrawn", ""); err != nil {
+		writeChangeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": change})
+}
+
+// hostReservationChange loads the change request in the route and checks the caller hosts its property
+func hostReservationChange(ctx iris.Context) (*models.ReservationChangeRequest, *models.Reservation, bool) {
+	userID := ctx.Values().Get("userID").(uint)
+	id, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid change request ID"})
+		return nil, nil, false
+	}
+
+	var change models.ReservationChangeRequest
+	var reservation models.Reservation
+	if err := storage.DB.First(&change, id).Error; err != nil ||
+		storage.DB.Preload("Property").First(&reservation, change.ReservationID).Error != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Change request not found"})
+		return nil, nil, false
+	}
+	if reservation.Property == nil || reservation.Property.HostID != userID {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(iris.Map{"message": "Access denied"})
+		return nil, nil, false
+	}
+	return &change, &reservation, true
+}
+
+// lockPendingChange re-reads the change request under a row lock and checks it is still open
+func lockPendingChange(tx *gorm.DB, change *models.ReservationChangeRequest) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(change, change.ID).Error; err != nil {
+		return err
+	}
+	if change.Status != "pending" {
+		return errChangeNotPending
+	}
+	return nil
+}
+
+func respondToChange(change *models.ReservationChangeRequest, status, note string) error {
+	return storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingChange(tx, change); err != nil {
+			return err
+		}
+		now := time.Now()
+		change.Status = status
+		change.ResponseNote = note
+		change.RespondedAt = &now
+		return tx.Save(change).Error
+	})
+}
+
+func writeChangeError(ctx iris.Context, err error) {
+	if errors.Is(err, errChangeNotPending) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": err.Error()})
+		return
+	}
+	utils.CreateInternalServerError(ctx)
+}
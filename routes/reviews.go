@@ -43,28 +43,37 @@ func ListPropertyReviews(ctx iris.Context) {
 		return
 	}
 
-	// Get all reviews with user info
-	var reviews []models.Review
-	if err := storage.DB.Preload("User").
-		Where("property_id = ?", propertyID).
-		Order("created_at DESC").
-		Find(&reviews).Error; err != nil {
+	keyset, err := utils.ReadKeyset(ctx, utils.Keyset{Column: "created_at", Desc: true}, 20, 100)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid cursor"})
+		return
+	}
+
+	// Count and average over every review, the list is paged
+	var stats struct {
+		Count   int64
+		Average float64
+	}
+	if err := storage.DB.Model(&models.Review{}).Where("property_id = ?", propertyID).
+		Select("COUNT(*) AS count, COALESCE(AVG(stars), 0) AS average").Scan(&stats).Error; err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"message": "Failed to load reviews"})
 		return
 	}
+	reviewCount := stats.Count
+	avgRating := stats.Average
 
-	// Calculate average rating
-	var totalStars float64
-	var reviewCount int
-	for _, review := range reviews {
-		totalStars += float64(review.Stars)
-		reviewCount++
-	}
-	avgRating := 0.0
-	if reviewCount > 0 {
-		avgRating = totalStars / float64(reviewCount)
+	// Get a page of reviews with user info
+	var reviews []models.Review
+	if err := keyset.Apply(storage.DB.Preload("User").Where("property_id = ?", propertyID)).
+		Find(&reviews).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to load reviews"})
+		return
 	}
+	n, next := keyset.Next(len(reviews), func(last int) string { return keyset.TimeCursor(reviews[last].CreatedAt, reviews[last].ID) })
+	reviews = reviews[:n]
 
 	// Check if current user can review
 	canReview := false
@@ -146,6 +155,7 @@ func ListPropertyReviews(ctx iris.Context) {
 			"averageRating":     avgRating,
 			"reviewCount":       reviewCount,
 		},
+		"meta": keyset.Meta(reviewCount, next),
 	})
 }
 
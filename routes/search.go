@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"strings"
+
+	"apartments-clone-server/models"
+	"apartments-clone-server/storage"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Full-text search over the search_vector columns the storage migrations keep up to date
+
+// searchSnippetOptions highlight the matches with <mark> in at most two fragments
+const searchSnippetOptions = `StartSel=<mark>, StopSel=</mark>, MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "`
+
+// searchText narrows q, a query over table, to the rows matching text and selects their rank
+// as search_rank and a highlighted excerpt of the description (the title when there is none)
+// as search_snippet, HTML with the listing's text escaped. Callers order by search_rank unless
+// the client picked another sort.
+func searchText(q *gorm.DB, table, text string) *gorm.DB {
+	return q.Select(table+".*, ts_rank("+table+".search_vector, listing_tsquery(?)) AS search_rank, "+
+		"listing_headline(COALESCE(NULLIF("+table+".description, ''), "+table+".title), ?, ?) AS search_snippet",
+		text, text, searchSnippetOptions).
+		Where(table+".search_vector @@ listing_tsquery(?)", text)
+}
+
+// Search looks for q in the live properties and experiences and the published property sales,
+// best matches first. type=properties, experiences or sales searches only one of them.
+func Search(ctx iris.Context) {
+	text := strings.TrimSpace(ctx.URLParam("q"))
+	kind := ctx.URLParamDefault("type", "all")
+	limit := ctx.URLParamIntDefault("limit", 20)
+	if text == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "q is required"})
+		return
+	}
+	if kind != "all" && kind != "properties" && kind != "experiences" && kind != "sales" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "type must be all, properties, experiences or sales"})
+		return
+	}
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+	displayCurrency := ctx.URLParam("currency")
+	rates, err := displayRates(displayCurrency)
+	if err != nil {
+		writeCurrencyError(ctx, "message", err)
+		return
+	}
+
+	data := iris.Map{}
+	if kind == "all" || kind == "properties" {
+		var properties []models.Property
+		if err := searchText(storage.DB.Model(&models.Property{}), "properties", text).
+			Where("status IN ? AND COALESCE(is_active, ?) = ?", []string{"approved", "live"}, true, true).
+			Order("search_rank DESC").Order("id DESC").Limit(limit).Find(&properties).Error; err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to search properties"})
+			return
+		}
+		withAmenityDetails(properties)
+		for i := range properties {
+			displayProperty(rates, displayCurrency, &properties[i])
+		}
+		data["properties"] = properties
+	}
+	if kind == "all" || kind == "experiences" {
+		var experiences []models.Experience
+		if err := searchText(storage.DB.Model(&models.Experience{}), "experiences", text).Preload("Host").
+			Where("status = ?", "live").
+			Order("search_rank DESC").Order("id DESC").Limit(limit).Find(&experiences).Error; err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to search experiences"})
+			return
+		}
+		data["experiences"] = experiences
+	}
+	if kind == "all" || kind == "sales" {
+		var sales []models.PropertySale
+		if err := searchText(storage.DB.Model(&models.PropertySale{}), "property_sales", text).Preload("Organization").
+			Where("(status = ? OR is_published = ?)", "published", true).
+			Order("search_rank DESC").Order("id DESC").Limit(limit).Find(&sales).Error; err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(iris.Map{"message": "Failed to search property sales"})
+			return
+		}
+		for i := range sales {
+			displayPropertySale(rates, displayCurrency, &sales[i])
+		}
+		data["sales"] = sales
+	}
+
+	ctx.JSON(iris.Map{
+		"success": true,
+		"data":    data,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"apartments-clone-server/storage"
 	"apartments-clone-server/utils"
 	"fmt"
+	"strings"
 
 	"github.com/kataras/iris/v12"
 	jsonWT "github.com/kataras/iris/v12/middleware/jwt"
@@ -65,17 +66,6 @@ func GetVideoFeed(ctx iris.Context) {
 		}
 	}
 
-	// simple pagination
-	page := ctx.URLParamIntDefault("page", 1)
-	limit := ctx.URLParamIntDefault("limit", 10)
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 || limit > 50 {
-		limit = 10
-	}
-	offset := (page - 1) * limit
-
 	// Enhanced filtering parameters for TikTok-quality experience
 	city := ctx.URLParam("city")
 	propertyType := ctx.URLParam("propertyType")
@@ -91,14 +81,12 @@ func GetVideoFeed(ctx iris.Context) {
 	sortOrder := ctx.URLParamDefault("sortOrder", "DESC") // ASC, DESC
 
 	// Build query with filters: only videos for approved/live & active properties; exclude flagged/rejected videos
-	query := storage.DB.
+	query := storage.DB.Model(&models.Video{}).
 		Joins("JOIN properties ON videos.property_id = properties.id").
 		Where("COALESCE(properties.is_active, ?) = ? AND properties.status IN (?)", true, true, []string{"approved", "live"}).
 		// Exclude only explicitly rejected videos; allow pending/empty/approved
 		Where("(videos.status IS NULL OR LOWER(videos.status) <> ?)", "rejected").
-		Where("COALESCE(videos.is_flagged, ?) = ?", false, false).
-		Select("videos.*").
-		Preload("Property").Preload("User")
+		Where("COALESCE(videos.is_flagged, ?) = ?", false, false)
 
 	// Apply property filters
 	if city != "" {
@@ -133,39 +121,73 @@ func GetVideoFeed(ctx iris.Context) {
 		query = query.Joins("JOIN properties ON videos.property_id = properties.id").
 			Where("properties.bathrooms <= ?", maxBathrooms)
 	}
+	if keys := services.AmenityKeys(ctx.URLParam("amenities")); len(keys) > 0 {
+		query = services.WhereHasAmenities(query, "properties.id", keys)
+	}
 
-	// Apply TikTok-style sorting with property correlation
-	var orderClause string
+	// Apply TikTok-style sorting with property correlation. Pages follow a cursor, so videos
+	// posted while scrolling don't push already seen ones onto the next page; ties go by id.
+	keyset := utils.Keyset{Column: "videos.created_at", ID: "videos.id", Desc: !strings.EqualFold(sortOrder, "ASC")}
 	switch sortBy {
-	case "recent":
-		orderClause = "videos.created_at " + sortOrder
 	case "most_liked":
-		orderClause = "videos.likes_count " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "videos.likes_count"
 	case "most_commented":
-		orderClause = "videos.comments_count " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "videos.comments_count"
 	case "most_viewed":
-		orderClause = "videos.views_count " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "videos.view_count"
 	case "most_saved":
-		orderClause = "videos.saves_count " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "videos.saves_count"
 	case "price_low":
-		orderClause = "properties.nightly_price ASC, videos.created_at DESC"
+		keyset.Column, keyset.Desc = "properties.nightly_price", false
 	case "price_high":
-		orderClause = "properties.nightly_price DESC, videos.created_at DESC"
+		keyset.Column, keyset.Desc = "properties.nightly_price", true
 	case "rating":
-		orderClause = "properties.rating " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "properties.rating"
 	case "bedrooms":
-		orderClause = "properties.bedrooms " + sortOrder + ", videos.created_at DESC"
+		keyset.Column = "properties.bedrooms"
 	case "bathrooms":
-		orderClause = "properties.bathrooms " + sortOrder + ", videos.created_at DESC"
-	default:
-		orderClause = "videos.created_at " + sortOrder
+		keyset.Column = "properties.bathrooms"
+	}
+	keyset, err := utils.ReadKeyset(ctx, keyset, 10, 50)
+	if err != nil {
+		utils.CreateError(iris.StatusBadRequest, "Bad Request", err.Error(), ctx)
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
 	}
 
 	var videos []models.Video
-	if err := query.Order(orderClause).Limit(limit).Offset(offset).Find(&videos).Error; err != nil {
+	if err := keyset.Apply(query.Select("videos.*").Preload("Property").Preload("User")).Find(&videos).Error; err != nil {
 		utils.CreateInternalServerError(ctx)
 		return
 	}
+	n, next := keyset.Next(len(videos), func(last int) string {
+		video := videos[last]
+		switch keyset.Column {
+		case "videos.likes_count":
+			return keyset.NumberCursor(float64(video.LikesCount), video.ID)
+		case "videos.comments_count":
+			return keyset.NumberCursor(float64(video.CommentsCount), video.ID)
+		case "videos.view_count":
+			return keyset.NumberCursor(float64(video.ViewCount), video.ID)
+		case "videos.saves_count":
+			return keyset.NumberCursor(float64(video.SavesCount), video.ID)
+		case "properties.nightly_price":
+			return keyset.NumberCursor(float64(video.Property.NightlyPrice), video.ID)
+		case "properties.rating":
+			return keyset.NumberCursor(float64(video.Property.Rating), video.ID)
+		case "properties.bedrooms":
+			return keyset.NumberCursor(float64(video.Property.Bedrooms), video.ID)
+		case "properties.bathrooms":
+			return keyset.NumberCursor(float64(video.Property.Bathrooms), video.ID)
+		}
+		return keyset.TimeCursor(video.CreatedAt, video.ID)
+	})
+	videos = videos[:n]
 
 	// Get user's liked and saved video IDs for this batch
 	var videoIDs []uint
@@ -209,7 +231,7 @@ func GetVideoFeed(ctx iris.Context) {
 		})
 	}
 
-	ctx.JSON(iris.Map{"success": true, "videos": videosWithState, "page": page})
+	ctx.JSON(iris.Map{"success": true, "videos": videosWithState, "page": keyset.Page, "meta": keyset.Meta(total, next)})
 }
 
 func LikeVideo(ctx iris.Context) {
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/services"
+	"apartments-clone-server/storage"
+	"apartments-clone-server/utils"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Waitlist endpoints: guests who find their dates taken wait in line for them and are
+// notified, one at a time, when the nights free up.
+
+type JoinWaitlistInput struct {
+	CheckIn   time.Time `json:"checkIn" validate:"required"`
+	CheckOut  time.Time `json:"checkOut" validate:"required"`
+	NumGuests int       `json:"numGuests" validate:"gte=0"` // optional, defaults to one guest
+}
+
+// Join the waitlist of a property for dates that are currently taken
+func JoinWaitlist(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	propertyID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid property ID"})
+		return
+	}
+
+	var input JoinWaitlistInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		utils.HandleValidationErrors(err, ctx)
+		return
+	}
+	if !input.CheckIn.Before(input.CheckOut) {
+		utils.CreateError(iris.StatusBadRequest, "Validation Error", "checkIn must be before checkOut", ctx)
+		return
+	}
+	if input.NumGuests == 0 {
+		input.NumGuests = 1
+	}
+
+	var property models.Property
+	if err := storage.DB.First(&property, propertyID).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Property not found"})
+		return
+	}
+	if property.HostID == userID {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Hosts can't join the waitlist of their own property"})
+		return
+	}
+
+	// Only stays the guest could book once the nights are free are worth waiting for
+	violations, err := services.CheckBookingRules(storage.DB, &property, input.CheckIn, input.CheckOut, services.Party{Guests: input.NumGuests})
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if len(violations) > 0 {
+		writeRuleViolations(ctx, violations)
+		return
+	}
+
+	conflict, err := services.CheckStayAvailability(storage.DB, property.ID, input.CheckIn, input.CheckOut, 0)
+	if err != nil {
+		utils.CreateInternalServerError(ctx)
+		return
+	}
+	if !conflict.Any() {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"ok": true, "message": "Selected dates are available, book them instead"})
+		return
+	}
+
+	entry, err := services.JoinWaitlist(storage.DB, property.ID, userID, input.CheckIn, input.CheckOut, input.NumGuests)
+	if errors.Is(err, services.ErrAlreadyWaitlisted) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(iris.Map{"message": "You are already on the waitlist for these dates"})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to join the waitlist"})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(iris.Map{"success": true, "data": entry})
+}
+
+// List the guest's waitlist entries
+func GetUserWaitlist(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+
+	q := storage.DB.Preload("Property").Where("user_id = ?", userID)
+	if status := ctx.URLParamDefault("status", ""); status != "" {
+		q = q.Where("status = ?", status)
+	}
+
+	var entries []models.WaitlistEntry
+	if err := q.Order("created_at DESC").Find(&entries).Error; err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to fetch waitlist"})
+		return
+	}
+
+	ctx.JSON(iris.Map{"success": true, "data": entries})
+}
+
+// Leave the waitlist; a claim the guest gives up goes to the next guest in line
+func LeaveWaitlist(ctx iris.Context) {
+	userID := ctx.Values().Get("userID").(uint)
+	entryID, err := ctx.Params().GetUint("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Invalid waitlist ID"})
+		return
+	}
+
+	var entry models.WaitlistEntry
+	if err := storage.DB.Where("id = ? AND user_id = ?", entryID, userID).First(&entry).Error; err != nil {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(iris.Map{"message": "Waitlist entry not found"})
+		return
+	}
+
+	result := storage.DB.Model(&models.WaitlistEntry{}).
+		Where("id = ? AND status IN ?", entry.ID, services.OpenWaitlistStatuses).
+		Update("status", services.WaitlistCancelled)
+	if result.Error != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(iris.Map{"message": "Failed to leave the waitlist"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(iris.Map{"message": "Waitlist entry is already closed"})
+		return
+	}
+	if entry.Status == services.WaitlistNotified {
+		offerToWaitlist(entry.PropertyID, entry.CheckIn, entry.CheckOut)
+	}
+
+	ctx.JSON(iris.Map{"success": true, "message": "Left the waitlist"})
+}
+
+// offerToWaitlist notifies the waitlist after nights in [from, to) were freed. The change that
+// freed them is already saved, so a failure here is only logged.
+func offerToWaitlist(propertyID uint, from, to time.Time) {
+	if _, err := services.NotifyWaitlist(storage.DB, propertyID, from, to); err != nil {
+		log.Printf("❌ WAITLIST: property %d not offered to the waitlist: %v", propertyID, err)
+	}
+}
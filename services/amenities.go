@@ -0,0 +1,135 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"encoding/json"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ResolveAmenities returns the catalog amenities values stand for (ids, keys or names, see
+// models.MatchAmenity), each once in the order of values; values matching none are left out
+func ResolveAmenities(db *gorm.DB, values []string) ([]models.Amenity, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	var catalog []models.Amenity
+	if err := db.Find(&catalog).Error; err != nil {
+		return nil, err
+	}
+	return matchAmenities(catalog, values), nil
+}
+
+func matchAmenities(catalog []models.Amenity, values []string) []models.Amenity {
+	amenities := []models.Amenity{}
+	seen := map[int]bool{}
+	for _, value := range values {
+		amenity, ok := models.MatchAmenity(catalog, value)
+		if ok && !seen[amenity.ID] {
+			seen[amenity.ID] = true
+			amenities = append(amenities, amenity)
+		}
+	}
+	return amenities
+}
+
+// AmenityList is the Property.Amenities list of amenities: their keys, as JSON
+func AmenityList(amenities []models.Amenity) string {
+	keys := make([]string, len(amenities))
+	for i, amenity := range amenities {
+		keys[i] = amenity.Key
+	}
+	list, _ := json.Marshal(keys)
+	return string(list)
+}
+
+// ReplacePropertyAmenities links a property to exactly amenities; its Property.Amenities list
+// must be AmenityList(amenities) for both to agree
+func ReplacePropertyAmenities(tx *gorm.DB, propertyID uint, amenities []models.Amenity) error {
+	if err := tx.Where("property_id = ?", propertyID).Delete(&models.PropertyAmenity{}).Error; err != nil {
+		return err
+	}
+	if len(amenities) == 0 {
+		return nil
+	}
+	links := make([]models.PropertyAmenity, len(amenities))
+	for i, amenity := range amenities {
+		links[i] = models.PropertyAmenity{PropertyID: propertyID, AmenityID: amenity.ID}
+	}
+	return tx.Create(&links).Error
+}
+
+// AmenityKeys reads an amenities filter, keys or names separated by commas, into distinct keys
+func AmenityKeys(param string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, value := range strings.Split(param, ",") {
+		key := models.AmenityKey(value)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// WhereHasAmenities narrows q to the properties, whose id is idColumn, that have every amenity
+// of keys
+func WhereHasAmenities(q *gorm.DB, idColumn string, keys []string) *gorm.DB {
+	if len(keys) == 0 {
+		return q
+	}
+	return q.Where(idColumn+` IN (SELECT pa.property_id FROM property_amenities pa
+		JOIN amenities a ON a.id = pa.amenity_id
+		WHERE a.key IN ? GROUP BY pa.property_id HAVING COUNT(DISTINCT a.key) = ?)`, keys, len(keys))
+}
+
+// LoadPropertyAmenities sets the AmenityDetails of properties, their active catalog amenities
+// grouped by category, in one query
+func LoadPropertyAmenities(db *gorm.DB, properties []models.Property) error {
+	if len(properties) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(properties))
+	for i, property := range properties {
+		ids[i] = property.ID
+	}
+
+	var rows []struct {
+		PropertyID uint
+		models.Amenity
+	}
+	if err := db.Raw(`SELECT pa.property_id, a.* FROM property_amenities pa
+		JOIN amenities a ON a.id = pa.amenity_id
+		WHERE pa.property_id IN ? AND a.is_active
+		ORDER BY a.category ASC, a.sort_order ASC, a.id ASC`, ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	byProperty := map[uint][]models.Amenity{}
+	for _, row := range rows {
+		byProperty[row.PropertyID] = append(byProperty[row.PropertyID], row.Amenity)
+	}
+	for i := range properties {
+		properties[i].AmenityDetails = byProperty[properties[i].ID]
+	}
+	return nil
+}
+
+// SetPropertyAmenityIDs links a property to the catalog amenities of amenityIDs, unknown ones
+// left out, and rewrites its Property.Amenities list with their keys so both agree
+func SetPropertyAmenityIDs(db *gorm.DB, propertyID uint, amenityIDs []int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var amenities []models.Amenity
+		if len(amenityIDs) > 0 {
+			if err := tx.Where("id IN ?", amenityIDs).Order("category ASC, sort_order ASC").Find(&amenities).Error; err != nil {
+				return err
+			}
+		}
+		if err := ReplacePropertyAmenities(tx, propertyID, amenities); err != nil {
+			return err
+		}
+		return tx.Model(&models.Property{}).Where("id = ?", propertyID).Update("amenities", AmenityList(amenities)).Error
+	})
+}
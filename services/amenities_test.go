@@ -0,0 +1,42 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"reflect"
+	"testing"
+)
+
+func TestMatchAmenities(t *testing.T) {
+	catalog := []models.Amenity{
+		{ID: 1, Key: "wifi", Name: models.AmenityNames{En: "WiFi", Fr: "WiFi", Ar: "واي فاي"}},
+		{ID: 2, Key: "air_conditioning", Name: models.AmenityNames{En: "Air Conditioning", Fr: "Climatisation", Ar: "تكييف هواء"}},
+		{ID: 9, Key: "kitchen", Name: models.AmenityNames{En: "Kitchen", Fr: "Cuisine", Ar: "مطبخ"}},
+	}
+
+	// Ids, keys and names in any language, each amenity once; unknown values are left out
+	values := []string{"9", " Air Conditioning ", "climatisation", "WIFI", "واي فاي", "jacuzzi", "42"}
+	amenities := matchAmenities(catalog, values)
+	ids := []int{}
+	for _, amenity := range amenities {
+		ids = append(ids, amenity.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{9, 2, 1}) {
+		t.Fatalf("expected [9 2 1], got %v", ids)
+	}
+	if list := AmenityList(amenities); list != `["kitchen","air_conditioning","wifi"]` {
+		t.Fatalf("expected the keys as the list, got %s", list)
+	}
+	if amenities := matchAmenities(catalog, nil); len(amenities) != 0 {
+		t.Fatalf("expected no amenities, got %v", amenities)
+	}
+}
+
+func TestAmenityKeys(t *testing.T) {
+	keys := AmenityKeys("wifi, Air Conditioning,,air_conditioning ,Free-Parking")
+	if !reflect.DeepEqual(keys, []string{"wifi", "air_conditioning", "free_parking"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := AmenityKeys(""); len(keys) != 0 {
+		t.Fatalf("expected no keys, got %v", keys)
+	}
+}
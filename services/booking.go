@@ -0,0 +1,117 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDatesUnavailable is returned when a stay overlaps another reservation, a block or a closed night
+var ErrDatesUnavailable = errors.New("selected dates are not available")
+
+// HoldingReservationStatuses are the reservation statuses that keep nights off the calendar.
+// Pending requests only hold their nights until ExpiresAt.
+var HoldingReservationStatuses = []string{"pending", "confirmed"}
+
+// AvailabilityConflict summarises everything that prevents a stay from being booked
+type AvailabilityConflict struct {
+	Reservations int64 `json:"conflicts"`
+	Blocks       int64 `json:"blocks"`
+	BlockedDays  int64 `json:"blocked"`
+}
+
+// Any reports whether at least one conflict was found
+func (c AvailabilityConflict) Any() bool {
+	return c.Reservations > 0 || c.Blocks > 0 || c.BlockedDays > 0
+}
+
+// DayStart truncates t to midnight in its own location, matching how availability dates are stored
+func DayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// LockPropertyForBooking takes a row lock on the property so that concurrent bookings
+// for the same listing are serialised until the surrounding transaction ends.
+func LockPropertyForBooking(tx *gorm.DB, propertyID uint) (*models.Property, error) {
+	var property models.Property
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&property, propertyID).Error; err != nil {
+		return nil, err
+	}
+	return &property, nil
+}
+
+// CheckStayAvailability looks for anything occupying [checkIn, checkOut) on the property:
+// pending (not yet expired) and confirmed reservations, host blocks and nights closed by an
+// availability rule, counted in a single query.
+// excludeReservationID lets a reservation being confirmed or changed ignore itself.
+func CheckStayAvailability(db *gorm.DB, propertyID uint, checkIn, checkOut time.Time, excludeReservationID uint) (AvailabilityConflict, error) {
+	var conflict AvailabilityConflict
+
+	// Block end dates are inclusive (see BlockPropertyDates); rule end dates are exclusive
+	err := db.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM reservations
+				WHERE property_id = ? AND deleted_at IS NULL AND check_in < ? AND check_out > ? AND id <> ?
+				AND (status = ? OR (status = ? AND expires_at > ?))) AS reservations,
+			(SELECT COUNT(*) FROM property_blocks
+				WHERE property_id = ? AND deleted_at IS NULL AND start_date < ? AND end_date >= ?) AS blocks,
+			(SELECT COALESCE(SUM(LEAST(end_date, ?::date) - GREATEST(start_date, ?::date)), 0) FROM availability_rules
+				WHERE property_id = ? AND deleted_at IS NULL AND is_available = false AND start_date < ? AND end_date > ?) AS blocked_days`,
+		propertyID, checkOut, checkIn, excludeReservationID, ReservationConfirmed, ReservationPending, time.Now(),
+		propertyID, checkOut, DayStart(checkIn),
+		dateKey(checkOut), dateKey(checkIn), propertyID, dateKey(checkOut), dateKey(checkIn)).
+		Scan(&conflict).Error
+	return conflict, err
+}
+
+// WhereAvailableForStay narrows a query on properties to those CheckStayAvailability would let
+// book [checkIn, checkOut) and whose capacity fits guests. The checks are NOT EXISTS subqueries
+// on the indexed property_id columns, so a map search filters every listing in one query.
+func WhereAvailableForStay(q *gorm.DB, checkIn, checkOut time.Time, guests int) *gorm.DB {
+	return q.
+		Where("(properties.capacity = 0 OR properties.capacity >= ?)", guests).
+		Where(`NOT EXISTS (SELECT 1 FROM reservations r
+			WHERE r.property_id = properties.id AND r.deleted_at IS NULL AND r.check_in < ? AND r.check_out > ?
+			AND (r.status = ? OR (r.status = ? AND r.expires_at > ?)))`,
+			checkOut, checkIn, ReservationConfirmed, ReservationPending, time.Now()).
+		Where(`NOT EXISTS (SELECT 1 FROM property_blocks b
+			WHERE b.property_id = properties.id AND b.deleted_at IS NULL AND b.start_date < ? AND b.end_date >= ?)`,
+			checkOut, DayStart(checkIn)).
+		Where(`NOT EXISTS (SELECT 1 FROM availability_rules a
+			WHERE a.property_id = properties.id AND a.deleted_at IS NULL AND a.is_available = false
+			AND a.start_date < ? AND a.end_date > ?)`,
+			dateKey(checkOut), dateKey(checkIn))
+}
+
+// ReserveStay runs fn inside a transaction that holds the property lock, after verifying
+// that [checkIn, checkOut) is free. It returns ErrDatesUnavailable (with the conflict
+// details) when another stay, block or closed night is in the way.
+func ReserveStay(db *gorm.DB, propertyID uint, checkIn, checkOut time.Time, excludeReservationID uint, fn func(tx *gorm.DB, property *models.Property) error) (AvailabilityConflict, error) {
+	var conflict AvailabilityConflict
+	err := payments.Transaction(db, func(tx *gorm.DB) error {
+		property, err := LockPropertyForBooking(tx, propertyID)
+		if err != nil {
+			return err
+		}
+
+		conflict, err = CheckStayAvailability(tx, propertyID, checkIn, checkOut, excludeReservationID)
+		if err != nil {
+			return err
+		}
+		if conflict.Any() {
+			return ErrDatesUnavailable
+		}
+
+		return fn(tx, property)
+	})
+	return conflict, err
+}
+
+// dateKey formats the calendar day of t for comparisons with date columns
+func dateKey(t time.Time) string {
+	return CalendarDate(t).Format(calendarDateLayout)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+
+	"gorm.io/gorm"
+)
+
+// Booking modes of a property
+const (
+	BookingModeInstant = "instant"
+	BookingModeRequest = "request"
+	BookingModeHybrid  = "hybrid"
+)
+
+// InstantBookCriteria are what a guest must meet to book a hybrid property instantly.
+// Zero values don't restrict.
+type InstantBookCriteria struct {
+	RequireVerified   bool `json:"requireVerified"`
+	MinCompletedStays int  `json:"minCompletedStays"`
+	MaxNights         int  `json:"maxNights"`
+}
+
+// BookingDecision is the mode applied to one booking and, for requests on a hybrid
+// property, the criteria the guest didn't meet (guest_not_verified,
+// not_enough_completed_stays, too_many_nights)
+type BookingDecision struct {
+	Mode    string   `json:"mode"` // instant or request
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Instant reports whether the booking is confirmed without the host
+func (d BookingDecision) Instant() bool {
+	return d.Mode == BookingModeInstant
+}
+
+// CriteriaFor returns the hybrid instant-book criteria set on a property
+func CriteriaFor(property *models.Property) InstantBookCriteria {
+	return InstantBookCriteria{
+		RequireVerified:   property.InstantBookRequireVerified,
+		MinCompletedStays: property.InstantBookMinCompletedStays,
+		MaxNights:         property.InstantBookMaxNights,
+	}
+}
+
+// DecideBookingMode applies the property's booking mode to a guest's stay. Unknown
+// modes are treated as requests so the host always stays in control.
+func DecideBookingMode(db *gorm.DB, property *models.Property, guestID uint, nights int) (BookingDecision, error) {
+	switch property.BookingMode {
+	case BookingModeInstant:
+		return BookingDecision{Mode: BookingModeInstant}, nil
+	case BookingModeHybrid:
+	default:
+		return BookingDecision{Mode: BookingModeRequest}, nil
+	}
+
+	criteria := CriteriaFor(property)
+	var reasons []string
+
+	if criteria.RequireVerified {
+		var guest models.User
+		if err := db.Select("id, is_verified, verification_status").First(&guest, guestID).Error; err != nil {
+			return BookingDecision{}, err
+		}
+		if guest.IsVerified == nil || !*guest.IsVerified {
+			reasons = append(reasons, "guest_not_verified")
+		}
+	}
+
+	if criteria.MinCompletedStays > 0 {
+		var completed int64
+		if err := db.Model(&models.Reservation{}).Where("guest_id = ? AND status = ?", guestID, "completed").Count(&completed).Error; err != nil {
+			return BookingDecision{}, err
+		}
+		if completed < int64(criteria.MinCompletedStays) {
+			reasons = append(reasons, "not_enough_completed_stays")
+		}
+	}
+
+	if criteria.MaxNights > 0 && nights > criteria.MaxNights {
+		reasons = append(reasons, "too_many_nights")
+	}
+
+	if len(reasons) > 0 {
+		return BookingDecision{Mode: BookingModeRequest, Reasons: reasons}, nil
+	}
+	return BookingDecision{Mode: BookingModeInstant}, nil
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Booking rule violation codes, stable so the app can translate them
+const (
+	RuleInvalidGuests = "invalid_guests"
+	RuleMaxGuests     = "max_guests"
+	RuleMaxChildren   = "max_children"
+	RuleMaxInfants    = "max_infants"
+	RuleMinStay       = "min_stay"
+	RuleMaxStay       = "max_stay"
+	RuleCheckInDay    = "check_in_day"
+	RuleAdvanceNotice = "advance_notice"
+	RuleBookingWindow = "booking_window"
+)
+
+var weekdayKeys = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// BookingRules are the limits a stay must respect. Zero values mean "no limit",
+// except MinStay which is at least one night. The child and infant limits come from
+// the property's pricing: nil means no limit of their own, 0 that they aren't accepted.
+type BookingRules struct {
+	MaxGuests          int            `json:"maxGuests"`
+	MaxChildren        *int           `json:"maxChildren"`
+	MaxInfants         *int           `json:"maxInfants"`
+	MinStay            int            `json:"minStay"`
+	MaxStay            int            `json:"maxStay"`
+	CheckInDays        []time.Weekday `json:"checkInDays"`
+	AdvanceNoticeHours int            `json:"advanceNoticeHours"`
+	BookingWindowDays  int            `json:"bookingWindowDays"`
+}
+
+// RuleViolation explains one rule the stay breaks; Limit is the value the rule allows
+type RuleViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// Party is who is coming on a stay: Guests counts adults and children, infants come on top
+type Party struct {
+	Guests   int `json:"guests"`
+	Children int `json:"children"`
+	Infants  int `json:"infants"`
+}
+
+// ParseCheckInDays reads a comma-separated list of weekday keys ("fri,sat")
+func ParseCheckInDays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		found := false
+		for i, key := range weekdayKeys {
+			if strings.HasPrefix(part, key) {
+				days = append(days, time.Weekday(i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown weekday %q", part)
+		}
+	}
+	return days, nil
+}
+
+// FormatCheckInDays is the inverse of ParseCheckInDays
+func FormatCheckInDays(days []time.Weekday) string {
+	keys := make([]string, 0, len(days))
+	for _, d := range days {
+		keys = append(keys, weekdayKeys[d])
+	}
+	return strings.Join(keys, ",")
+}
+
+// PropertyBookingRules returns the rules set on a property and its pricing
+func PropertyBookingRules(db *gorm.DB, property *models.Property) (BookingRules, error) {
+	var pricing models.PropertyPricing
+	err := db.Select("id, max_children, max_infants").Where("property_id = ?", property.ID).First(&pricing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return StayBookingRules(property, nil, nil, time.Time{}), err
+	}
+	return StayBookingRules(property, &pricing, nil, time.Time{}), nil
+}
+
+// LoadBookingRules builds the rules for a stay starting on checkIn: the property's settings,
+// with min/max stay overridden by the availability rule covering the check-in night when it sets them
+func LoadBookingRules(db *gorm.DB, property *models.Property, checkIn time.Time) (BookingRules, error) {
+	rules, err := PropertyBookingRules(db, property)
+	if err != nil {
+		return rules, err
+	}
+
+	var day models.AvailabilityRule
+	err = db.Where("property_id = ? AND start_date <= ? AND end_date > ?", property.ID, dateKey(checkIn), dateKey(checkIn)).
+		First(&day).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return rules, err
+	}
+	if err == nil {
+		rules.applyAvailability(&day)
+	}
+	return rules, nil
+}
+
+// StayBookingRules is LoadBookingRules from data already loaded, for pricing many properties at
+// once: pricing may be nil, availability holds the property's rules around checkIn
+func StayBookingRules(property *models.Property, pricing *models.PropertyPricing, availability []models.AvailabilityRule, checkIn time.Time) BookingRules {
+	rules := BookingRules{
+		MaxGuests:          property.Capacity,
+		MinStay:            property.MinStay,
+		MaxStay:            property.MaxStay,
+		AdvanceNoticeHours: property.AdvanceNoticeHours,
+		BookingWindowDays:  property.BookingWindowDays,
+	}
+	rules.CheckInDays, _ = ParseCheckInDays(property.CheckInDays)
+	if pricing != nil {
+		rules.MaxChildren = pricing.MaxChildren
+		rules.MaxInfants = pricing.MaxInfants
+	}
+	if day := RuleFor(availability, checkIn); day != nil {
+		rules.applyAvailability(day)
+	}
+	return rules
+}
+
+// applyAvailability lets the availability rule of the check-in night override min/max stay
+func (r *BookingRules) applyAvailability(day *models.AvailabilityRule) {
+	if day.MinStay > 0 {
+		r.MinStay = day.MinStay
+	}
+	if day.MaxStay > 0 {
+		r.MaxStay = day.MaxStay
+	}
+}
+
+// Check returns every rule the stay breaks, or nil when it may be booked
+func (r BookingRules) Check(checkIn, checkOut time.Time, party Party, now time.Time) []RuleViolation {
+	var violations []RuleViolation
+	add := func(code string, limit int, format string, args ...interface{}) {
+		violations = append(violations, RuleViolation{Code: code, Limit: limit, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case party.Guests < 1:
+		add(RuleInvalidGuests, 1, "At least one guest is required")
+	case party.Children < 0 || party.Infants < 0 || party.Children >= party.Guests:
+		add(RuleInvalidGuests, 0, "Children are counted in the guests and at least one adult is required")
+	case r.MaxGuests > 0 && party.Guests > r.MaxGuests:
+		add(RuleMaxGuests, r.MaxGuests, "This place hosts at most %d guests", r.MaxGuests)
+	}
+	if limit := r.MaxChildren; limit != nil && party.Children > *limit {
+		if *limit == 0 {
+			add(RuleMaxChildren, 0, "This place doesn't accept children")
+		} else {
+			add(RuleMaxChildren, *limit, "This place accepts at most %d children", *limit)
+		}
+	}
+	if limit := r.MaxInfants; limit != nil && party.Infants > *limit {
+		if *limit == 0 {
+			add(RuleMaxInfants, 0, "This place doesn't accept infants")
+		} else {
+			add(RuleMaxInfants, *limit, "This place accepts at most %d infants", *limit)
+		}
+	}
+
+	nights := int(DayStart(checkOut).Sub(DayStart(checkIn)).Hours()/24 + 0.5)
+	if r.MinStay > 1 && nights < r.MinStay {
+		add(RuleMinStay, r.MinStay, "Stays starting on this date require at least %d nights", r.MinStay)
+	}
+	if r.MaxStay > 0 && nights > r.MaxStay {
+		add(RuleMaxStay, r.MaxStay, "Stays starting on this date are limited to %d nights", r.MaxStay)
+	}
+
+	if len(r.CheckInDays) > 0 {
+		allowed := false
+		for _, d := range r.CheckInDays {
+			if checkIn.Weekday() == d {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			add(RuleCheckInDay, 0, "Check-in is only possible on %s", FormatCheckInDays(r.CheckInDays))
+		}
+	}
+
+	if r.AdvanceNoticeHours > 0 && checkIn.Sub(now) < time.Duration(r.AdvanceNoticeHours)*time.Hour {
+		add(RuleAdvanceNotice, r.AdvanceNoticeHours, "This place must be booked at least %d hours before check-in", r.AdvanceNoticeHours)
+	}
+	if r.BookingWindowDays > 0 && DayStart(checkIn).After(DayStart(now).AddDate(0, 0, r.BookingWindowDays)) {
+		add(RuleBookingWindow, r.BookingWindowDays, "This place can only be booked up to %d days ahead", r.BookingWindowDays)
+	}
+
+	return violations
+}
+
+// WhereBookingRulesAllow narrows a query on properties to those whose booking rules let a stay
+// start on checkIn and end on checkOut, as Check would decide at now: minimum and maximum stay,
+// with the availability rule of the check-in night overriding them, check-in days, advance
+// notice and booking window. Party limits are left to WhereAvailableForStay.
+func WhereBookingRulesAllow(q *gorm.DB, checkIn, checkOut, now time.Time) *gorm.DB {
+	nights := int(DayStart(checkOut).Sub(DayStart(checkIn)).Hours()/24 + 0.5)
+	daysAhead := int(DayStart(checkIn).Sub(DayStart(now)).Hours()/24 + 0.5)
+	day := dateKey(checkIn)
+	checkInNight := func(column string) string {
+		return `COALESCE(NULLIF((SELECT a.` + column + ` FROM availability_rules a
+			WHERE a.property_id = properties.id AND a.deleted_at IS NULL AND a.start_date <= ? AND a.end_date > ?
+			ORDER BY a.start_date ASC, a.id ASC LIMIT 1), 0), properties.` + column + `, 0)`
+	}
+	return q.
+		Where(checkInNight("min_stay")+" <= ?", day, day, nights).
+		Where("("+checkInNight("max_stay")+" = 0 OR "+checkInNight("max_stay")+" >= ?)", day, day, day, day, nights).
+		Where(`(BTRIM(COALESCE(properties.check_in_days, ''), ', ') = '' OR EXISTS (
+			SELECT 1 FROM UNNEST(STRING_TO_ARRAY(properties.check_in_days, ',')) AS d WHERE LOWER(BTRIM(d)) LIKE ?))`,
+			weekdayKeys[checkIn.Weekday()]+"%").
+		Where("(COALESCE(properties.advance_notice_hours, 0) <= 0 OR properties.advance_notice_hours <= ?)", checkIn.Sub(now).Hours()).
+		Where("(COALESCE(properties.booking_window_days, 0) <= 0 OR properties.booking_window_days >= ?)", daysAhead)
+}
+
+// CheckBookingRules loads the property's rules for checkIn and checks the stay against them
+func CheckBookingRules(db *gorm.DB, property *models.Property, checkIn, checkOut time.Time, party Party) ([]RuleViolation, error) {
+	rules, err := LoadBookingRules(db, property, checkIn)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Check(checkIn, checkOut, party, time.Now()), nil
+}
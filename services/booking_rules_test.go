@@ -0,0 +1,88 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"testing"
+	"time"
+)
+
+func violationCodes(violations []RuleViolation) map[string]bool {
+	codes := map[string]bool{}
+	for _, v := range violations {
+		codes[v.Code] = true
+	}
+	return codes
+}
+
+func TestBookingRulesCheck(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	friday := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	rules := BookingRules{
+		MaxGuests:          2,
+		MinStay:            3,
+		MaxStay:            14,
+		CheckInDays:        []time.Weekday{time.Friday, time.Saturday},
+		AdvanceNoticeHours: 48,
+		BookingWindowDays:  90,
+	}
+
+	if v := rules.Check(friday, friday.AddDate(0, 0, 3), Party{Guests: 2}, now); len(v) != 0 {
+		t.Fatalf("expected a valid stay, got %+v", v)
+	}
+
+	// One night on a Monday for ten guests, booked an hour before check-in
+	monday := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	codes := violationCodes(rules.Check(monday, monday.AddDate(0, 0, 1), Party{Guests: 10}, monday.Add(-time.Hour)))
+	for _, code := range []string{RuleMaxGuests, RuleMinStay, RuleCheckInDay, RuleAdvanceNotice} {
+		if !codes[code] {
+			t.Fatalf("expected %s violation, got %v", code, codes)
+		}
+	}
+
+	far := friday.AddDate(0, 0, 7*20)
+	codes = violationCodes(rules.Check(far, far.AddDate(0, 0, 20), Party{Guests: 1}, now))
+	if !codes[RuleMaxStay] || !codes[RuleBookingWindow] {
+		t.Fatalf("expected max_stay and booking_window violations, got %v", codes)
+	}
+
+	// No children, one infant at most
+	none, one := 0, 1
+	rules.MaxChildren, rules.MaxInfants = &none, &one
+	codes = violationCodes(rules.Check(friday, friday.AddDate(0, 0, 3), Party{Guests: 2, Children: 1, Infants: 2}, now))
+	if !codes[RuleMaxChildren] || !codes[RuleMaxInfants] || codes[RuleMaxGuests] {
+		t.Fatalf("expected max_children and max_infants violations, got %v", codes)
+	}
+	if v := rules.Check(friday, friday.AddDate(0, 0, 3), Party{Guests: 2, Infants: 1}, now); len(v) != 0 {
+		t.Fatalf("infants don't count towards the guests, got %+v", v)
+	}
+}
+
+func TestParseCheckInDays(t *testing.T) {
+	days, err := ParseCheckInDays(" Friday, sat ,")
+	if err != nil || len(days) != 2 || days[0] != time.Friday || days[1] != time.Saturday {
+		t.Fatalf("unexpected days %v (%v)", days, err)
+	}
+	if FormatCheckInDays(days) != "fri,sat" {
+		t.Fatalf("unexpected format %q", FormatCheckInDays(days))
+	}
+	if _, err := ParseCheckInDays("funday"); err == nil {
+		t.Fatal("expected unknown weekday to be rejected")
+	}
+}
+
+func TestStayBookingRulesUseCheckInNight(t *testing.T) {
+	two := 2
+	property := &models.Property{Capacity: 4, MinStay: 2, CheckInDays: "fri"}
+	pricing := &models.PropertyPricing{MaxChildren: &two}
+	day := func(d int) time.Time { return time.Date(2025, 8, d, 0, 0, 0, 0, time.UTC) }
+	availability := []models.AvailabilityRule{{StartDate: day(1), EndDate: day(10), IsAvailable: true, MinStay: 5}}
+
+	rules := StayBookingRules(property, pricing, availability, day(8))
+	if rules.MaxGuests != 4 || rules.MinStay != 5 || rules.MaxChildren == nil || *rules.MaxChildren != 2 || len(rules.CheckInDays) != 1 {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	// Checking in after the range keeps the property's own minimum stay
+	if rules := StayBookingRules(property, nil, availability, day(10)); rules.MinStay != 2 || rules.MaxChildren != nil {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+// ErrEmptyAvailabilityRange is returned for a range that doesn't cover a night
+var ErrEmptyAvailabilityRange = errors.New("availability range must cover at least one night")
+
+// Night statuses on a resolved calendar, from the strongest
+const (
+	NightBooked    = "booked"    // a confirmed reservation
+	NightPending   = "pending"   // a request that still holds the night
+	NightBlocked   = "blocked"   // a host block or an imported calendar event
+	NightClosed    = "closed"    // an availability rule closes it
+	NightAvailable = "available" // bookable
+)
+
+// CalendarNight is the effective state of one night. Zero stay rules and empty times
+// mean the property's own settings apply; a zero price means its standard rate.
+type CalendarNight struct {
+	PropertyID   uint      `json:"propertyID"`
+	Date         time.Time `json:"date"`
+	IsAvailable  bool      `json:"isAvailable"`
+	Status       string    `json:"status"`
+	Price        float64   `json:"price"`
+	MinStay      int       `json:"minStay"`
+	MaxStay      int       `json:"maxStay"`
+	CheckInTime  string    `json:"checkInTime"`
+	CheckOutTime string    `json:"checkOutTime"`
+	Notes        string    `json:"notes"`
+	RuleID       *uint     `json:"ruleID,omitempty"`
+}
+
+// calendarOccupancy is a reservation or block overlapping the resolved range
+type calendarOccupancy struct {
+	Kind    string // "reservation" or "block"
+	Status  string
+	Reason  string
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// CalendarDate is the calendar day of t as a UTC midnight, the form availability rules use
+func CalendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LoadAvailabilityRules returns the rules of a property touching the nights [from, to)
+func LoadAvailabilityRules(db *gorm.DB, propertyID uint, from, to time.Time) ([]models.AvailabilityRule, error) {
+	var rules []models.AvailabilityRule
+	err := db.Where("property_id = ? AND start_date < ? AND end_date > ?",
+		propertyID, dateKey(to), dateKey(from)).
+		Order("start_date ASC").Find(&rules).Error
+	return rules, err
+}
+
+// RuleFor returns the rule covering night, nil when none does
+func RuleFor(rules []models.AvailabilityRule, night time.Time) *models.AvailabilityRule {
+	day := CalendarDate(night)
+	for i := range rules {
+		if !day.Before(CalendarDate(rules[i].StartDate)) && day.Before(CalendarDate(rules[i].EndDate)) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// ResolveCalendar returns one entry per night of [from, to) for a property, with its
+// availability rule and the reservations and blocks occupying it, in two queries
+func ResolveCalendar(db *gorm.DB, propertyID uint, from, to time.Time) ([]CalendarNight, error) {
+	rules, err := LoadAvailabilityRules(db, propertyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Block end dates are inclusive (see BlockPropertyDates)
+	var occupancy []calendarOccupancy
+	if err := db.Raw(`
+		SELECT 'reservation' AS kind, status, '' AS reason, check_in AS start_at, check_out AS end_at
+		FROM reservations
+		WHERE property_id = ? AND deleted_at IS NULL AND check_in < ? AND check_out > ?
+			AND (status = ? OR (status = ? AND expires_at > ?))
+		UNION ALL
+		SELECT 'block', '', reason, start_date, end_date + interval '1 day'
+		FROM property_blocks
+		WHERE property_id = ? AND deleted_at IS NULL AND start_date < ? AND end_date >= ?`,
+		propertyID, to, from, ReservationConfirmed, ReservationPending, time.Now(),
+		propertyID, to, DayStart(from)).
+		Scan(&occupancy).Error; err != nil {
+		return nil, err
+	}
+
+	return resolveNights(propertyID, from, to, rules, occupancy), nil
+}
+
+// resolveNights lays rules and occupancy over the nights of [from, to)
+func resolveNights(propertyID uint, from, to time.Time, rules []models.AvailabilityRule, occupancy []calendarOccupancy) []CalendarNight {
+	var nights []CalendarNight
+	for day := CalendarDate(from); day.Before(CalendarDate(to)); day = day.AddDate(0, 0, 1) {
+		night := CalendarNight{PropertyID: propertyID, Date: day, Status: NightAvailable}
+		if rule := RuleFor(rules, day); rule != nil {
+			id := rule.ID
+			night.RuleID = &id
+			night.Price = rule.Price
+			night.MinStay = rule.MinStay
+			night.MaxStay = rule.MaxStay
+			night.CheckInTime = rule.CheckInTime
+			night.CheckOutTime = rule.CheckOutTime
+			night.Notes = rule.Notes
+			if !rule.IsAvailable {
+				night.Status = NightClosed
+			}
+		}
+
+		for _, o := range occupancy {
+			if day.Before(CalendarDate(o.StartAt)) || !day.Before(CalendarDate(o.EndAt)) {
+				continue
+			}
+			switch {
+			case o.Kind == "reservation" && o.Status == ReservationConfirmed:
+				night.Status = NightBooked
+				night.Notes = "booked"
+			case o.Kind == "reservation" && night.Status != NightBooked:
+				night.Status = NightPending
+			case o.Kind == "block" && night.Status != NightBooked && night.Status != NightPending:
+				night.Status = NightBlocked
+				night.Notes = fmt.Sprintf("Blocked: %s", o.Reason)
+			}
+		}
+
+		night.IsAvailable = night.Status == NightAvailable
+		nights = append(nights, night)
+	}
+	return nights
+}
+
+// SetAvailabilityRange stores rule over [StartDate, EndDate), trimming or splitting the
+// rules of the property it overlaps so that each night keeps a single rule
+func SetAvailabilityRange(tx *gorm.DB, rule *models.AvailabilityRule) error {
+	rule.StartDate = CalendarDate(rule.StartDate)
+	rule.EndDate = CalendarDate(rule.EndDate)
+	if !rule.StartDate.Before(rule.EndDate) {
+		return ErrEmptyAvailabilityRange
+	}
+
+	overlapping, err := LoadAvailabilityRules(tx, rule.PropertyID, rule.StartDate, rule.EndDate)
+	if err != nil {
+		return err
+	}
+	for _, old := range overlapping {
+		start, end := CalendarDate(old.StartDate), CalendarDate(old.EndDate)
+		if start.Before(rule.StartDate) {
+			left := old
+			left.Model = gorm.Model{}
+			left.StartDate, left.EndDate = start, rule.StartDate
+			if err := tx.Create(&left).Error; err != nil {
+				return err
+			}
+		}
+		if end.After(rule.EndDate) {
+			right := old
+			right.Model = gorm.Model{}
+			right.StartDate, right.EndDate = rule.EndDate, end
+			if err := tx.Create(&right).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.AvailabilityRule{}, old.ID).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Create(rule).Error
+}
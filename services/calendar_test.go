@@ -0,0 +1,53 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"testing"
+	"time"
+)
+
+func TestResolveNights(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 7, d, 0, 0, 0, 0, time.UTC) }
+	rules := []models.AvailabilityRule{
+		{StartDate: day(1), EndDate: day(4), IsAvailable: true, Price: 120, MinStay: 2},
+		{StartDate: day(6), EndDate: day(8), IsAvailable: false, Notes: "renovation"},
+	}
+	occupancy := []calendarOccupancy{
+		// Checks out on the 3rd at 11:00: the 3rd itself stays free
+		{Kind: "reservation", Status: ReservationConfirmed, StartAt: day(2).Add(15 * time.Hour), EndAt: day(3).Add(11 * time.Hour)},
+		{Kind: "reservation", Status: ReservationPending, StartAt: day(4), EndAt: day(5)},
+		// Blocks are stored with an inclusive end, resolved with end+1
+		{Kind: "block", Reason: "family", StartAt: day(4), EndAt: day(6)},
+	}
+
+	nights := resolveNights(7, day(1), day(8), rules, occupancy)
+	want := []string{NightAvailable, NightBooked, NightAvailable, NightPending, NightBlocked, NightClosed, NightClosed}
+	if len(nights) != len(want) {
+		t.Fatalf("expected %d nights, got %d", len(want), len(nights))
+	}
+	for i, night := range nights {
+		if night.Status != want[i] || night.IsAvailable != (want[i] == NightAvailable) {
+			t.Errorf("%s: got %s (available %v), want %s", night.Date.Format(calendarDateLayout), night.Status, night.IsAvailable, want[i])
+		}
+	}
+	if n := nights[2]; n.Price != 120 || n.MinStay != 2 || n.RuleID == nil {
+		t.Fatalf("the rule's price and stay rules should apply: %+v", n)
+	}
+	if n := nights[4]; n.Notes != "Blocked: family" || n.RuleID != nil {
+		t.Fatalf("unexpected blocked night %+v", n)
+	}
+}
+
+func TestRuleForUsesCalendarDays(t *testing.T) {
+	rules := []models.AvailabilityRule{
+		{StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	// Late evening of July 1st in a UTC+1 zone is still July 1st
+	night := time.Date(2025, 7, 1, 23, 0, 0, 0, time.FixedZone("GMT+1", 3600))
+	if RuleFor(rules, night) == nil {
+		t.Fatal("expected the July 1st rule")
+	}
+	if RuleFor(rules, night.Add(2*time.Hour)) != nil {
+		t.Fatal("July 2nd is past the rule's end")
+	}
+}
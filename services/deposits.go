@@ -0,0 +1,194 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"apartments-clone-server/payments"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Security deposit statuses
+const (
+	DepositHeld     = "held"
+	DepositClaimed  = "claimed"
+	DepositDisputed = "disputed"
+	DepositSettled  = "settled"
+	DepositReleased = "released"
+)
+
+// DefaultDepositClaimDays is how long after checkout a host may claim, and how long a
+// guest has to dispute a claim, unless DEPOSIT_CLAIM_DAYS overrides it
+const DefaultDepositClaimDays = 7
+
+var (
+	ErrNoDeposit         = errors.New("reservation has no security deposit")
+	ErrDepositState      = errors.New("security deposit is not in a state that allows this action")
+	ErrClaimWindowClosed = errors.New("the claim window is not open")
+	ErrClaimAmount       = errors.New("claim amount must be positive and at most the deposit")
+)
+
+// DepositClaimWindow returns the configured claim (and dispute) window
+func DepositClaimWindow() time.Duration {
+	days := DefaultDepositClaimDays
+	if n, err := strconv.Atoi(os.Getenv("DEPOSIT_CLAIM_DAYS")); err == nil && n > 0 {
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// HoldSecurityDeposit authorizes the deposit when a reservation is confirmed.
+// It does nothing when the stay has no deposit.
+func HoldSecurityDeposit(tx *gorm.DB, reservation *models.Reservation, hostID uint, amount float64) (*models.SecurityDeposit, error) {
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	deposit := models.SecurityDeposit{
+		ReservationID: reservation.ID,
+		PropertyID:    reservation.PropertyID,
+		GuestID:       reservation.GuestID,
+		HostID:        hostID,
+		Amount:        amount,
+		Currency:      reservation.Currency,
+		Status:        DepositHeld,
+		ClaimDeadline: reservation.CheckOut.Add(DepositClaimWindow()),
+	}
+	if err := tx.Create(&deposit).Error; err != nil {
+		return nil, err
+	}
+
+	if _, err := payments.Authorize(tx, payments.Charge{
+		SubjectType: payments.SubjectSecurityDeposit,
+		SubjectID:   deposit.ID,
+		PayerID:     reservation.GuestID,
+		PayeeID:     hostID,
+		Amount:      amount,
+		Currency:    reservation.Currency,
+		Description: "Security deposit",
+	}); err != nil {
+		return nil, err
+	}
+	return &deposit, nil
+}
+
+// LockDeposit loads a deposit for update
+func LockDeposit(tx *gorm.DB, id uint) (*models.SecurityDeposit, error) {
+	var deposit models.SecurityDeposit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&deposit, id).Error; err != nil {
+		return nil, err
+	}
+	return &deposit, nil
+}
+
+// ClaimSecurityDeposit records a host claim; it is only possible between checkout and the claim deadline
+func ClaimSecurityDeposit(tx *gorm.DB, deposit *models.SecurityDeposit, checkOut time.Time, amount float64, reason string, photos []string) error {
+	now := time.Now()
+	if deposit.Status != DepositHeld {
+		return ErrDepositState
+	}
+	if now.Before(checkOut) || now.After(deposit.ClaimDeadline) {
+		return ErrClaimWindowClosed
+	}
+	if amount <= 0 || amount > deposit.Amount {
+		return ErrClaimAmount
+	}
+
+	rawPhotos, _ := json.Marshal(photos)
+	deposit.Status = DepositClaimed
+	deposit.ClaimAmount = amount
+	deposit.ClaimReason = reason
+	deposit.ClaimPhotos = rawPhotos
+	deposit.ClaimedAt = &now
+	return tx.Save(deposit).Error
+}
+
+// DisputeSecurityDeposit lets the guest contest a claim; an admin then decides
+func DisputeSecurityDeposit(tx *gorm.DB, deposit *models.SecurityDeposit, reason string) error {
+	if deposit.Status != DepositClaimed {
+		return ErrDepositState
+	}
+	now := time.Now()
+	deposit.Status = DepositDisputed
+	deposit.DisputeReason = reason
+	deposit.DisputedAt = &now
+	return tx.Save(deposit).Error
+}
+
+// SettleSecurityDeposit pays awarded to the host and releases the rest to the guest.
+// resolvedBy is the admin for disputes, nil when the guest accepted or the dispute window lapsed.
+func SettleSecurityDeposit(tx *gorm.DB, deposit *models.SecurityDeposit, awarded float64, note string, resolvedBy *uint) error {
+	if deposit.Status != DepositClaimed && deposit.Status != DepositDisputed {
+		return ErrDepositState
+	}
+	if awarded < 0 || awarded > deposit.Amount {
+		return ErrClaimAmount
+	}
+
+	intent, err := payments.IntentFor(tx, payments.SubjectSecurityDeposit, deposit.ID)
+	if err != nil && !errors.Is(err, payments.ErrNoPayment) {
+		return err
+	}
+	if intent != nil {
+		if awarded > 0 {
+			err = payments.CaptureAmount(tx, intent, awarded)
+		} else {
+			err = payments.Void(tx, intent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	deposit.Status = DepositSettled
+	deposit.AwardedAmount = awarded
+	deposit.ResolutionNote = note
+	deposit.ResolvedBy = resolvedBy
+	deposit.SettledAt = &now
+	return tx.Save(deposit).Error
+}
+
+// ReleaseSecurityDeposit returns the whole deposit to the guest
+func ReleaseSecurityDeposit(tx *gorm.DB, deposit *models.SecurityDeposit, note string) error {
+	if deposit.Status != DepositHeld {
+		return ErrDepositState
+	}
+
+	intent, err := payments.IntentFor(tx, payments.SubjectSecurityDeposit, deposit.ID)
+	if err != nil && !errors.Is(err, payments.ErrNoPayment) {
+		return err
+	}
+	if intent != nil && intent.Status == payments.StatusAuthorized {
+		if err := payments.Void(tx, intent); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	deposit.Status = DepositReleased
+	deposit.ResolutionNote = note
+	deposit.ReleasedAt = &now
+	return tx.Save(deposit).Error
+}
+
+// ReleaseReservationDeposit releases the deposit of a reservation that won't take place, if it has one
+func ReleaseReservationDeposit(tx *gorm.DB, reservationID uint, note string) error {
+	var deposit models.SecurityDeposit
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reservation_id = ?", reservationID).First(&deposit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if deposit.Status != DepositHeld {
+		return nil
+	}
+	return ReleaseSecurityDeposit(tx, &deposit, note)
+}
@@ -246,6 +246,48 @@ func (ns *NotificationService) SendReservationAcceptanceNotificationToGuest(rese
 	return ns.SendNotificationToUser(guestID, title, body, data)
 }
 
+// SendInstantBookingNotificationToHost sends notification when a guest books instantly (no approval needed)
+func (ns *NotificationService) SendInstantBookingNotificationToHost(reservationID, propertyID, hostID, guestID uint, guestName, propertyTitle string) error {
+	title := "✅ Nouvelle Réservation Confirmée!"
+	body := fmt.Sprintf("%s a réservé %s (réservation instantanée)", guestName, propertyTitle)
+
+	params := fmt.Sprintf(`{"reservationId": %d, "propertyId": %d, "guestId": %d}`, reservationID, propertyID, guestID)
+
+	data := NotificationData{
+		Type:       "reservation_confirmed",
+		ID:         fmt.Sprintf("%d", reservationID),
+		PropertyID: fmt.Sprintf("%d", propertyID),
+		UserID:     fmt.Sprintf("%d", guestID),
+		HostID:     fmt.Sprintf("%d", hostID),
+		Screen:     "HostReservations",
+		Params:     params,
+		Action:     "view_reservation",
+	}
+
+	return ns.SendNotificationToUser(hostID, title, body, data)
+}
+
+// SendBookingConfirmedNotificationToGuest sends notification when an instant booking is confirmed
+func (ns *NotificationService) SendBookingConfirmedNotificationToGuest(reservationID, propertyID, guestID, hostID uint, propertyTitle string) error {
+	title := "🎉 Réservation Confirmée!"
+	body := fmt.Sprintf("Votre réservation pour %s est confirmée", propertyTitle)
+
+	params := fmt.Sprintf(`{"reservationId": %d, "propertyId": %d, "hostId": %d}`, reservationID, propertyID, hostID)
+
+	data := NotificationData{
+		Type:       "reservation_accepted",
+		ID:         fmt.Sprintf("%d", reservationID),
+		PropertyID: fmt.Sprintf("%d", propertyID),
+		UserID:     fmt.Sprintf("%d", guestID),
+		HostID:     fmt.Sprintf("%d", hostID),
+		Screen:     "MyReservations",
+		Params:     params,
+		Action:     "view_reservation",
+	}
+
+	return ns.SendNotificationToUser(guestID, title, body, data)
+}
+
 // SendReservationRejectionNotificationToGuest sends notification when reservation is rejected
 func (ns *NotificationService) SendReservationRejectionNotificationToGuest(reservationID, propertyID, guestID, hostID uint, hostName, propertyTitle string) error {
 	title := "😔 Réservation Refusée"
@@ -305,5 +347,27 @@ func (ns *NotificationService) SendReminderNotificationToGuest(reservationID, pr
 	return ns.SendNotificationToUser(guestID, title, body, data)
 }
 
+// SendWaitlistNotificationToGuest tells a waitlisted guest that the dates they wanted are free
+func (ns *NotificationService) SendWaitlistNotificationToGuest(entryID, propertyID, guestID uint, propertyTitle string, checkIn, checkOut, claimExpiresAt time.Time) error {
+	title := "📅 Dates Disponibles!"
+	body := fmt.Sprintf("%s est disponible du %s au %s. Réservez avant le %s!", propertyTitle,
+		checkIn.Format("02/01"), checkOut.Format("02/01"), claimExpiresAt.Format("02/01 15:04"))
+
+	params := fmt.Sprintf(`{"waitlistId": %d, "propertyId": %d, "checkIn": "%s", "checkOut": "%s"}`,
+		entryID, propertyID, checkIn.Format("2006-01-02"), checkOut.Format("2006-01-02"))
+
+	data := NotificationData{
+		Type:       "waitlist_available",
+		ID:         fmt.Sprintf("%d", entryID),
+		PropertyID: fmt.Sprintf("%d", propertyID),
+		UserID:     fmt.Sprintf("%d", guestID),
+		Screen:     "PropertyDetails",
+		Params:     params,
+		Action:     "book_property",
+	}
+
+	return ns.SendNotificationToUser(guestID, title, body, data)
+}
+
 // Global notification service instance
 var NotificationServiceInstance = NewNotificationService()
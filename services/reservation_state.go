@@ -0,0 +1,118 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Reservation statuses
+const (
+	ReservationPending   = "pending"
+	ReservationConfirmed = "confirmed"
+	ReservationRejected  = "rejected"
+	ReservationCancelled = "cancelled"
+	ReservationExpired   = "expired"
+	ReservationCompleted = "completed"
+)
+
+// Who changes a reservation's status
+const (
+	ActorGuest  = "guest"
+	ActorHost   = "host"
+	ActorAdmin  = "admin"
+	ActorSystem = "system" // scheduled jobs and automatic decisions such as instant booking
+)
+
+var (
+	ErrInvalidTransition = errors.New("reservation status change not allowed")
+	// ErrStatusChanged means another request changed the status first
+	ErrStatusChanged = errors.New("reservation status changed meanwhile")
+)
+
+// Actor is who triggers a transition; UserID is 0 for the system
+type Actor struct {
+	Role   string
+	UserID uint
+}
+
+// SystemActor is the actor of automatic transitions
+var SystemActor = Actor{Role: ActorSystem}
+
+// reservationTransitions lists, for each status, the statuses it can move to and who may
+// move it there. Statuses without an entry are final.
+var reservationTransitions = map[string]map[string][]string{
+	ReservationPending: {
+		ReservationConfirmed: {ActorHost, ActorAdmin, ActorSystem},
+		ReservationRejected:  {ActorHost, ActorAdmin},
+		ReservationCancelled: {ActorGuest, ActorHost, ActorAdmin},
+		ReservationExpired:   {ActorSystem},
+	},
+	ReservationConfirmed: {
+		ReservationCancelled: {ActorGuest, ActorHost, ActorAdmin},
+		ReservationCompleted: {ActorSystem, ActorAdmin},
+	},
+}
+
+// CanTransition reports whether actor may move a reservation from one status to another
+func CanTransition(from, to, actor string) bool {
+	for _, allowed := range reservationTransitions[from][to] {
+		if allowed == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStatuses lists the statuses actor may move a reservation to from its current status
+func NextStatuses(from, actor string) []string {
+	var next []string
+	for _, to := range []string{ReservationConfirmed, ReservationRejected, ReservationCancelled, ReservationExpired, ReservationCompleted} {
+		if CanTransition(from, to, actor) {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// TransitionReservation moves a reservation to status to and records it in its history.
+// The update only applies if the stored status is still the one on reservation, so two
+// concurrent changes can't both succeed. Other fields of reservation are not saved.
+func TransitionReservation(tx *gorm.DB, reservation *models.Reservation, to string, actor Actor, reason string) error {
+	from := reservation.Status
+	if !CanTransition(from, to, actor.Role) {
+		return fmt.Errorf("%w: %s -> %s by %s", ErrInvalidTransition, from, to, actor.Role)
+	}
+
+	result := tx.Model(&models.Reservation{}).
+		Where("id = ? AND status = ?", reservation.ID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStatusChanged
+	}
+
+	reservation.Status = to
+	return RecordReservationTransition(tx, reservation.ID, from, to, actor, reason)
+}
+
+// RecordReservationTransition writes a history row; TransitionReservation calls it, and
+// reservation creation records its initial status with it (from empty)
+func RecordReservationTransition(tx *gorm.DB, reservationID uint, from, to string, actor Actor, reason string) error {
+	transition := models.ReservationTransition{
+		ReservationID: reservationID,
+		FromStatus:    from,
+		ToStatus:      to,
+		Actor:         actor.Role,
+		Reason:        reason,
+	}
+	if actor.UserID != 0 {
+		id := actor.UserID
+		transition.ActorID = &id
+	}
+	return tx.Create(&transition).Error
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to, actor string
+		allowed         bool
+	}{
+		{ReservationPending, ReservationConfirmed, ActorHost, true},
+		{ReservationPending, ReservationConfirmed, ActorSystem, true}, // instant booking
+		{ReservationPending, ReservationConfirmed, ActorGuest, false},
+		{ReservationPending, ReservationRejected, ActorHost, true},
+		{ReservationPending, ReservationExpired, ActorSystem, true},
+		{ReservationPending, ReservationExpired, ActorHost, false},
+		{ReservationConfirmed, ReservationCancelled, ActorGuest, true},
+		{ReservationConfirmed, ReservationRejected, ActorHost, false},
+		{ReservationConfirmed, ReservationCompleted, ActorSystem, true},
+		{ReservationConfirmed, ReservationCompleted, ActorGuest, false},
+		{ReservationCancelled, ReservationConfirmed, ActorAdmin, false},
+		{ReservationCompleted, ReservationCancelled, ActorGuest, false},
+		{ReservationExpired, ReservationPending, ActorSystem, false},
+		{ReservationPending, ReservationPending, ActorHost, false},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to, c.actor); got != c.allowed {
+			t.Errorf("%s -> %s by %s: got %v, want %v", c.from, c.to, c.actor, got, c.allowed)
+		}
+	}
+}
+
+func TestNextStatuses(t *testing.T) {
+	if got, want := NextStatuses(ReservationPending, ActorHost), []string{ReservationConfirmed, ReservationRejected, ReservationCancelled}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("host on pending: got %v, want %v", got, want)
+	}
+	if got := NextStatuses(ReservationCancelled, ActorAdmin); len(got) != 0 {
+		t.Fatalf("cancelled is final, got %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPriceBuckets and MaxPriceBuckets bound the nightly price histogram of PropertyFacets
+const (
+	DefaultPriceBuckets = 10
+	MaxPriceBuckets     = 50
+)
+
+// maxBedroomsBucket is the last bedroom bucket, which holds that many bedrooms or more
+const maxBedroomsBucket = 4
+
+// PropertyFacets counts the properties a search finds per value of each filter, so filter
+// screens can show what's available before the user picks anything
+type PropertyFacets struct {
+	Total         int64        `json:"total"`
+	PropertyTypes []FacetCount `json:"propertyTypes"`
+	Categories    []FacetCount `json:"categories"`
+	Amenities     []FacetCount `json:"amenities"`
+	Bedrooms      []FacetCount `json:"bedrooms"` // "0" to "4+"
+	Areas         []FacetCount `json:"areas"`    // location criteria
+	Price         PriceFacet   `json:"price"`
+}
+
+// FacetCount is how many properties have Value; Label names areas, Names categories and amenities
+type FacetCount struct {
+	Value string                `json:"value"`
+	Label string                `json:"label,omitempty"`
+	Names *models.CategoryNames `json:"names,omitempty"`
+	Count int64                 `json:"count"`
+}
+
+// PriceFacet is the range of nightly prices, as stored (what minPrice and maxPrice filter on),
+// split into equal buckets; Min and Max are nil when nothing has a price
+type PriceFacet struct {
+	Min       *float64      `json:"min"`
+	Max       *float64      `json:"max"`
+	Histogram []PriceBucket `json:"histogram"`
+}
+
+// PriceBucket counts the prices from From up to To; the last bucket includes To
+type PriceBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int64   `json:"count"`
+}
+
+// facetRow is one count of the facets query: facet is the kind, key the value counted, label
+// an area's name or an amenity's names as JSON
+type facetRow struct {
+	Facet string
+	Key   string
+	Label string
+	Count int64
+	Value float64
+}
+
+// LoadPropertyFacets computes the facets of matches, a properties query with the search's
+// filters, in a single query; category names are read in a second one
+func LoadPropertyFacets(db *gorm.DB, matches *gorm.DB, buckets int) (*PropertyFacets, error) {
+	if buckets < 1 || buckets > MaxPriceBuckets {
+		buckets = DefaultPriceBuckets
+	}
+	matches = matches.Select("properties.id, properties.property_type, properties.property_category_id, " +
+		"properties.bedrooms, properties.nightly_price")
+
+	var rows []facetRow
+	if err := db.Raw(`WITH matches AS (?),
+		bounds AS (SELECT MIN(nightly_price)::float8 AS low, MAX(nightly_price)::float8 AS high FROM matches)
+		SELECT 'total' AS facet, '' AS key, '' AS label, COUNT(*) AS count, 0::float8 AS value FROM matches
+		UNION ALL
+		SELECT 'type', COALESCE(property_type, ''), '', COUNT(*), 0 FROM matches GROUP BY property_type
+		UNION ALL
+		SELECT 'category', property_category_id::text, '', COUNT(*), 0 FROM matches
+			WHERE property_category_id IS NOT NULL GROUP BY property_category_id
+		UNION ALL
+		SELECT 'amenity', COALESCE(a.key, a.id::text), a.name::text, COUNT(*), 0 FROM matches m
+			JOIN property_amenities pa ON pa.property_id = m.id
+			JOIN amenities a ON a.id = pa.amenity_id AND a.is_active
+			GROUP BY a.id
+		UNION ALL
+		SELECT 'bedrooms', LEAST(GREATEST(COALESCE(bedrooms, 0), 0), ?)::text, '', COUNT(*), 0 FROM matches GROUP BY 2
+		UNION ALL
+		SELECT 'area', lc.id::text, MAX(lc.name), COUNT(DISTINCT m.id), 0 FROM matches m
+			JOIN location_criteria_properties lcp ON lcp.property_id = m.id AND lcp.is_active AND lcp.deleted_at IS NULL
+			JOIN location_criteria lc ON lc.id = lcp.location_criteria_id AND lc.is_active AND lc.deleted_at IS NULL
+			GROUP BY lc.id
+		UNION ALL
+		SELECT 'price_min', '', '', 0, low FROM bounds WHERE low IS NOT NULL
+		UNION ALL
+		SELECT 'price_max', '', '', 0, high FROM bounds WHERE high IS NOT NULL
+		UNION ALL
+		SELECT 'price', (CASE WHEN b.high > b.low THEN LEAST(width_bucket(m.nightly_price, b.low, b.high, ?), ?) ELSE 1 END)::text,
+			'', COUNT(*), 0
+			FROM matches m CROSS JOIN bounds b WHERE m.nightly_price IS NOT NULL GROUP BY 2`,
+		matches, maxBedroomsBucket, buckets, buckets).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	facets := assembleFacets(rows, buckets)
+
+	// Names are a nicety: the categories table comes from a SQL migration and may be missing
+	if len(facets.Categories) > 0 {
+		var ids []int
+		for _, c := range facets.Categories {
+			if id, err := strconv.Atoi(c.Value); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		var categories []models.Category
+		if err := db.Where("id IN ?", ids).Find(&categories).Error; err == nil {
+			names := map[string]models.CategoryNames{}
+			for _, c := range categories {
+				names[strconv.Itoa(c.ID)] = c.Name
+			}
+			for i, c := range facets.Categories {
+				if name, ok := names[c.Value]; ok {
+					facets.Categories[i].Names = &name
+				}
+			}
+		}
+	}
+	return facets, nil
+}
+
+// assembleFacets turns the rows of the facets query into PropertyFacets: counts sorted from
+// the most common, every bedroom bucket, and the price histogram with the bounds of each bucket
+func assembleFacets(rows []facetRow, buckets int) *PropertyFacets {
+	facets := &PropertyFacets{
+		PropertyTypes: []FacetCount{},
+		Categories:    []FacetCount{},
+		Amenities:     []FacetCount{},
+		Bedrooms:      make([]FacetCount, maxBedroomsBucket+1),
+		Areas:         []FacetCount{},
+		Price:         PriceFacet{Histogram: []PriceBucket{}},
+	}
+	for i := range facets.Bedrooms {
+		facets.Bedrooms[i].Value = strconv.Itoa(i)
+	}
+	facets.Bedrooms[maxBedroomsBucket].Value += "+"
+
+	priceCounts := map[int]int64{}
+	for _, row := range rows {
+		count := FacetCount{Value: row.Key, Count: row.Count}
+		switch row.Facet {
+		case "total":
+			facets.Total = row.Count
+		case "type":
+			facets.PropertyTypes = append(facets.PropertyTypes, count)
+		case "category":
+			facets.Categories = append(facets.Categories, count)
+		case "amenity":
+			var names models.CategoryNames
+			if json.Unmarshal([]byte(row.Label), &names) == nil {
+				count.Names = &names
+			}
+			facets.Amenities = append(facets.Amenities, count)
+		case "bedrooms":
+			if n, err := strconv.Atoi(row.Key); err == nil && n >= 0 && n <= maxBedroomsBucket {
+				facets.Bedrooms[n].Count = row.Count
+			}
+		case "area":
+			count.Label = row.Label
+			facets.Areas = append(facets.Areas, count)
+		case "price_min":
+			value := row.Value
+			facets.Price.Min = &value
+		case "price_max":
+			value := row.Value
+			facets.Price.Max = &value
+		case "price":
+			if n, err := strconv.Atoi(row.Key); err == nil {
+				priceCounts[n] += row.Count
+			}
+		}
+	}
+	for _, list := range [][]FacetCount{facets.PropertyTypes, facets.Categories, facets.Amenities, facets.Areas} {
+		sortFacetCounts(list)
+	}
+
+	if facets.Price.Min != nil && facets.Price.Max != nil {
+		low, high := *facets.Price.Min, *facets.Price.Max
+		if high <= low {
+			// A single price: one bucket
+			buckets = 1
+		}
+		width := (high - low) / float64(buckets)
+		for i := 1; i <= buckets; i++ {
+			bucket := PriceBucket{From: roundPrice(low + float64(i-1)*width), To: roundPrice(low + float64(i)*width), Count: priceCounts[i]}
+			if i == buckets {
+				bucket.To = roundPrice(high)
+			}
+			facets.Price.Histogram = append(facets.Price.Histogram, bucket)
+		}
+	}
+	return facets
+}
+
+func sortFacetCounts(counts []FacetCount) {
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
@@ -0,0 +1,64 @@
+package services
+
+import "testing"
+
+func TestAssembleFacets(t *testing.T) {
+	rows := []facetRow{
+		{Facet: "total", Count: 6},
+		{Facet: "type", Key: "house", Count: 2},
+		{Facet: "type", Key: "apartment", Count: 4},
+		{Facet: "amenity", Key: "wifi", Label: `{"en":"WiFi","fr":"WiFi","ar":"واي فاي"}`, Count: 3},
+		{Facet: "amenity", Key: "ac", Count: 3},
+		{Facet: "bedrooms", Key: "1", Count: 4},
+		{Facet: "bedrooms", Key: "4", Count: 2},
+		{Facet: "area", Key: "7", Label: "Tevragh Zeina", Count: 5},
+		{Facet: "price_min", Value: 40},
+		{Facet: "price_max", Value: 100},
+		{Facet: "price", Key: "1", Count: 3},
+		{Facet: "price", Key: "3", Count: 3},
+	}
+	facets := assembleFacets(rows, 3)
+
+	if facets.Total != 6 {
+		t.Fatalf("expected a total of 6, got %d", facets.Total)
+	}
+	if facets.PropertyTypes[0].Value != "apartment" || facets.PropertyTypes[1].Value != "house" {
+		t.Fatalf("expected the most common type first, got %+v", facets.PropertyTypes)
+	}
+	if facets.Amenities[0].Value != "ac" || facets.Amenities[1].Value != "wifi" {
+		t.Fatalf("expected ties sorted by value, got %+v", facets.Amenities)
+	}
+	if names := facets.Amenities[1].Names; names == nil || names.Fr != "WiFi" || facets.Amenities[0].Names != nil {
+		t.Fatalf("expected the names of wifi only, got %+v", facets.Amenities)
+	}
+	if len(facets.Bedrooms) != 5 || facets.Bedrooms[0].Count != 0 || facets.Bedrooms[1].Count != 4 ||
+		facets.Bedrooms[4].Value != "4+" || facets.Bedrooms[4].Count != 2 {
+		t.Fatalf("unexpected bedroom buckets %+v", facets.Bedrooms)
+	}
+	if len(facets.Areas) != 1 || facets.Areas[0].Label != "Tevragh Zeina" {
+		t.Fatalf("unexpected areas %+v", facets.Areas)
+	}
+
+	histogram := facets.Price.Histogram
+	if len(histogram) != 3 {
+		t.Fatalf("expected 3 price buckets, got %+v", histogram)
+	}
+	if histogram[0].From != 40 || histogram[0].To != 60 || histogram[0].Count != 3 ||
+		histogram[1].Count != 0 || histogram[2].From != 80 || histogram[2].To != 100 || histogram[2].Count != 3 {
+		t.Fatalf("unexpected histogram %+v", histogram)
+	}
+
+	single := assembleFacets([]facetRow{
+		{Facet: "price_min", Value: 55},
+		{Facet: "price_max", Value: 55},
+		{Facet: "price", Key: "1", Count: 2},
+	}, 10)
+	if len(single.Price.Histogram) != 1 || single.Price.Histogram[0] != (PriceBucket{From: 55, To: 55, Count: 2}) {
+		t.Fatalf("expected a single price bucket, got %+v", single.Price.Histogram)
+	}
+
+	empty := assembleFacets(nil, 10)
+	if empty.Price.Min != nil || len(empty.Price.Histogram) != 0 || empty.Categories == nil {
+		t.Fatalf("unexpected facets without matches %+v", empty)
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"apartments-clone-server/models"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistNotified  = "notified"
+	WaitlistClaimed   = "claimed"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+// DefaultWaitlistClaimHours is how long a notified guest has to book before the next guest
+// in line gets the dates, unless WAITLIST_CLAIM_HOURS overrides it
+const DefaultWaitlistClaimHours = 24
+
+// OpenWaitlistStatuses are the statuses of entries still waiting for their dates
+var OpenWaitlistStatuses = []string{WaitlistWaiting, WaitlistNotified}
+
+var ErrAlreadyWaitlisted = errors.New("already on the waitlist for these dates")
+
+// WaitlistClaimWindow returns the configured claim window
+func WaitlistClaimWindow() time.Duration {
+	hours := DefaultWaitlistClaimHours
+	if n, err := strconv.Atoi(os.Getenv("WAITLIST_CLAIM_HOURS")); err == nil && n > 0 {
+		hours = n
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// JoinWaitlist puts a guest in line for [checkIn, checkOut). A guest can only wait once
+// for the same stay.
+func JoinWaitlist(db *gorm.DB, propertyID, userID uint, checkIn, checkOut time.Time, guests int) (*models.WaitlistEntry, error) {
+	var count int64
+	if err := db.Model(&models.WaitlistEntry{}).
+		Where("property_id = ? AND user_id = ? AND check_in = ? AND check_out = ? AND status IN ?", propertyID, userID, checkIn, checkOut, OpenWaitlistStatuses).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	entry := models.WaitlistEntry{
+		PropertyID: propertyID,
+		UserID:     userID,
+		CheckIn:    checkIn,
+		CheckOut:   checkOut,
+		NumGuests:  guests,
+		Status:     WaitlistWaiting,
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// NotifyWaitlist offers nights that just freed up in [from, to) to the property's waitlist.
+// Waiting entries are taken in the order they joined; an entry is notified when its whole stay
+// is free and no earlier guest holds an open claim on any of its nights. Claims don't take the
+// nights off the calendar, they only decide who hears about them first.
+// It returns the entries notified.
+func NotifyWaitlist(db *gorm.DB, propertyID uint, from, to time.Time) ([]models.WaitlistEntry, error) {
+	var notified []models.WaitlistEntry
+	var property *models.Property
+	now := time.Now()
+
+	// The property lock keeps two releases of the same nights from notifying two guests
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		property, err = LockPropertyForBooking(tx, propertyID)
+		if err != nil {
+			return err
+		}
+
+		var entries []models.WaitlistEntry
+		if err := tx.Where("property_id = ? AND status = ? AND check_in < ? AND check_out > ? AND check_in >= ?",
+			propertyID, WaitlistWaiting, to, from, DayStart(now)).
+			Order("created_at ASC, id ASC").Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		var held []models.WaitlistEntry
+		if err := tx.Where("property_id = ? AND status = ? AND claim_expires_at > ?", propertyID, WaitlistNotified, now).
+			Find(&held).Error; err != nil {
+			return err
+		}
+
+		expires := now.Add(WaitlistClaimWindow())
+		for _, entry := range entries {
+			if waitlistOverlaps(held, entry) {
+				continue
+			}
+			conflict, err := CheckStayAvailability(tx, propertyID, entry.CheckIn, entry.CheckOut, 0)
+			if err != nil {
+				return err
+			}
+			if conflict.Any() {
+				continue
+			}
+
+			entry.Status = WaitlistNotified
+			entry.NotifiedAt = &now
+			entry.ClaimExpiresAt = &expires
+			if err := tx.Model(&models.WaitlistEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+				"status":           entry.Status,
+				"notified_at":      entry.NotifiedAt,
+				"claim_expires_at": entry.ClaimExpiresAt,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.Notification{
+				UserID: entry.UserID,
+				Type:   "waitlist_available",
+				Title:  "Dates Available",
+				Message: fmt.Sprintf("%s is available from %s to %s. Book before %s to get it.", property.Title,
+					entry.CheckIn.Format("Jan 2, 2006"), entry.CheckOut.Format("Jan 2, 2006"), expires.Format("Jan 2, 15:04")),
+				RefType: "waitlist",
+				RefID:   entry.ID,
+			}).Error; err != nil {
+				return err
+			}
+			held = append(held, entry)
+			notified = append(notified, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notificationService := NewNotificationService()
+	for _, entry := range notified {
+		go notificationService.SendWaitlistNotificationToGuest(entry.ID, propertyID, entry.UserID, property.Title,
+			entry.CheckIn, entry.CheckOut, *entry.ClaimExpiresAt)
+	}
+	return notified, nil
+}
+
+// ClaimWaitlist closes the guest's open entries on the property that a new reservation overlaps
+func ClaimWaitlist(tx *gorm.DB, reservation *models.Reservation) error {
+	now := time.Now()
+	return tx.Model(&models.WaitlistEntry{}).
+		Where("property_id = ? AND user_id = ? AND status IN ? AND check_in < ? AND check_out > ?",
+			reservation.PropertyID, reservation.GuestID, OpenWaitlistStatuses, reservation.CheckOut, reservation.CheckIn).
+		Updates(map[string]interface{}{"status": WaitlistClaimed, "claimed_at": now, "reservation_id": reservation.ID}).Error
+}
+
+// waitlistOverlaps reports whether entry shares a night with any of the held entries
+func waitlistOverlaps(held []models.WaitlistEntry, entry models.WaitlistEntry) bool {
+	for _, h := range held {
+		if h.CheckIn.Before(entry.CheckOut) && h.CheckOut.After(entry.CheckIn) {
+			return true
+		}
+	}
+	return false
+}
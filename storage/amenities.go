@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"apartments-clone-server/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// migrateAmenities gives every catalog amenity a key (see models.AmenityKey), and links the
+// properties that have no property_amenities yet to the catalog amenities of their legacy
+// Property.Amenities list, and rewrites that list with their keys as saving a listing does:
+// values matching no amenity are dropped. The catalog itself comes from
+// migrations/003_create_categories_and_amenities.sql.
+func migrateAmenities(db *gorm.DB) {
+	if !db.Migrator().HasTable("amenities") {
+		log.Println("Warning: no amenities catalog, run migrations/003_create_categories_and_amenities.sql")
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE amenities ADD COLUMN IF NOT EXISTS key VARCHAR(50)").Error; err != nil {
+			return err
+		}
+
+		var catalog []models.Amenity
+		if err := tx.Order("id ASC").Find(&catalog).Error; err != nil {
+			return err
+		}
+		taken := map[string]bool{}
+		for _, amenity := range catalog {
+			if amenity.Key != "" {
+				taken[amenity.Key] = true
+			}
+		}
+		for i, amenity := range catalog {
+			if amenity.Key != "" {
+				continue
+			}
+			key := models.AmenityKey(amenity.Name.En)
+			switch {
+			case key == "":
+				key = fmt.Sprintf("amenity_%d", amenity.ID)
+			case taken[key]:
+				key = fmt.Sprintf("%s_%d", key, amenity.ID)
+			}
+			if err := tx.Model(&models.Amenity{}).Where("id = ?", amenity.ID).Update("key", key).Error; err != nil {
+				return err
+			}
+			taken[key] = true
+			catalog[i].Key = key
+		}
+		if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_amenities_key ON amenities (key)").Error; err != nil {
+			return err
+		}
+
+		var legacy []struct {
+			ID        uint
+			Amenities string
+		}
+		if err := tx.Model(&models.Property{}).Select("id, amenities").
+			Where("amenities LIKE ? AND NOT EXISTS (SELECT 1 FROM property_amenities pa WHERE pa.property_id = properties.id)", "[%").
+			Find(&legacy).Error; err != nil {
+			return err
+		}
+		var links []models.PropertyAmenity
+		for _, property := range legacy {
+			var values []string
+			if json.Unmarshal([]byte(property.Amenities), &values) != nil {
+				continue
+			}
+			linked := map[int]bool{}
+			keys := []string{}
+			for _, value := range values {
+				if amenity, ok := models.MatchAmenity(catalog, value); ok && !linked[amenity.ID] {
+					linked[amenity.ID] = true
+					keys = append(keys, amenity.Key)
+					links = append(links, models.PropertyAmenity{PropertyID: property.ID, AmenityID: amenity.ID})
+				}
+			}
+			list, _ := json.Marshal(keys)
+			if string(list) != property.Amenities {
+				if err := tx.Model(&models.Property{}).Where("id = ?", property.ID).Update("amenities", string(list)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(links, 500).Error; err != nil {
+			return err
+		}
+		log.Println("Linked " + strconv.Itoa(len(links)) + " listing amenities to the catalog")
+		return nil
+	})
+	if err != nil {
+		log.Println("Warning: could not migrate amenities: " + err.Error())
+	}
+}
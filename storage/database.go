@@ -65,12 +65,33 @@ func performMigrations(db *gorm.DB) {
 		&models.GroupJoinRequest{},
 		&models.Notification{},
 		&models.UserProfile{},
-		&models.PropertyAvailability{},
+		&models.AvailabilityRule{},
 		&models.PropertyPricing{},
 		&models.PropertyDiscount{},
+		&models.PriceRule{},
 		&models.PropertyBlock{},
+		&models.PriceQuote{},
+		&models.Coupon{},
+		&models.CouponTarget{},
+		&models.CouponRedemption{},
+		&models.JobRun{},
+		&models.PaymentIntent{},
+		&models.PaymentRefund{},
+		&models.Payout{},
+		&models.LedgerEntry{},
+		&models.SecurityDeposit{},
+		&models.CancellationPolicy{},
+		&models.ReservationChangeRequest{},
+		&models.ReservationTransition{},
+		&models.ExchangeRate{},
+		&models.TaxRule{},
+		&models.ReservationTax{},
+		&models.WaitlistEntry{},
+		&models.Invoice{},
+		&models.InvoiceCounter{},
 		&models.LocationCriteria{},
 		&models.LocationCriteriaProperty{},
+		&models.PropertyAmenity{},
 		&models.IdentityVerification{},
 		&models.AuditLog{},
 		&models.Feedback{},
@@ -86,6 +107,51 @@ func performMigrations(db *gorm.DB) {
 
 	// Allow direct chat groups without an experience by making experience_id nullable
 	db.Exec("ALTER TABLE experience_groups ALTER COLUMN experience_id DROP NOT NULL;")
+
+	// A booking has at most one receipt; supplements and credit notes come on top of it
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_receipt ON invoices (subject_type, subject_id) WHERE kind = 'receipt'").Error; err != nil {
+		log.Println("Warning: could not create the receipt index: " + err.Error())
+	}
+
+	migrateDailyAvailability(db)
+	migrateFullTextSearch(db)
+	migrateAmenities(db)
+}
+
+// migrateDailyAvailability folds the old one-row-per-day property_availabilities table into
+// availability_rules, one rule per run of consecutive days with the same settings. Days
+// marked booked or blocked are left out: reservations and blocks are read directly now.
+// The old table is renamed afterwards so this only runs once.
+func migrateDailyAvailability(db *gorm.DB) {
+	if !db.Migrator().HasTable("property_availabilities") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO availability_rules (created_at, updated_at, property_id, start_date, end_date, is_available, price,
+				min_stay, max_stay, check_in_time, check_out_time, notes)
+			SELECT now(), now(), property_id, MIN(day), MAX(day) + 1, is_available, price, min_stay, max_stay, check_in_time, check_out_time, notes
+			FROM (
+				SELECT *, day - (ROW_NUMBER() OVER (
+					PARTITION BY property_id, is_available, price, min_stay, max_stay, check_in_time, check_out_time, notes
+					ORDER BY day))::int AS run
+				FROM (
+					SELECT DISTINCT ON (property_id, date::date) property_id, date::date AS day, COALESCE(is_available, true) AS is_available, price,
+						COALESCE(min_stay, 0) AS min_stay, COALESCE(max_stay, 0) AS max_stay,
+						COALESCE(check_in_time, '') AS check_in_time, COALESCE(check_out_time, '') AS check_out_time, COALESCE(notes, '') AS notes
+					FROM property_availabilities
+					WHERE deleted_at IS NULL AND COALESCE(notes, '') <> 'booked' AND COALESCE(notes, '') NOT LIKE 'Blocked:%'
+					ORDER BY property_id, date::date, id DESC
+				) days
+			) runs
+			GROUP BY property_id, run, is_available, price, min_stay, max_stay, check_in_time, check_out_time, notes`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().RenameTable("property_availabilities", "property_availabilities_daily")
+	})
+	if err != nil {
+		log.Println("Warning: could not migrate daily availability: " + err.Error())
+	}
 }
 
 func InitializeDB() *gorm.DB {
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Full-text search: properties, experiences and property sales keep a weighted search_vector,
+// filled by a trigger on insert and on update of the searched columns. Text is indexed with
+// the simple configuration (names, exact words) and the French, English and Arabic stemmers,
+// so one query matches listings written in any of them. search_normalize folds what users
+// rarely type the same way: Arabic hamza and alef forms, alef maqsura, teh marbuta, tashkeel
+// and tatweel, and French accents. Queries go through listing_tsquery, which applies the same
+// steps, and excerpts through listing_headline, which highlights the listing's own text,
+// HTML-escaped, with the configuration that matched.
+
+// searchConfigs are the text search configurations every document is indexed with; arabic is
+// added when the server ships it
+var searchConfigs = []string{"simple", "french", "english"}
+
+// searchDocuments are the searched columns of each table, as the expression the trigger builds
+// the vector with, the title weighing most
+var searchDocuments = []struct {
+	table   string
+	columns string
+	vector  string
+}{
+	{
+		table:   "properties",
+		columns: "title, description, neighborhood_description, house_rules",
+		vector: `listing_tsvector(NEW.title, 'A') || listing_tsvector(NEW.description, 'B') ||
+			listing_tsvector(NEW.neighborhood_description, 'C') || listing_tsvector(NEW.house_rules, 'D')`,
+	},
+	{
+		table:   "experiences",
+		columns: "title, description, what_we_do",
+		vector:  `listing_tsvector(NEW.title, 'A') || listing_tsvector(NEW.description, 'B') || listing_tsvector(NEW.what_we_do, 'C')`,
+	},
+	{
+		table:   "property_sales",
+		columns: "title, description, features",
+		vector: `listing_tsvector(NEW.title, 'A') || listing_tsvector(NEW.description, 'B') || listing_tsvector((
+			SELECT string_agg(feature, ' ') FROM jsonb_array_elements_text(
+				CASE WHEN jsonb_typeof(NEW.features) = 'array' THEN NEW.features ELSE '[]'::jsonb END) feature), 'C')`,
+	},
+}
+
+// migrateFullTextSearch creates the search functions, the search_vector columns with their GIN
+// indexes and triggers, and fills the vector of rows that don't have one yet
+func migrateFullTextSearch(db *gorm.DB) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		configs := append([]string{}, searchConfigs...)
+		var hasArabic bool
+		if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'arabic')").Scan(&hasArabic).Error; err != nil {
+			return err
+		}
+		if hasArabic {
+			configs = append(configs, "arabic")
+		}
+
+		vectors := make([]string, len(configs))
+		queries := make([]string, len(configs))
+		for i, config := range configs {
+			vectors[i] = fmt.Sprintf("to_tsvector('%s', d)", config)
+			queries[i] = fmt.Sprintf("websearch_to_tsquery('%s', q)", config)
+		}
+		// Headlines try the stemmers first, as they also highlight the other forms of a word
+		headlineConfigs := append(append([]string{}, configs[1:]...), configs[0])
+
+		statements := []string{
+			`CREATE OR REPLACE FUNCTION search_normalize(doc text) RETURNS text
+				LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+				SELECT translate(regexp_replace(lower(COALESCE(doc, '')), '[\u064B-\u065F\u0670\u0640]', '', 'g'),
+					'أإآٱىةàâäáçéèêëíîïóôöùûüúÿ', 'اااايهaaaaceeeeiiiooouuuuy')
+			$$`,
+			`CREATE OR REPLACE FUNCTION listing_tsvector(doc text, weight "char") RETURNS tsvector
+				LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+				SELECT setweight(` + strings.Join(vectors, " || ") + `, weight) FROM search_normalize(doc) d
+			$$`,
+			`CREATE OR REPLACE FUNCTION listing_tsquery(query text) RETURNS tsquery
+				LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+				SELECT ` + strings.Join(queries, " || ") + ` FROM search_normalize(query) q
+			$$`,
+			`CREATE OR REPLACE FUNCTION listing_headline(doc text, query text, options text) RETURNS text
+				LANGUAGE sql STABLE PARALLEL SAFE AS $$
+				SELECT COALESCE(
+					(SELECT ts_headline(c.config, d, websearch_to_tsquery(c.config, query) || websearch_to_tsquery(c.config, q), options)
+						FROM unnest('{` + strings.Join(headlineConfigs, ",") + `}'::regconfig[]) WITH ORDINALITY AS c(config, n)
+						WHERE to_tsvector(c.config, d) @@ (websearch_to_tsquery(c.config, query) || websearch_to_tsquery(c.config, q))
+						ORDER BY c.n LIMIT 1),
+					ts_headline('simple', d, websearch_to_tsquery('simple', query), options))
+				FROM replace(replace(replace(replace(replace(COALESCE(doc, ''),
+					'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;') d,
+					search_normalize(query) q
+			$$`,
+		}
+		for _, doc := range searchDocuments {
+			statements = append(statements,
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector", doc.table),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_search_vector ON %s USING GIN (search_vector)", doc.table, doc.table),
+				fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s_search_vector() RETURNS trigger LANGUAGE plpgsql AS $$
+					BEGIN
+						NEW.search_vector := %s;
+						RETURN NEW;
+					END
+				$$`, doc.table, doc.vector),
+				fmt.Sprintf("DROP TRIGGER IF EXISTS %s_search_vector ON %s", doc.table, doc.table),
+				fmt.Sprintf(`CREATE TRIGGER %s_search_vector BEFORE INSERT OR UPDATE OF %s ON %s
+					FOR EACH ROW EXECUTE FUNCTION %s_search_vector()`, doc.table, doc.columns, doc.table, doc.table),
+				// Setting the title fires the trigger
+				fmt.Sprintf("UPDATE %s SET title = title WHERE search_vector IS NULL", doc.table),
+			)
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Warning: could not set up full-text search: " + err.Error())
+	}
+}
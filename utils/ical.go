@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ICalEvent is the subset of a VEVENT used for calendar sync. For all-day events
+// End is exclusive, as in RFC 5545 (a one-night stay on the 3rd ends on the 4th).
+type ICalEvent struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+}
+
+const (
+	icalDate     = "20060102"
+	icalDateTime = "20060102T150405"
+)
+
+// ParseICal reads the VEVENTs of an iCalendar document. Cancelled events are skipped.
+func ParseICal(r io.Reader) ([]ICalEvent, error) {
+	lines, err := unfoldICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ICalEvent
+	var current *ICalEvent
+	cancelled := false
+	hasEnd := false
+
+	for _, line := range lines {
+		name, params, value := splitICalLine(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &ICalEvent{}
+			cancelled, hasEnd = false, false
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("ical: END:VEVENT without BEGIN")
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("ical: event %q has no DTSTART", current.UID)
+			}
+			if !hasEnd {
+				// Without DTEND an all-day event lasts one day and a timed event is instantaneous
+				current.End = current.Start
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			if !cancelled {
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Summary = unescapeICalText(value)
+		case name == "STATUS":
+			cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			t, allDay, err := parseICalTime(params, value)
+			if err != nil {
+				return nil, err
+			}
+			current.Start, current.AllDay = t, allDay
+		case name == "DTEND":
+			t, _, err := parseICalTime(params, value)
+			if err != nil {
+				return nil, err
+			}
+			current.End, hasEnd = t, true
+		}
+	}
+
+	return events, nil
+}
+
+// WriteICal writes a VCALENDAR containing the given events
+func WriteICal(w io.Writer, calendarName string, events []ICalEvent) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(icalDateTime) + "Z"
+
+	write := func(line string) {
+		writeICalLine(bw, line)
+	}
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//apartments-clone-server//Calendar//EN")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:" + escapeICalText(calendarName))
+	for _, event := range events {
+		write("BEGIN:VEVENT")
+		write("UID:" + event.UID)
+		write("DTSTAMP:" + stamp)
+		if event.AllDay {
+			write("DTSTART;VALUE=DATE:" + event.Start.Format(icalDate))
+			write("DTEND;VALUE=DATE:" + event.End.Format(icalDate))
+		} else {
+			write("DTSTART:" + event.Start.UTC().Format(icalDateTime) + "Z")
+			write("DTEND:" + event.End.UTC().Format(icalDateTime) + "Z")
+		}
+		write("SUMMARY:" + escapeICalText(event.Summary))
+		write("END:VEVENT")
+	}
+	write("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// unfoldICalLines joins continuation lines (starting with a space or tab) onto the previous line
+func unfoldICalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitICalLine splits "NAME;PARAM=X:value" into its name, parameters and value
+func splitICalLine(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+
+	parts := strings.Split(head, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func parseICalTime(params map[string]string, value string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icalDate) {
+		t, err := time.Parse(icalDate, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ical: invalid date %q", value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icalDateTime, strings.TrimSuffix(value, "Z"))
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ical: invalid date-time %q", value)
+		}
+		return t, false, nil
+	}
+
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(icalDateTime, value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("ical: invalid date-time %q", value)
+	}
+	return t, false, nil
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+var icalTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeICalText(s string) string {
+	return icalTextEscaper.Replace(s)
+}
+
+func unescapeICalText(s string) string {
+	return icalTextUnescaper.Replace(s)
+}
+
+// writeICalLine folds lines longer than 75 octets as required by RFC 5545,
+// without splitting a UTF-8 sequence
+func writeICalLine(w *bufio.Writer, line string) {
+	const limit = 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.WriteString(line + "\r\n")
+}
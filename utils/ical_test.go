@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICal(t *testing.T) {
+	doc := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:abc@example.com",
+		"DTSTART;VALUE=DATE:20250103",
+		"DTEND;VALUE=DATE:20250106",
+		"SUMMARY:Reserved\\, thanks",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:timed@example.com",
+		"DTSTART:20250110T150000Z",
+		"DTEND:20250112T110000Z",
+		"DESCRIPTION:a long description that was folded by the",
+		"  exporting platform",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:gone@example.com",
+		"STATUS:CANCELLED",
+		"DTSTART;VALUE=DATE:20250201",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := ParseICal(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	first := events[0]
+	if !first.AllDay || first.Summary != "Reserved, thanks" || first.UID != "abc@example.com" {
+		t.Fatalf("unexpected first event %+v", first)
+	}
+	if !first.Start.Equal(time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)) || !first.End.Equal(time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected first event range %s - %s", first.Start, first.End)
+	}
+	if events[1].AllDay || events[1].End.Hour() != 11 {
+		t.Fatalf("unexpected timed event %+v", events[1])
+	}
+}
+
+func TestWriteICalRoundTrip(t *testing.T) {
+	in := []ICalEvent{{
+		UID:     "reservation-1@test",
+		Summary: strings.Repeat("Not available; ", 8),
+		Start:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC),
+		AllDay:  true,
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteICal(&buf, "Villa", in); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+	}
+
+	out, err := ParseICal(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Summary != in[0].Summary || !out[0].End.Equal(in[0].End) {
+		t.Fatalf("round trip mismatch: %+v", out)
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"gorm.io/gorm"
+)
+
+// Keyset (cursor) pagination: a page starts after the last item of the previous one instead of
+// at an offset, so items added or removed meanwhile don't shift the pages. Lists are sorted by
+// one column and then by id in the same direction, which makes the order stable; the cursor
+// holds both values of the last item, base64 encoded so clients treat it as opaque.
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is where a page ends: the sort of the list, and the sort value (a time or a number)
+// and id of the page's last item
+type Cursor struct {
+	Sort   string     `json:"s"`
+	Time   *time.Time `json:"t,omitempty"`
+	Number *float64   `json:"n,omitempty"`
+	ID     uint       `json:"i"`
+}
+
+// Encode returns the opaque form of c
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor reads a cursor made by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Keyset pages through a list sorted by Column, then by ID. Both are SQL, qualified when the
+// query joins other tables; Column is empty to sort by id alone.
+type Keyset struct {
+	Column string
+	ID     string // "id" when empty
+	Desc   bool
+	Limit  int
+	After  *Cursor // nil on the first page
+	Page   int     // page number, for clients still paging by offset when After is nil
+}
+
+// ReadKeyset reads the cursor, limit (or per_page) and page parameters into k. The limit is
+// defaultLimit when missing or above maxLimit. A cursor from another list or sort is refused.
+func ReadKeyset(ctx iris.Context, k Keyset, defaultLimit, maxLimit int) (Keyset, error) {
+	k.Limit = ctx.URLParamIntDefault("limit", ctx.URLParamIntDefault("per_page", defaultLimit))
+	if k.Limit <= 0 || k.Limit > maxLimit {
+		k.Limit = defaultLimit
+	}
+	k.Page = ctx.URLParamIntDefault("page", 1)
+	if k.Page < 1 {
+		k.Page = 1
+	}
+
+	if param := ctx.URLParam("cursor"); param != "" {
+		cursor, err := DecodeCursor(param)
+		if err != nil {
+			return k, err
+		}
+		if cursor.Sort != k.sort() || (k.Column != "" && cursor.value() == nil) {
+			return k, ErrInvalidCursor
+		}
+		k.After = cursor
+	}
+	return k, nil
+}
+
+// Apply sorts q and starts it after k.After (or at the page offset). It fetches one item more
+// than the limit, which Next removes, to know whether another page follows.
+func (k Keyset) Apply(q *gorm.DB) *gorm.DB {
+	id := k.idColumn()
+	direction, comparison := " ASC", " > "
+	if k.Desc {
+		direction, comparison = " DESC", " < "
+	}
+
+	switch {
+	case k.After != nil && k.Column == "":
+		q = q.Where(id+comparison+"?", k.After.ID)
+	case k.After != nil:
+		q = q.Where("("+k.Column+", "+id+")"+comparison+"(?, ?)", k.After.value(), k.After.ID)
+	case k.Page > 1:
+		q = q.Offset((k.Page - 1) * k.Limit)
+	}
+	if k.Column != "" {
+		q = q.Order(k.Column + direction)
+	}
+	return q.Order(id + direction).Limit(k.Limit + 1)
+}
+
+// Next takes the extra item Apply fetched off a list of n items: it returns how many belong to
+// the page, and the cursor of the next page, made by cursor from the index of the page's last
+// item, or "" when this is the last page
+func (k Keyset) Next(n int, cursor func(last int) string) (int, string) {
+	if n <= k.Limit {
+		return n, ""
+	}
+	return k.Limit, cursor(k.Limit - 1)
+}
+
+// TimeCursor is the encoded cursor of an item sorted by a time column
+func (k Keyset) TimeCursor(t time.Time, id uint) string {
+	return Cursor{Sort: k.sort(), Time: &t, ID: id}.Encode()
+}
+
+// NumberCursor is the encoded cursor of an item sorted by a numeric column
+func (k Keyset) NumberCursor(n float64, id uint) string {
+	return Cursor{Sort: k.sort(), Number: &n, ID: id}.Encode()
+}
+
+// IDCursor is the encoded cursor of an item in a list sorted by id alone
+func (k Keyset) IDCursor(id uint) string {
+	return Cursor{Sort: k.sort(), ID: id}.Encode()
+}
+
+// Meta describes the page; next is the cursor of the next page, empty on the last one
+func (k Keyset) Meta(total int64, next string) PageMeta {
+	meta := PageMeta{PerPage: k.Limit, Total: total, NextCursor: next}
+	if k.After == nil {
+		meta.Page = k.Page
+	}
+	return meta
+}
+
+// SetPageHeaders reports the page in headers, for lists answered as a bare JSON array
+func SetPageHeaders(ctx iris.Context, meta PageMeta) {
+	ctx.Header("X-Total-Count", strconv.FormatInt(meta.Total, 10))
+	if meta.NextCursor != "" {
+		ctx.Header("X-Next-Cursor", meta.NextCursor)
+	}
+}
+
+func (k Keyset) idColumn() string {
+	if k.ID == "" {
+		return "id"
+	}
+	return k.ID
+}
+
+// sort identifies the list order, so a cursor can't be used with another one
+func (k Keyset) sort() string {
+	direction := " asc"
+	if k.Desc {
+		direction = " desc"
+	}
+	return k.Column + "," + k.idColumn() + direction
+}
+
+func (c Cursor) value() interface{} {
+	switch {
+	case c.Time != nil:
+		return *c.Time
+	case c.Number != nil:
+		return *c.Number
+	}
+	return nil
+}
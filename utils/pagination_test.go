@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	k := Keyset{Column: "created_at", Desc: true, Limit: 2}
+	at := time.Date(2025, 3, 1, 10, 30, 0, 123456000, time.UTC)
+
+	cursor, err := DecodeCursor(k.TimeCursor(at, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Sort != k.sort() || cursor.ID != 42 || cursor.Time == nil || !cursor.Time.Equal(at) {
+		t.Fatalf("unexpected cursor %+v", cursor)
+	}
+
+	cursor, err = DecodeCursor(Keyset{Column: "nightly_price"}.NumberCursor(79.5, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Number == nil || *cursor.Number != 79.5 || cursor.Sort == k.sort() {
+		t.Fatalf("unexpected cursor %+v", cursor)
+	}
+
+	for _, bad := range []string{"%%%", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(bad); err != ErrInvalidCursor {
+			t.Fatalf("expected ErrInvalidCursor for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestKeysetNext(t *testing.T) {
+	k := Keyset{Desc: true, Limit: 3}
+	ids := []uint{9, 8, 7, 6}
+	cursorOf := func(last int) string { return k.IDCursor(ids[last]) }
+
+	n, next := k.Next(len(ids), cursorOf)
+	if n != 3 || next == "" {
+		t.Fatalf("expected 3 items and a next page, got %d %q", n, next)
+	}
+	if cursor, _ := DecodeCursor(next); cursor.ID != 7 {
+		t.Fatalf("expected the next page after 7, got %d", cursor.ID)
+	}
+
+	if n, next := k.Next(3, cursorOf); n != 3 || next != "" {
+		t.Fatalf("expected a last page of 3, got %d %q", n, next)
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when a URL fetched for a user leads to an address that
+// isn't on the public internet
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// carrierNAT is the shared address space of RFC 6598, private to the provider's network
+var carrierNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether ip may be reached on behalf of a user: not loopback, private,
+// link-local (169.254.169.254 included), multicast or unspecified
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || carrierNAT.Contains(ip))
+}
+
+// CheckPublicURL refuses URLs that aren't https or have no host
+func CheckPublicURL(u *url.URL) error {
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("url must be https")
+	}
+	return nil
+}
+
+// NewPublicClient returns an HTTP client for URLs given by users. Every connection, redirects
+// included, is checked on the IP it dials, after DNS resolution, so neither a hostname nor a
+// redirect can lead it to the server's own network.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrNonPublicAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return CheckPublicURL(req.URL)
+		},
+	}
+}
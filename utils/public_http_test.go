@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1",
+		"169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::", "100.64.0.1", "::ffff:127.0.0.1"} {
+		if IsPublicIP(net.ParseIP(address)) {
+			t.Errorf("%s should not be public", address)
+		}
+	}
+	for _, address := range []string{"8.8.8.8", "151.101.1.69", "2606:4700::1111"} {
+		if !IsPublicIP(net.ParseIP(address)) {
+			t.Errorf("%s should be public", address)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://calendar.example.com/a.ics": true,
+		"http://calendar.example.com/a.ics":  false,
+		"file:///etc/passwd":                 false,
+		"https:///a.ics":                     false,
+	} {
+		u, _ := url.Parse(raw)
+		if err := CheckPublicURL(u); (err == nil) != ok {
+			t.Errorf("%s: unexpected %v", raw, err)
+		}
+	}
+}
@@ -4,16 +4,23 @@ import (
 	"github.com/kataras/iris/v12"
 )
 
+// PageMeta describes a page of a list. Page is 0 for pages read by cursor (see Keyset), and
+// NextCursor is empty on the last page.
 type PageMeta struct {
-	Page    int   `json:"page"`
-	PerPage int   `json:"per_page"`
-	Total   int64 `json:"total"`
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 func JSONPage(ctx iris.Context, data interface{}, page, perPage int, total int64) {
+	JSONPageMeta(ctx, data, PageMeta{Page: page, PerPage: perPage, Total: total})
+}
+
+func JSONPageMeta(ctx iris.Context, data interface{}, meta PageMeta) {
 	ctx.JSON(iris.Map{
 		"data":  data,
-		"meta":  PageMeta{Page: page, PerPage: perPage, Total: total},
+		"meta":  meta,
 		"links": iris.Map{},
 	})
 }